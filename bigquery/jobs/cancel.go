@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+	"google.golang.org/api/iterator"
+)
+
+// Job Type
+const (
+	JobTypeQuery   = "QUERY"
+	JobTypeLoad    = "LOAD"
+	JobTypeExtract = "EXTRACT"
+	JobTypeCopy    = "COPY"
+)
+
+// ActiveJob is 実行中もしくは実行待ちのJob
+type ActiveJob struct {
+	ProjectID string `json:"projectID"`
+	JobID     string `json:"jobID"`
+	Location  string `json:"location"`
+	UserEmail string `json:"userEmail"`
+
+	// JobType is QUERY, LOAD, EXTRACT, COPY
+	JobType string            `json:"jobType"`
+	Labels  map[string]string `json:"labels,omitempty"`
+
+	// State is PENDING, RUNNING
+	State        string    `json:"state"`
+	CreationTime time.Time `json:"creationTime"`
+	StartTime    time.Time `json:"startTime,omitempty"`
+
+	// BytesProcessed is 実行中のQueryの場合は見積もりの値
+	BytesProcessed int64 `json:"bytesProcessed"`
+
+	// Query is Query文字列. 長い場合は先頭だけ
+	Query string `json:"query,omitempty"`
+
+	job *bigquery.Job
+}
+
+// Elapsed is Jobが開始してからの時間を返す. 開始していない場合は作成してからの時間
+func (j *ActiveJob) Elapsed(now time.Time) time.Duration {
+	if !j.StartTime.IsZero() {
+		return now.Sub(j.StartTime)
+	}
+	return now.Sub(j.CreationTime)
+}
+
+// JobFilter is 対象にするJobの条件. 空の項目は条件にしない
+type JobFilter struct {
+	UserEmail string
+
+	// Labels is Jobに付いていないといけないLabel
+	// valueが空の場合はkeyが付いていれば対象にする
+	Labels map[string]string
+
+	// JobType is QUERY, LOAD, EXTRACT, COPY
+	JobType string
+
+	// MinElapsed is Jobが開始してから、これ以上経過しているものを対象にする
+	MinElapsed time.Duration
+
+	// MinBytesProcessed is 処理したByte数がこれ以上のものを対象にする
+	MinBytesProcessed int64
+}
+
+// Match is Jobが条件に合致するかどうか
+func (f *JobFilter) Match(j *ActiveJob, now time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if f.UserEmail != "" && f.UserEmail != j.UserEmail {
+		return false
+	}
+	for k, v := range f.Labels {
+		lv, ok := j.Labels[k]
+		if !ok {
+			return false
+		}
+		if v != "" && v != lv {
+			return false
+		}
+	}
+	if f.JobType != "" && f.JobType != j.JobType {
+		return false
+	}
+	if f.MinElapsed > 0 && j.Elapsed(now) < f.MinElapsed {
+		return false
+	}
+	if f.MinBytesProcessed > 0 && j.BytesProcessed < f.MinBytesProcessed {
+		return false
+	}
+	return true
+}
+
+// ListActiveJobs is projectIDの全てのUserの実行中と実行待ちのJobの中から、filterに合致するものを返す
+//
+// INFORMATION_SCHEMA.JOBSはSlotが足りない時にQuery自体が待たされるので、APIで一覧を取る
+func (s *Service) ListActiveJobs(ctx context.Context, projectID string, filter *JobFilter) ([]*ActiveJob, error) {
+	now := time.Now()
+	var results []*ActiveJob
+	for _, state := range []bigquery.State{bigquery.Running, bigquery.Pending} {
+		it := s.bq.Jobs(ctx)
+		it.ProjectID = projectID
+		it.AllUsers = true
+		it.State = state
+		for {
+			job, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed list jobs %s : %w", projectID, err)
+			}
+			j, err := newActiveJob(job)
+			if err != nil {
+				return nil, err
+			}
+			if !filter.Match(j, now) {
+				continue
+			}
+			results = append(results, j)
+		}
+	}
+	return results, nil
+}
+
+func newActiveJob(job *bigquery.Job) (*ActiveJob, error) {
+	j := &ActiveJob{
+		ProjectID: job.ProjectID(),
+		JobID:     job.ID(),
+		Location:  job.Location(),
+		UserEmail: job.Email(),
+		job:       job,
+	}
+	if status := job.LastStatus(); status != nil {
+		j.State = jobState(status.State)
+		if stats := status.Statistics; stats != nil {
+			j.CreationTime = stats.CreationTime
+			j.StartTime = stats.StartTime
+			j.BytesProcessed = stats.TotalBytesProcessed
+			if qs, ok := stats.Details.(*bigquery.QueryStatistics); ok && qs.TotalBytesProcessed > j.BytesProcessed {
+				j.BytesProcessed = qs.TotalBytesProcessed
+			}
+		}
+	}
+
+	cfg, err := job.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed get job config %s : %w", job.ID(), err)
+	}
+	j.JobType = jobType(cfg)
+	switch c := cfg.(type) {
+	case *bigquery.QueryConfig:
+		j.Labels = c.Labels
+		j.Query = c.Q
+		if len(j.Query) > maxQueryLength {
+			j.Query = j.Query[:maxQueryLength]
+		}
+	case *bigquery.LoadConfig:
+		j.Labels = c.Labels
+	case *bigquery.ExtractConfig:
+		j.Labels = c.Labels
+	case *bigquery.CopyConfig:
+		j.Labels = c.Labels
+	}
+	return j, nil
+}
+
+func jobType(cfg bigquery.JobConfig) string {
+	switch cfg.(type) {
+	case *bigquery.QueryConfig:
+		return JobTypeQuery
+	case *bigquery.LoadConfig:
+		return JobTypeLoad
+	case *bigquery.ExtractConfig:
+		return JobTypeExtract
+	case *bigquery.CopyConfig:
+		return JobTypeCopy
+	}
+	return ""
+}
+
+func jobState(state bigquery.State) string {
+	switch state {
+	case bigquery.Pending:
+		return "PENDING"
+	case bigquery.Running:
+		return "RUNNING"
+	case bigquery.Done:
+		return "DONE"
+	}
+	return "UNSPECIFIED"
+}
+
+// CancelJobs is Jobの取り消しを要求する
+//
+// Cancelは非同期に行われるので、この関数が返った時点ではJobはまだ終わっていない場合がある
+// 途中で失敗したJobがあっても残りのJobの処理は続け、最後にまとめてerrorを返す
+func (s *Service) CancelJobs(ctx context.Context, jobs []*ActiveJob, ops ...APIOptions) (int, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	var count int
+	var errs []error
+	for _, j := range jobs {
+		e := &events.Event{
+			Type:     events.Canceled,
+			Action:   "cancel",
+			Resource: j.JobID,
+			Reason:   fmt.Sprintf("user=%s type=%s elapsed=%s", j.UserEmail, j.JobType, j.Elapsed(time.Now()).Truncate(time.Second)),
+			DryRun:   opt.dryRun,
+		}
+		if opt.dryRun {
+			opt.report(ctx, e)
+			count++
+			continue
+		}
+		job := j.job
+		if job == nil {
+			v, err := s.bq.JobFromProject(ctx, j.ProjectID, j.JobID, j.Location)
+			if err != nil {
+				opt.report(ctx, &events.Event{Type: events.Failed, Action: "cancel", Resource: j.JobID, Err: err})
+				errs = append(errs, fmt.Errorf("failed get job %s : %w", j.JobID, err))
+				continue
+			}
+			job = v
+		}
+		if err := job.Cancel(ctx); err != nil {
+			opt.report(ctx, &events.Event{Type: events.Failed, Action: "cancel", Resource: j.JobID, Err: err})
+			errs = append(errs, fmt.Errorf("failed cancel job %s : %w", j.JobID, err))
+			continue
+		}
+		opt.report(ctx, e)
+		count++
+	}
+	return count, errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package jobs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+)
+
+func TestJobFilter_Match(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	job := &jobs.ActiveJob{
+		UserEmail:      "scheduler@hoge.iam.gserviceaccount.com",
+		JobType:        jobs.JobTypeQuery,
+		Labels:         map[string]string{"app": "scheduler", "env": "prod"},
+		CreationTime:   now.Add(-2 * time.Hour),
+		StartTime:      now.Add(-time.Hour),
+		BytesProcessed: 10 * jobs.TiB,
+	}
+
+	cases := []struct {
+		name   string
+		filter *jobs.JobFilter
+		want   bool
+	}{
+		{"nil", nil, true},
+		{"empty", &jobs.JobFilter{}, true},
+		{"user", &jobs.JobFilter{UserEmail: "scheduler@hoge.iam.gserviceaccount.com"}, true},
+		{"other user", &jobs.JobFilter{UserEmail: "alice@example.com"}, false},
+		{"label", &jobs.JobFilter{Labels: map[string]string{"app": "scheduler"}}, true},
+		{"label key", &jobs.JobFilter{Labels: map[string]string{"env": ""}}, true},
+		{"other label", &jobs.JobFilter{Labels: map[string]string{"app": "batch"}}, false},
+		{"job type", &jobs.JobFilter{JobType: jobs.JobTypeQuery}, true},
+		{"other job type", &jobs.JobFilter{JobType: jobs.JobTypeLoad}, false},
+		{"elapsed", &jobs.JobFilter{MinElapsed: 30 * time.Minute}, true},
+		{"elapsed from start time", &jobs.JobFilter{MinElapsed: 90 * time.Minute}, false},
+		{"bytes", &jobs.JobFilter{MinBytesProcessed: jobs.TiB}, true},
+		{"too few bytes", &jobs.JobFilter{MinBytesProcessed: 100 * jobs.TiB}, false},
+		{"all", &jobs.JobFilter{UserEmail: "scheduler@hoge.iam.gserviceaccount.com", JobType: jobs.JobTypeQuery, MinElapsed: time.Minute, MinBytesProcessed: 1}, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if g, e := tt.filter.Match(job, now), tt.want; g != e {
+				t.Errorf("want %t but got %t", e, g)
+			}
+		})
+	}
+}
+
+func TestActiveJob_Elapsed(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	pending := &jobs.ActiveJob{CreationTime: now.Add(-time.Minute)}
+	if g, e := pending.Elapsed(now), time.Minute; g != e {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
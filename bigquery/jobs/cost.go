@@ -0,0 +1,201 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// TiB is On-demandの料金計算の単位
+	TiB = 1024 * 1024 * 1024 * 1024
+
+	// OnDemandPricePerTiB is On-demandのQueryの1TiBあたりの料金(USD). US multi-region
+	OnDemandPricePerTiB = 6.25
+
+	// DefaultTopQueries is QueryCostに含める料金の高いQueryの数のデフォルト
+	DefaultTopQueries = 3
+
+	// maxQueryLength is TopQueryに含めるQuery文字列の最大長
+	maxQueryLength = 1000
+)
+
+// QueryCost is 1日ごと、Userごと、Labelの組み合わせごとのQueryの料金とSlotの使用量
+type QueryCost struct {
+	ProjectID string     `json:"projectID"`
+	Date      civil.Date `json:"date"`
+
+	// UserEmail is Jobを実行したUserもしくはService Account
+	UserEmail string `json:"userEmail"`
+
+	// Labels is Jobに付いていたLabel. Labelの組み合わせが異なるJobは別々に集計する
+	Labels map[string]string `json:"labels,omitempty"`
+
+	JobCount            int64 `json:"jobCount"`
+	TotalBytesProcessed int64 `json:"totalBytesProcessed"`
+	TotalBytesBilled    int64 `json:"totalBytesBilled"`
+	TotalSlotMs         int64 `json:"totalSlotMs"`
+
+	// EstimatedOnDemandCost is TotalBytesBilledをOn-demandの料金で計算した料金(USD)
+	// Editionsを使っている場合は実際の料金とは異なる
+	EstimatedOnDemandCost float64 `json:"estimatedOnDemandCost"`
+
+	// TopQueries is TotalBytesBilledが大きいQuery
+	TopQueries []*TopQuery `json:"topQueries,omitempty"`
+}
+
+// TopQuery is QueryCostの中で料金が高いQuery
+type TopQuery struct {
+	JobID            string `json:"jobID"`
+	TotalBytesBilled int64  `json:"totalBytesBilled"`
+	TotalSlotMs      int64  `json:"totalSlotMs"`
+
+	// Query is Query文字列. 長い場合は先頭だけ
+	Query string `json:"query"`
+}
+
+// QueryCostConfig is ExportQueryCostの設定
+type QueryCostConfig struct {
+	// Location is 対象のJobが実行されたRegion. eg. US, asia-northeast1
+	Location string
+
+	// Start is 対象のJobが作成された時間の開始. この時間を含む
+	Start time.Time
+
+	// End is 対象のJobが作成された時間の終了. この時間を含まない
+	End time.Time
+
+	// TopQueries is 含める料金の高いQueryの数. 0の場合はDefaultTopQueries
+	TopQueries int
+
+	// PricePerTiB is On-demandのQueryの1TiBあたりの料金(USD). 0の場合はOnDemandPricePerTiB
+	PricePerTiB float64
+}
+
+type queryCostRow struct {
+	Date                civil.Date `bigquery:"date"`
+	UserEmail           string     `bigquery:"user_email"`
+	Labels              string     `bigquery:"labels"`
+	JobCount            int64      `bigquery:"job_count"`
+	TotalBytesProcessed int64      `bigquery:"total_bytes_processed"`
+	TotalBytesBilled    int64      `bigquery:"total_bytes_billed"`
+	TotalSlotMs         int64      `bigquery:"total_slot_ms"`
+	TopQueries          []*struct {
+		JobID            string `bigquery:"job_id"`
+		TotalBytesBilled int64  `bigquery:"total_bytes_billed"`
+		TotalSlotMs      int64  `bigquery:"total_slot_ms"`
+		Query            string `bigquery:"query"`
+	} `bigquery:"top_queries"`
+}
+
+// ExportQueryCost is INFORMATION_SCHEMA.JOBSから、1日ごと、Userごと、Labelの組み合わせごとにQueryの料金とSlotの使用量を集計して、JSON Linesでwに書き込む
+//
+// Scriptの親Jobは子Jobと重複するので対象外
+func (s *Service) ExportQueryCost(ctx context.Context, w io.Writer, projectID string, cfg *QueryCostConfig) error {
+	topQueries := cfg.TopQueries
+	if topQueries == 0 {
+		topQueries = DefaultTopQueries
+	}
+	price := cfg.PricePerTiB
+	if price == 0 {
+		price = OnDemandPricePerTiB
+	}
+
+	sql := fmt.Sprintf("WITH j AS (\n"+
+		"  SELECT DATE(creation_time) AS date, user_email,\n"+
+		"    IFNULL((SELECT STRING_AGG(CONCAT(l.key, '=', l.value), ',' ORDER BY l.key) FROM UNNEST(labels) AS l), '') AS labels,\n"+
+		"    job_id, IFNULL(total_bytes_processed, 0) AS total_bytes_processed, IFNULL(total_bytes_billed, 0) AS total_bytes_billed,\n"+
+		"    IFNULL(total_slot_ms, 0) AS total_slot_ms, query\n"+
+		"  FROM `%s`.`%s`.INFORMATION_SCHEMA.JOBS\n"+
+		"  WHERE creation_time >= @start AND creation_time < @end\n"+
+		"    AND job_type = 'QUERY'\n"+
+		"    AND IFNULL(statement_type, '') != 'SCRIPT'\n"+
+		")\n"+
+		"SELECT date, user_email, labels,\n"+
+		"  COUNT(*) AS job_count,\n"+
+		"  SUM(total_bytes_processed) AS total_bytes_processed,\n"+
+		"  SUM(total_bytes_billed) AS total_bytes_billed,\n"+
+		"  SUM(total_slot_ms) AS total_slot_ms,\n"+
+		"  ARRAY_AGG(STRUCT(job_id, total_bytes_billed, total_slot_ms, LEFT(query, %d) AS query) ORDER BY total_bytes_billed DESC LIMIT %d) AS top_queries\n"+
+		"FROM j\n"+
+		"GROUP BY date, user_email, labels\n"+
+		"ORDER BY date, total_bytes_billed DESC", projectID, tables.RegionQualifier(cfg.Location), maxQueryLength, topQueries)
+	q := s.bq.Query(sql)
+	q.Location = cfg.Location
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "start", Value: cfg.Start},
+		{Name: "end", Value: cfg.End},
+	}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("failed query jobs : %w", err)
+	}
+	for {
+		var row queryCostRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		v := &QueryCost{
+			ProjectID:             projectID,
+			Date:                  row.Date,
+			UserEmail:             row.UserEmail,
+			Labels:                ParseLabels(row.Labels),
+			JobCount:              row.JobCount,
+			TotalBytesProcessed:   row.TotalBytesProcessed,
+			TotalBytesBilled:      row.TotalBytesBilled,
+			TotalSlotMs:           row.TotalSlotMs,
+			EstimatedOnDemandCost: OnDemandCost(row.TotalBytesBilled, price),
+		}
+		for _, tq := range row.TopQueries {
+			v.TopQueries = append(v.TopQueries, &TopQuery{
+				JobID:            tq.JobID,
+				TotalBytesBilled: tq.TotalBytesBilled,
+				TotalSlotMs:      tq.TotalSlotMs,
+				Query:            tq.Query,
+			})
+		}
+
+		j, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", j)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnDemandCost is bytesBilledをOn-demandの料金で計算した料金(USD)を返す
+func OnDemandCost(bytesBilled int64, pricePerTiB float64) float64 {
+	return float64(bytesBilled) / TiB * pricePerTiB
+}
+
+// ParseLabels is key=value,key=value 形式の文字列をLabelのmapにする
+//
+// Labelのkeyとvalueには,と=は使えないので、そのまま分割できる
+func ParseLabels(v string) map[string]string {
+	if v == "" {
+		return nil
+	}
+	labels := map[string]string{}
+	for _, kv := range strings.Split(v, ",") {
+		k, lv, _ := strings.Cut(kv, "=")
+		labels[k] = lv
+	}
+	return labels
+}
@@ -0,0 +1,37 @@
+package jobs_test
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+)
+
+func TestParseLabels(t *testing.T) {
+	cases := []struct {
+		name string
+		v    string
+		want map[string]string
+	}{
+		{"empty", "", nil},
+		{"single", "team=analytics", map[string]string{"team": "analytics"}},
+		{"multiple", "env=prod,team=analytics", map[string]string{"env": "prod", "team": "analytics"}},
+		{"empty value", "adhoc=", map[string]string{"adhoc": ""}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := jobs.ParseLabels(tt.v)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("want %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOnDemandCost(t *testing.T) {
+	got := jobs.OnDemandCost(2*jobs.TiB, jobs.OnDemandPricePerTiB)
+	if got != 12.5 {
+		t.Errorf("want 12.5 but got %f", got)
+	}
+}
@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"strings"
+	"unicode"
+)
+
+// sqlToken is SQLを分割した1つの要素
+type sqlToken struct {
+	kind  sqlTokenKind
+	value string
+}
+
+type sqlTokenKind int
+
+const (
+	tokenWord sqlTokenKind = iota
+	tokenQuotedIdentifier
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+// clause is Column名を集めているSQLの句
+type clause int
+
+const (
+	clauseOther clause = iota
+	clauseFilter
+	clauseJoin
+)
+
+// clauseEndKeywords is WHERE, ON, USINGの句を終わらせるKeyword
+var clauseEndKeywords = map[string]bool{
+	"SELECT": true, "GROUP": true, "ORDER": true, "LIMIT": true, "WINDOW": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "JOIN": true, "LEFT": true, "RIGHT": true,
+	"INNER": true, "FULL": true, "CROSS": true, "QUALIFY": true, "HAVING": true,
+}
+
+// PredicateColumns is SQLのWHEREで絞り込みに使われているColumnと、JOINのON, USINGで使われているColumnを返す
+//
+// columnsに含まれる名前だけを大文字小文字を区別せずに探し、columnsの名前で返す. 同じColumnは1回だけ返す
+// t.col のように修飾されている場合は、columnsに含まれる最も左の要素をColumnとみなす
+// 構文解析はしていないので、Function名やLiteralの型名と同じ名前のColumnは拾わない
+func PredicateColumns(sql string, columns []string) (filters []string, joins []string) {
+	names := map[string]string{}
+	for _, c := range columns {
+		names[strings.ToLower(c)] = c
+	}
+
+	tokens := tokenizeSQL(sql)
+	// 括弧ごとに句を持ち、Subqueryが終わったら外側の句に戻る
+	stack := []clause{clauseOther}
+	seenFilter := map[string]bool{}
+	seenJoin := map[string]bool{}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		current := stack[len(stack)-1]
+		switch t.kind {
+		case tokenSymbol:
+			switch t.value {
+			case "(":
+				stack = append(stack, current)
+			case ")":
+				if len(stack) > 1 {
+					stack = stack[:len(stack)-1]
+				}
+			case ";":
+				stack = []clause{clauseOther}
+			}
+			continue
+		case tokenWord:
+			upper := strings.ToUpper(t.value)
+			isFunction := i+1 < len(tokens) && tokens[i+1].kind == tokenSymbol && tokens[i+1].value == "("
+			switch {
+			case upper == "WHERE":
+				stack[len(stack)-1] = clauseFilter
+				continue
+			case upper == "ON" || upper == "USING":
+				stack[len(stack)-1] = clauseJoin
+				continue
+			case isFunction:
+				// LEFT(col, 3) のようなFunctionは句を終わらせない
+			case clauseEndKeywords[upper]:
+				stack[len(stack)-1] = clauseOther
+				continue
+			}
+		case tokenQuotedIdentifier:
+		default:
+			continue
+		}
+		if current == clauseOther {
+			continue
+		}
+
+		// a.b.c のように.で繋がっている識別子をまとめる
+		parts := splitIdentifier(t)
+		for i+2 < len(tokens) && tokens[i+1].kind == tokenSymbol && tokens[i+1].value == "." &&
+			(tokens[i+2].kind == tokenWord || tokens[i+2].kind == tokenQuotedIdentifier) {
+			parts = append(parts, splitIdentifier(tokens[i+2])...)
+			i += 2
+		}
+		if t.kind == tokenWord && len(parts) == 1 {
+			if i+1 < len(tokens) {
+				next := tokens[i+1]
+				// Function呼び出しや DATE '2024-01-01' のような型付きLiteral
+				if next.kind == tokenString || (next.kind == tokenSymbol && next.value == "(") {
+					continue
+				}
+			}
+			// INTERVAL 7 DAY のような単位
+			if i > 0 && tokens[i-1].kind == tokenNumber {
+				continue
+			}
+		}
+
+		for _, p := range parts {
+			name, ok := names[strings.ToLower(p)]
+			if !ok {
+				continue
+			}
+			if current == clauseFilter && !seenFilter[name] {
+				seenFilter[name] = true
+				filters = append(filters, name)
+			}
+			if current == clauseJoin && !seenJoin[name] {
+				seenJoin[name] = true
+				joins = append(joins, name)
+			}
+			break
+		}
+	}
+	return filters, joins
+}
+
+func splitIdentifier(t sqlToken) []string {
+	if t.kind == tokenQuotedIdentifier {
+		return strings.Split(t.value, ".")
+	}
+	return []string{t.value}
+}
+
+// tokenizeSQL is SQLをCommentを除いてTokenに分割する
+func tokenizeSQL(sql string) []sqlToken {
+	var tokens []sqlToken
+	r := []rune(sql)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '#' || (c == '-' && i+1 < len(r) && r[i+1] == '-'):
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			j := i + 2
+			for j+1 < len(r) && (r[j] != '*' || r[j+1] != '/') {
+				j++
+			}
+			i = j + 2
+		case c == '`':
+			j := i + 1
+			for j < len(r) && r[j] != '`' {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenQuotedIdentifier, value: string(r[i+1 : min(j, len(r))])})
+			i = j + 1
+		case c == '\'' || c == '"':
+			i = skipString(r, i)
+			tokens = append(tokens, sqlToken{kind: tokenString})
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.' || unicode.IsLetter(r[j])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenNumber, value: string(r[i:j])})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_') {
+				j++
+			}
+			// r'...' b'...' のようなPrefix付きのString Literal
+			if j < len(r) && (r[j] == '\'' || r[j] == '"') && j-i <= 2 && strings.ContainsAny(strings.ToLower(string(r[i:j])), "rb") {
+				i = skipString(r, j)
+				tokens = append(tokens, sqlToken{kind: tokenString})
+				continue
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, value: string(r[i:j])})
+			i = j
+		default:
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, value: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// skipString is r[i]から始まるString Literalの次の位置を返す. 3つのQuoteで囲まれたLiteralにも対応する
+func skipString(r []rune, i int) int {
+	quote := r[i]
+	if i+2 < len(r) && r[i+1] == quote && r[i+2] == quote {
+		for j := i + 3; j+2 < len(r); j++ {
+			if r[j] == '\\' {
+				j++
+				continue
+			}
+			if r[j] == quote && r[j+1] == quote && r[j+2] == quote {
+				return j + 3
+			}
+		}
+		return len(r)
+	}
+	for j := i + 1; j < len(r); j++ {
+		if r[j] == '\\' {
+			j++
+			continue
+		}
+		if r[j] == quote {
+			return j + 1
+		}
+	}
+	return len(r)
+}
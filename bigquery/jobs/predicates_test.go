@@ -0,0 +1,70 @@
+package jobs_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+)
+
+func TestPredicateColumns(t *testing.T) {
+	columns := []string{"event_date", "user_id", "country", "date", "device", "amount"}
+
+	cases := []struct {
+		name        string
+		sql         string
+		wantFilters []string
+		wantJoins   []string
+	}{
+		{
+			name:        "where",
+			sql:         "SELECT amount FROM `hoge.logs.events` WHERE event_date >= '2024-01-01' AND Country = 'JP'",
+			wantFilters: []string{"event_date", "country"},
+		},
+		{
+			name:        "join",
+			sql:         "SELECT e.amount FROM logs.events AS e JOIN logs.users AS u ON e.user_id = u.user_id WHERE e.event_date = CURRENT_DATE()",
+			wantFilters: []string{"event_date"},
+			wantJoins:   []string{"user_id"},
+		},
+		{
+			name:      "using",
+			sql:       "SELECT * FROM logs.events JOIN logs.users USING (user_id)",
+			wantJoins: []string{"user_id"},
+		},
+		{
+			name:        "typed literal, function and interval",
+			sql:         "SELECT * FROM logs.events WHERE event_date > DATE_SUB(DATE '2024-01-01', INTERVAL 7 DAY) AND LEFT(country, 1) = 'J'",
+			wantFilters: []string{"event_date", "country"},
+		},
+		{
+			name:        "subquery",
+			sql:         "SELECT * FROM logs.events WHERE user_id IN (SELECT user_id FROM logs.users WHERE amount > 0) AND `date` = '2024-01-01'",
+			wantFilters: []string{"user_id", "amount", "date"},
+		},
+		{
+			name:        "nested field",
+			sql:         "SELECT * FROM logs.events AS e WHERE e.device.os = 'ios'",
+			wantFilters: []string{"device"},
+		},
+		{
+			name: "comments and strings",
+			sql:  "SELECT country -- WHERE country = 'JP'\nFROM logs.events /* WHERE user_id = 1 */ WHERE 'user_id' = \"amount\"",
+		},
+		{
+			name: "select only",
+			sql:  "SELECT event_date, user_id FROM logs.events GROUP BY event_date, user_id",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, joins := jobs.PredicateColumns(tt.sql, columns)
+			if !reflect.DeepEqual(filters, tt.wantFilters) {
+				t.Errorf("filters want %v but got %v", tt.wantFilters, filters)
+			}
+			if !reflect.DeepEqual(joins, tt.wantJoins) {
+				t.Errorf("joins want %v but got %v", tt.wantJoins, joins)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package jobs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultMaxBytesProcessed is RunQueryで実行を許可する見積もりのByte数のデフォルト. 10GiB
+const DefaultMaxBytesProcessed int64 = 10 * 1024 * 1024 * 1024
+
+// ErrExceededMaxBytesProcessed is Dry Runで見積もったByte数が上限を超えている
+var ErrExceededMaxBytesProcessed = fmt.Errorf("exceeded max bytes processed")
+
+// DefaultQueryLabels is gcptoolboxが実行したJobであることを示すLabel
+var DefaultQueryLabels = map[string]string{
+	"created-by": "gcptoolbox",
+}
+
+// OutputFormat is Queryの結果を出力する形式
+type OutputFormat string
+
+const (
+	OutputFormatCSV     OutputFormat = "csv"
+	OutputFormatNDJSON  OutputFormat = "ndjson"
+	OutputFormatParquet OutputFormat = "parquet"
+)
+
+// ParseOutputFormat is csv, ndjson(json), parquetからOutputFormatを返す
+func ParseOutputFormat(v string) (OutputFormat, error) {
+	switch strings.ToLower(v) {
+	case "csv":
+		return OutputFormatCSV, nil
+	case "ndjson", "json", "jsonl":
+		return OutputFormatNDJSON, nil
+	case "parquet":
+		return OutputFormatParquet, nil
+	}
+	return "", fmt.Errorf("invalid output format %s", v)
+}
+
+func (f OutputFormat) dataFormat() bigquery.DataFormat {
+	switch f {
+	case OutputFormatNDJSON:
+		return bigquery.JSON
+	case OutputFormatParquet:
+		return bigquery.Parquet
+	}
+	return bigquery.CSV
+}
+
+// QueryConfig is RunQueryの設定
+type QueryConfig struct {
+	SQL string
+
+	// Location is Queryを実行するRegion. 空の場合はQueryが参照するTableから決まる
+	Location string
+
+	// MaxBytesProcessed is Dry Runで見積もったByte数がこれを超える場合は実行しない. 0の場合はDefaultMaxBytesProcessed
+	// Forceでなければ実行するQueryのMaxBytesBilledにも設定する
+	MaxBytesProcessed int64
+
+	// Force is 見積もったByte数がMaxBytesProcessedを超えていても実行する
+	Force bool
+
+	// Labels is Jobに付けるLabel. DefaultQueryLabelsに追加する. DefaultQueryLabelsと同じKeyは指定できない
+	Labels map[string]string
+}
+
+// QueryResult is RunQueryの結果
+type QueryResult struct {
+	ProjectID string `json:"projectID"`
+	JobID     string `json:"jobID"`
+	Location  string `json:"location"`
+
+	// EstimatedBytesProcessed is Dry Runで見積もったByte数
+	EstimatedBytesProcessed int64 `json:"estimatedBytesProcessed"`
+
+	// EstimatedOnDemandCost is EstimatedBytesProcessedをOn-demandの料金で計算した料金(USD)
+	EstimatedOnDemandCost float64 `json:"estimatedOnDemandCost"`
+
+	// TotalBytesBilled is 実行したQueryの課金対象のByte数. Dry Runの場合は0
+	TotalBytesBilled int64 `json:"totalBytesBilled"`
+
+	// CacheHit is Cacheから結果を返したかどうか
+	CacheHit bool `json:"cacheHit"`
+
+	job    *bigquery.Job
+	labels map[string]string
+}
+
+// RunQuery is Dry Runで処理するByte数を見積もってから、Queryを実行して終わるまで待つ
+//
+// 見積もったByte数がMaxBytesProcessedを超える場合はForceでなければ実行せず、ErrExceededMaxBytesProcessedを返す
+// WithDryRunの場合は見積もりだけ行う
+func (s *Service) RunQuery(ctx context.Context, cfg *QueryConfig, ops ...APIOptions) (*QueryResult, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	labels := map[string]string{}
+	for k, v := range cfg.Labels {
+		if _, ok := DefaultQueryLabels[k]; ok {
+			return nil, fmt.Errorf("label %s is reserved to identify gcptoolbox jobs", k)
+		}
+		labels[k] = v
+	}
+	for k, v := range DefaultQueryLabels {
+		labels[k] = v
+	}
+	newQuery := func() *bigquery.Query {
+		q := s.bq.Query(cfg.SQL)
+		q.Location = cfg.Location
+		q.Labels = labels
+		return q
+	}
+
+	q := newQuery()
+	q.DryRun = true
+	dryRunJob, err := q.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed dry run : %w", err)
+	}
+	result := &QueryResult{
+		ProjectID: s.bq.Project(),
+		Location:  dryRunJob.Location(),
+		labels:    labels,
+	}
+	if status := dryRunJob.LastStatus(); status != nil && status.Statistics != nil {
+		result.EstimatedBytesProcessed = status.Statistics.TotalBytesProcessed
+	}
+	result.EstimatedOnDemandCost = OnDemandCost(result.EstimatedBytesProcessed, OnDemandPricePerTiB)
+
+	maxBytes := cfg.MaxBytesProcessed
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytesProcessed
+	}
+	if result.EstimatedBytesProcessed > maxBytes && !cfg.Force {
+		return result, fmt.Errorf("estimated %d bytes, max %d bytes : %w", result.EstimatedBytesProcessed, maxBytes, ErrExceededMaxBytesProcessed)
+	}
+	if opt.dryRun {
+		return result, nil
+	}
+
+	q = newQuery()
+	if result.Location != "" {
+		q.Location = result.Location
+	}
+	if !cfg.Force {
+		// Dry Runの見積もりと実行時の処理量が異なる場合に備えて、実行するQueryにも上限を設定する
+		q.MaxBytesBilled = maxBytes
+	}
+	job, err := q.Run(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed run query : %w", err)
+	}
+	result.JobID = job.ID()
+	result.job = job
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed wait query job %s : %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		return result, fmt.Errorf("failed query job %s : %w", job.ID(), err)
+	}
+	if stats := status.Statistics; stats != nil {
+		if qs, ok := stats.Details.(*bigquery.QueryStatistics); ok {
+			result.TotalBytesBilled = qs.TotalBytesBilled
+			result.CacheHit = qs.CacheHit
+		}
+	}
+	return result, nil
+}
+
+// WriteQueryResult is 実行したQueryの結果をCSVもしくは1行に1つのJSONでwに書き込み、書き込んだ行数を返す
+//
+// CSVの場合、RECORDとREPEATEDのColumnはJSONの文字列にする
+// Parquetは書き込めないので、ExtractQueryResultを使う
+func (s *Service) WriteQueryResult(ctx context.Context, w io.Writer, result *QueryResult, format OutputFormat) (int64, error) {
+	if result.job == nil {
+		return 0, fmt.Errorf("query has not been run")
+	}
+	if format == OutputFormatParquet {
+		return 0, fmt.Errorf("%s can only be written to Cloud Storage", format)
+	}
+	it, err := result.job.Read(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed read query result %s : %w", result.JobID, err)
+	}
+
+	var cw *csv.Writer
+	var enc *json.Encoder
+	if format == OutputFormatCSV {
+		cw = csv.NewWriter(w)
+	} else {
+		enc = json.NewEncoder(w)
+	}
+	var count int64
+	for {
+		var row []bigquery.Value
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed read query result %s : %w", result.JobID, err)
+		}
+		if cw != nil {
+			if count == 0 {
+				if err := cw.Write(csvHeader(it.Schema)); err != nil {
+					return count, err
+				}
+			}
+			record, err := CSVRecord(it.Schema, row)
+			if err != nil {
+				return count, err
+			}
+			if err := cw.Write(record); err != nil {
+				return count, err
+			}
+		} else {
+			if err := enc.Encode(JSONRecord(it.Schema, row)); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+	if cw != nil {
+		if count == 0 {
+			// 結果が0行でもHeaderは書く
+			if err := cw.Write(csvHeader(it.Schema)); err != nil {
+				return count, err
+			}
+		}
+		cw.Flush()
+		return count, cw.Error()
+	}
+	return count, nil
+}
+
+// ExtractQueryResult is 実行したQueryの結果をExtract JobでCloud Storageに書き出す
+//
+// Queryと同じLabelをExtract Jobにも付ける
+// 結果が1GBを超える場合は、uriに * を含めて複数のFileに分ける必要がある
+func (s *Service) ExtractQueryResult(ctx context.Context, result *QueryResult, uri string, format OutputFormat) error {
+	if result.job == nil {
+		return fmt.Errorf("query has not been run")
+	}
+	cfg, err := result.job.Config()
+	if err != nil {
+		return fmt.Errorf("failed get job config %s : %w", result.JobID, err)
+	}
+	qc, ok := cfg.(*bigquery.QueryConfig)
+	if !ok || qc.Dst == nil {
+		return fmt.Errorf("destination table not found. job=%s", result.JobID)
+	}
+
+	ref := bigquery.NewGCSReference(uri)
+	ref.DestinationFormat = format.dataFormat()
+	extractor := s.bq.DatasetInProject(qc.Dst.ProjectID, qc.Dst.DatasetID).Table(qc.Dst.TableID).ExtractorTo(ref)
+	extractor.Location = result.Location
+	extractor.Labels = result.labels
+	job, err := extractor.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("failed run extract job : %w", err)
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("failed wait extract job %s : %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		return fmt.Errorf("failed extract job %s : %w", job.ID(), err)
+	}
+	return nil
+}
+
+func csvHeader(schema bigquery.Schema) []string {
+	header := make([]string, len(schema))
+	for i, f := range schema {
+		header[i] = f.Name
+	}
+	return header
+}
+
+// CSVRecord is Queryの結果の1行をCSVの1行にする. NULLは空文字列、RECORDとREPEATEDはJSONの文字列にする
+func CSVRecord(schema bigquery.Schema, row []bigquery.Value) ([]string, error) {
+	record := make([]string, len(row))
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		ev := exportValue(schema[i], v)
+		if schema[i].Repeated || schema[i].Type == bigquery.RecordFieldType || schema[i].Type == bigquery.RangeFieldType {
+			b, err := json.Marshal(ev)
+			if err != nil {
+				return nil, fmt.Errorf("failed marshal %s : %w", schema[i].Name, err)
+			}
+			record[i] = string(b)
+			continue
+		}
+		switch ev := ev.(type) {
+		case string:
+			record[i] = ev
+		case float64:
+			record[i] = strconv.FormatFloat(ev, 'g', -1, 64)
+		default:
+			record[i] = fmt.Sprint(ev)
+		}
+	}
+	return record, nil
+}
+
+// JSONRecord is Queryの結果の1行をColumn名をkeyにしたmapにする
+//
+// TIMESTAMPはRFC3339、NUMERICとBIGNUMERICは文字列、BYTESはBase64の文字列にする
+func JSONRecord(schema bigquery.Schema, row []bigquery.Value) map[string]any {
+	m := make(map[string]any, len(row))
+	for i, v := range row {
+		if v == nil {
+			m[schema[i].Name] = nil
+			continue
+		}
+		m[schema[i].Name] = exportValue(schema[i], v)
+	}
+	return m
+}
+
+// exportValue is bigquery.ValueをBigQueryのExportと同じような文字列や数値にする
+//
+// RECORDはmap、REPEATEDはsliceにする
+func exportValue(f *bigquery.FieldSchema, v bigquery.Value) any {
+	if v == nil {
+		return nil
+	}
+	if f.Repeated {
+		vs, ok := v.([]bigquery.Value)
+		if !ok {
+			return v
+		}
+		single := *f
+		single.Repeated = false
+		l := make([]any, len(vs))
+		for i, e := range vs {
+			l[i] = exportValue(&single, e)
+		}
+		return l
+	}
+	switch v := v.(type) {
+	case []bigquery.Value:
+		// RECORD
+		if len(v) != len(f.Schema) {
+			return v
+		}
+		return JSONRecord(f.Schema, v)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case civil.Date:
+		return v.String()
+	case civil.Time:
+		return bigquery.CivilTimeString(v)
+	case civil.DateTime:
+		return bigquery.CivilDateTimeString(v)
+	case *big.Rat:
+		if f.Type == bigquery.BigNumericFieldType {
+			return bigquery.BigNumericString(v)
+		}
+		return bigquery.NumericString(v)
+	case *bigquery.IntervalValue:
+		return bigquery.IntervalString(v)
+	case *bigquery.RangeValue:
+		element := &bigquery.FieldSchema{Name: f.Name}
+		if f.RangeElementType != nil {
+			element.Type = f.RangeElementType.Type
+		}
+		return map[string]any{
+			"start": exportValue(element, v.Start),
+			"end":   exportValue(element, v.End),
+		}
+	case float64:
+		// JSONでは表せないので文字列にする
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		}
+		return v
+	}
+	return v
+}
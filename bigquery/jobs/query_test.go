@@ -0,0 +1,97 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	cases := []struct {
+		v    string
+		want jobs.OutputFormat
+	}{
+		{"csv", jobs.OutputFormatCSV},
+		{"json", jobs.OutputFormatNDJSON},
+		{"NDJSON", jobs.OutputFormatNDJSON},
+		{"parquet", jobs.OutputFormatParquet},
+	}
+	for _, tt := range cases {
+		got, err := jobs.ParseOutputFormat(tt.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s : want %s but got %s", tt.v, tt.want, got)
+		}
+	}
+	if _, err := jobs.ParseOutputFormat("avro"); err == nil {
+		t.Error("want error")
+	}
+}
+
+var queryResultSchema = bigquery.Schema{
+	{Name: "id", Type: bigquery.IntegerFieldType},
+	{Name: "name", Type: bigquery.StringFieldType},
+	{Name: "created_at", Type: bigquery.TimestampFieldType},
+	{Name: "date", Type: bigquery.DateFieldType},
+	{Name: "amount", Type: bigquery.NumericFieldType},
+	{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "device", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "os", Type: bigquery.StringFieldType},
+		{Name: "payload", Type: bigquery.BytesFieldType},
+	}},
+}
+
+var queryResultRow = []bigquery.Value{
+	int64(1),
+	nil,
+	time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	civil.Date{Year: 2024, Month: 1, Day: 2},
+	big.NewRat(3, 2),
+	[]bigquery.Value{"a", "b"},
+	[]bigquery.Value{"ios", []byte("hoge")},
+}
+
+func TestCSVRecord(t *testing.T) {
+	got, err := jobs.CSVRecord(queryResultSchema, queryResultRow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1", "", "2024-01-02T03:04:05Z", "2024-01-02", "1.500000000", `["a","b"]`, `{"os":"ios","payload":"aG9nZQ=="}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q but got %q", want, got)
+	}
+}
+
+func TestJSONRecord(t *testing.T) {
+	b, err := json.Marshal(jobs.JSONRecord(queryResultSchema, queryResultRow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"amount":"1.500000000","created_at":"2024-01-02T03:04:05Z","date":"2024-01-02","device":{"os":"ios","payload":"aG9nZQ=="},"id":1,"name":null,"tags":["a","b"]}`
+	if string(b) != want {
+		t.Errorf("want %s but got %s", want, b)
+	}
+}
+
+func TestRunQueryReservedLabel(t *testing.T) {
+	ctx := context.Background()
+	s, err := jobs.NewService(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// gcptoolboxのJobであることを示すLabelは上書きできない
+	_, err = s.RunQuery(ctx, &jobs.QueryConfig{SQL: "SELECT 1", Labels: map[string]string{"created-by": "hoge"}})
+	if err == nil {
+		t.Errorf("want error but got nil")
+	}
+}
@@ -0,0 +1,405 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// DefaultPartitionScanRatio is Partitioningの列で絞り込んだQueryが、Partitioning後に読むと仮定するTableの割合
+	DefaultPartitionScanRatio = 0.1
+
+	// DefaultClusterScanRatio is Clusteringの列で絞り込んだQueryが、Clustering後に読むと仮定する割合
+	DefaultClusterScanRatio = 0.5
+
+	// maxClusteringFields is Clusteringに指定できる列の最大数
+	maxClusteringFields = 4
+)
+
+// ColumnUsage is TableのColumnがQueryで使われた回数
+type ColumnUsage struct {
+	Column string `json:"column"`
+	Type   string `json:"type"`
+
+	// FilterCount is WHEREで使われたQueryの数
+	FilterCount int `json:"filterCount"`
+
+	// JoinCount is JOINのON, USINGで使われたQueryの数
+	JoinCount int `json:"joinCount"`
+
+	// FilteredBytesBilled is WHEREで使われたQueryの、このTableに割り当てた課金対象のByte数の合計
+	FilteredBytesBilled int64 `json:"filteredBytesBilled"`
+}
+
+// QueryColumnUsage is 1つのQueryで、対象のTableのColumnが使われた箇所
+type QueryColumnUsage struct {
+	JobID string `json:"jobID"`
+
+	// BytesBilled is Queryの課金対象のByte数のうち、このTableに割り当てたByte数
+	BytesBilled int64 `json:"bytesBilled"`
+
+	FilterColumns []string `json:"filterColumns,omitempty"`
+	JoinColumns   []string `json:"joinColumns,omitempty"`
+}
+
+// TableRecommendation is TableのPartitioningとClusteringの推奨
+type TableRecommendation struct {
+	ProjectID string `json:"projectID"`
+	DatasetID string `json:"datasetID"`
+	TableID   string `json:"tableID"`
+	NumBytes  int64  `json:"numBytes"`
+
+	// QueryCount is 期間中にTableを参照したQueryの数
+	QueryCount int `json:"queryCount"`
+
+	// BytesBilled is 期間中にTableを参照したQueryの課金対象のByte数のうち、このTableに割り当てたByte数
+	BytesBilled int64 `json:"bytesBilled"`
+
+	// CurrentPartitioningField is 今のPartitioningの列. Ingestion Time Partitioningの場合は _PARTITIONTIME
+	CurrentPartitioningField string   `json:"currentPartitioningField,omitempty"`
+	CurrentClusteringFields  []string `json:"currentClusteringFields,omitempty"`
+
+	// PartitioningField is 推奨するPartitioningの列. 推奨が無い場合は空
+	PartitioningField string `json:"partitioningField,omitempty"`
+
+	// PartitioningType is 推奨するPartitioningの単位
+	PartitioningType string `json:"partitioningType,omitempty"`
+
+	// ClusteringFields is 推奨するClusteringの列. 推奨が無い場合は空
+	ClusteringFields []string `json:"clusteringFields,omitempty"`
+
+	// EstimatedSavedBytes is 推奨を適用していた場合に減っていたと見積もった課金対象のByte数
+	EstimatedSavedBytes int64 `json:"estimatedSavedBytes"`
+
+	// EstimatedSavedCost is EstimatedSavedBytesをOn-demandの料金で計算した料金(USD)
+	EstimatedSavedCost float64 `json:"estimatedSavedCost"`
+
+	Columns []*ColumnUsage `json:"columns"`
+}
+
+// RecommendConfig is RecommendPartitioningの設定
+type RecommendConfig struct {
+	// Location is 対象のJobが実行されたRegion. eg. US, asia-northeast1
+	Location string
+
+	// Start is 対象のJobが作成された時間の開始. この時間を含む
+	Start time.Time
+
+	// End is 対象のJobが作成された時間の終了. この時間を含まない
+	End time.Time
+
+	// DatasetID is 対象のTableのDataset. 空の場合は全てのDataset
+	DatasetID string
+
+	// TablePrefix is 対象のTableのPrefix
+	TablePrefix string
+
+	// MinQueries is Tableを参照したQueryがこれより少ない場合は推奨しない
+	MinQueries int
+
+	// PartitionScanRatio is Partitioningの列で絞り込んだQueryが読むと仮定する割合. 0の場合はDefaultPartitionScanRatio
+	PartitionScanRatio float64
+
+	// ClusterScanRatio is Clusteringの列で絞り込んだQueryが読むと仮定する割合. 0の場合はDefaultClusterScanRatio
+	ClusterScanRatio float64
+
+	// PricePerTiB is On-demandのQueryの1TiBあたりの料金(USD). 0の場合はOnDemandPricePerTiB
+	PricePerTiB float64
+}
+
+type recommendJobRow struct {
+	JobID            string `bigquery:"job_id"`
+	Query            string `bigquery:"query"`
+	TotalBytesBilled int64  `bigquery:"total_bytes_billed"`
+	ReferencedTables []*struct {
+		ProjectID string `bigquery:"project_id"`
+		DatasetID string `bigquery:"dataset_id"`
+		TableID   string `bigquery:"table_id"`
+	} `bigquery:"referenced_tables"`
+}
+
+// RecommendPartitioning is INFORMATION_SCHEMA.JOBSから対象のTableを参照したQueryを集め、
+// WHEREとJOINで使われているColumnからPartitioningとClusteringの列を推奨し、減らせたByte数の多い順に返す
+//
+// 複数のTableを参照したQueryの課金対象のByte数は、参照したTableで等分する
+// Columnの判定はSQLの文字列から行うので、参照した他のTableに同じ名前のColumnがあるとそれも数える
+// 減らせたByte数はPartitionScanRatioとClusterScanRatioを使った見積もり
+func (s *Service) RecommendPartitioning(ctx context.Context, projectID string, cfg *RecommendConfig) ([]*TableRecommendation, error) {
+	sql := fmt.Sprintf("SELECT job_id, query, IFNULL(total_bytes_billed, 0) AS total_bytes_billed,\n"+
+		"  ARRAY(SELECT AS STRUCT t.project_id, t.dataset_id, t.table_id FROM UNNEST(referenced_tables) AS t) AS referenced_tables\n"+
+		"FROM `%s`.`%s`.INFORMATION_SCHEMA.JOBS\n"+
+		"WHERE creation_time >= @start AND creation_time < @end\n"+
+		"  AND job_type = 'QUERY'\n"+
+		"  AND state = 'DONE'\n"+
+		"  AND error_result IS NULL\n"+
+		"  AND IFNULL(statement_type, '') != 'SCRIPT'\n"+
+		"  AND EXISTS(SELECT 1 FROM UNNEST(referenced_tables) AS t\n"+
+		"    WHERE t.project_id = @project AND (@dataset = '' OR t.dataset_id = @dataset) AND STARTS_WITH(t.table_id, @prefix))",
+		projectID, tables.RegionQualifier(cfg.Location))
+	q := s.bq.Query(sql)
+	q.Location = cfg.Location
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "start", Value: cfg.Start},
+		{Name: "end", Value: cfg.End},
+		{Name: "project", Value: projectID},
+		{Name: "dataset", Value: cfg.DatasetID},
+		{Name: "prefix", Value: cfg.TablePrefix},
+	}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed query jobs : %w", err)
+	}
+
+	type target struct {
+		datasetID string
+		tableID   string
+		meta      *bigquery.TableMetadata
+		columns   []string
+		usages    []*QueryColumnUsage
+	}
+	targets := map[string]*target{}
+	var keys []string
+	for {
+		var row recommendJobRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(row.ReferencedTables) == 0 {
+			continue
+		}
+		bytesBilled := row.TotalBytesBilled / int64(len(row.ReferencedTables))
+		for _, ref := range row.ReferencedTables {
+			if ref.ProjectID != projectID || (cfg.DatasetID != "" && ref.DatasetID != cfg.DatasetID) || !strings.HasPrefix(ref.TableID, cfg.TablePrefix) {
+				continue
+			}
+			key := fmt.Sprintf("%s.%s", ref.DatasetID, ref.TableID)
+			t, ok := targets[key]
+			if !ok {
+				meta, err := s.bq.DatasetInProject(projectID, ref.DatasetID).Table(ref.TableID).Metadata(ctx)
+				if isNotFound(err) {
+					// 削除されたTableは推奨しない
+					targets[key] = nil
+					continue
+				} else if err != nil {
+					return nil, fmt.Errorf("failed get metadata %s.%s.%s : %w", projectID, ref.DatasetID, ref.TableID, err)
+				}
+				t = &target{datasetID: ref.DatasetID, tableID: ref.TableID, meta: meta}
+				for _, f := range meta.Schema {
+					t.columns = append(t.columns, f.Name)
+				}
+				targets[key] = t
+				keys = append(keys, key)
+			}
+			if t == nil {
+				continue
+			}
+			filters, joins := PredicateColumns(row.Query, t.columns)
+			t.usages = append(t.usages, &QueryColumnUsage{
+				JobID:         row.JobID,
+				BytesBilled:   bytesBilled,
+				FilterColumns: filters,
+				JoinColumns:   joins,
+			})
+		}
+	}
+
+	var results []*TableRecommendation
+	for _, key := range keys {
+		t := targets[key]
+		if len(t.usages) < cfg.MinQueries {
+			continue
+		}
+		r := RecommendTable(t.meta, t.usages, cfg)
+		r.ProjectID = projectID
+		r.DatasetID = t.datasetID
+		r.TableID = t.tableID
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].EstimatedSavedBytes > results[j].EstimatedSavedBytes
+	})
+	return results, nil
+}
+
+// RecommendTable is Tableを参照したQueryで使われたColumnから、PartitioningとClusteringの列を推奨する
+//
+// Partitioningは最もWHEREで使われたDATE, TIMESTAMP, DATETIMEの列を推奨する. 既にPartitioningされている場合は推奨しない
+// Clusteringは WHEREとJOINで使われた回数の多い順に最大4列を推奨する. 今のClusteringと同じ場合は推奨しない
+func RecommendTable(meta *bigquery.TableMetadata, usages []*QueryColumnUsage, cfg *RecommendConfig) *TableRecommendation {
+	partitionScanRatio := cfg.PartitionScanRatio
+	if partitionScanRatio <= 0 {
+		partitionScanRatio = DefaultPartitionScanRatio
+	}
+	clusterScanRatio := cfg.ClusterScanRatio
+	if clusterScanRatio <= 0 {
+		clusterScanRatio = DefaultClusterScanRatio
+	}
+	price := cfg.PricePerTiB
+	if price == 0 {
+		price = OnDemandPricePerTiB
+	}
+
+	r := &TableRecommendation{
+		NumBytes:   meta.NumBytes,
+		QueryCount: len(usages),
+	}
+	partitioned := false
+	if meta.TimePartitioning != nil {
+		partitioned = true
+		r.CurrentPartitioningField = meta.TimePartitioning.Field
+		if r.CurrentPartitioningField == "" {
+			r.CurrentPartitioningField = "_PARTITIONTIME"
+		}
+	} else if meta.RangePartitioning != nil {
+		partitioned = true
+		r.CurrentPartitioningField = meta.RangePartitioning.Field
+	}
+	if meta.Clustering != nil {
+		r.CurrentClusteringFields = meta.Clustering.Fields
+	}
+
+	fields := map[string]*bigquery.FieldSchema{}
+	columns := map[string]*ColumnUsage{}
+	for _, f := range meta.Schema {
+		fields[f.Name] = f
+	}
+	column := func(name string) *ColumnUsage {
+		c, ok := columns[name]
+		if !ok {
+			c = &ColumnUsage{Column: name}
+			if f, ok := fields[name]; ok {
+				c.Type = string(f.Type)
+			}
+			columns[name] = c
+		}
+		return c
+	}
+	for _, u := range usages {
+		r.BytesBilled += u.BytesBilled
+		for _, name := range u.FilterColumns {
+			c := column(name)
+			c.FilterCount++
+			c.FilteredBytesBilled += u.BytesBilled
+		}
+		for _, name := range u.JoinColumns {
+			column(name).JoinCount++
+		}
+	}
+	for _, c := range columns {
+		r.Columns = append(r.Columns, c)
+	}
+	sort.Slice(r.Columns, func(i, j int) bool {
+		a, b := r.Columns[i], r.Columns[j]
+		if a.FilterCount+a.JoinCount != b.FilterCount+b.JoinCount {
+			return a.FilterCount+a.JoinCount > b.FilterCount+b.JoinCount
+		}
+		if a.FilteredBytesBilled != b.FilteredBytesBilled {
+			return a.FilteredBytesBilled > b.FilteredBytesBilled
+		}
+		return a.Column < b.Column
+	})
+
+	if !partitioned {
+		var best *ColumnUsage
+		for _, c := range r.Columns {
+			if c.FilterCount == 0 || !partitionable(fields[c.Column]) {
+				continue
+			}
+			if best == nil || c.FilterCount > best.FilterCount ||
+				(c.FilterCount == best.FilterCount && c.FilteredBytesBilled > best.FilteredBytesBilled) {
+				best = c
+			}
+		}
+		if best != nil {
+			r.PartitioningField = best.Column
+			r.PartitioningType = string(bigquery.DayPartitioningType)
+		}
+	}
+
+	var clustering []string
+	for _, c := range r.Columns {
+		if len(clustering) >= maxClusteringFields {
+			break
+		}
+		if c.Column == r.PartitioningField || c.Column == r.CurrentPartitioningField || !clusterable(fields[c.Column]) {
+			continue
+		}
+		clustering = append(clustering, c.Column)
+	}
+	if len(clustering) > 0 && !slices.Equal(clustering, r.CurrentClusteringFields) {
+		r.ClusteringFields = clustering
+	}
+
+	clusterColumns := map[string]bool{}
+	for _, v := range r.ClusteringFields {
+		clusterColumns[v] = true
+	}
+	for _, u := range usages {
+		remaining := float64(u.BytesBilled)
+		var partitionFiltered, clusterFiltered bool
+		for _, name := range u.FilterColumns {
+			if r.PartitioningField != "" && name == r.PartitioningField {
+				partitionFiltered = true
+			}
+			if clusterColumns[name] {
+				clusterFiltered = true
+			}
+		}
+		if partitionFiltered {
+			remaining *= partitionScanRatio
+		}
+		if clusterFiltered {
+			remaining *= clusterScanRatio
+		}
+		r.EstimatedSavedBytes += u.BytesBilled - int64(remaining)
+	}
+	r.EstimatedSavedCost = OnDemandCost(r.EstimatedSavedBytes, price)
+	return r
+}
+
+// partitionable is Time-unit column Partitioningに使える列かどうか
+func partitionable(f *bigquery.FieldSchema) bool {
+	if f == nil || f.Repeated {
+		return false
+	}
+	switch f.Type {
+	case bigquery.DateFieldType, bigquery.TimestampFieldType, bigquery.DateTimeFieldType:
+		return true
+	}
+	return false
+}
+
+// clusterable is Clusteringに使える列かどうか
+func clusterable(f *bigquery.FieldSchema) bool {
+	if f == nil || f.Repeated {
+		return false
+	}
+	switch f.Type {
+	case bigquery.StringFieldType, bigquery.IntegerFieldType, bigquery.NumericFieldType, bigquery.BigNumericFieldType,
+		bigquery.BooleanFieldType, bigquery.DateFieldType, bigquery.DateTimeFieldType, bigquery.TimestampFieldType,
+		bigquery.GeographyFieldType:
+		return true
+	}
+	return false
+}
+
+// isNotFound is errがBigQuery APIの404かどうか
+func isNotFound(err error) bool {
+	var gapiErr *googleapi.Error
+	return errors.As(err, &gapiErr) && gapiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,70 @@
+package jobs_test
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+)
+
+func TestRecommendTable(t *testing.T) {
+	meta := &bigquery.TableMetadata{
+		NumBytes: 100 * jobs.TiB,
+		Schema: bigquery.Schema{
+			{Name: "event_date", Type: bigquery.DateFieldType},
+			{Name: "user_id", Type: bigquery.StringFieldType},
+			{Name: "country", Type: bigquery.StringFieldType},
+			{Name: "score", Type: bigquery.FloatFieldType},
+		},
+	}
+	usages := []*jobs.QueryColumnUsage{
+		{JobID: "a", BytesBilled: 1000, FilterColumns: []string{"event_date", "country"}},
+		{JobID: "b", BytesBilled: 1000, FilterColumns: []string{"event_date", "score"}, JoinColumns: []string{"user_id"}},
+		{JobID: "c", BytesBilled: 1000, FilterColumns: []string{"country"}},
+		{JobID: "d", BytesBilled: 1000},
+	}
+
+	got := jobs.RecommendTable(meta, usages, &jobs.RecommendConfig{})
+	if got.PartitioningField != "event_date" {
+		t.Errorf("partitioning field want event_date but got %s", got.PartitioningField)
+	}
+	if got.PartitioningType != "DAY" {
+		t.Errorf("partitioning type want DAY but got %s", got.PartitioningType)
+	}
+	if want := []string{"country", "user_id"}; !reflect.DeepEqual(got.ClusteringFields, want) {
+		t.Errorf("clustering fields want %v but got %v", want, got.ClusteringFields)
+	}
+	if got.QueryCount != 4 || got.BytesBilled != 4000 {
+		t.Errorf("want 4 queries 4000 bytes but got %d queries %d bytes", got.QueryCount, got.BytesBilled)
+	}
+	// a: 1000 * 0.1 * 0.5 = 50, b: 1000 * 0.1 = 100, c: 1000 * 0.5 = 500, d: 1000
+	if want := int64(950 + 900 + 500); got.EstimatedSavedBytes != want {
+		t.Errorf("estimated saved bytes want %d but got %d", want, got.EstimatedSavedBytes)
+	}
+}
+
+func TestRecommendTable_AlreadyApplied(t *testing.T) {
+	meta := &bigquery.TableMetadata{
+		Schema: bigquery.Schema{
+			{Name: "event_date", Type: bigquery.DateFieldType},
+			{Name: "country", Type: bigquery.StringFieldType},
+		},
+		TimePartitioning: &bigquery.TimePartitioning{Field: "event_date"},
+		Clustering:       &bigquery.Clustering{Fields: []string{"country"}},
+	}
+	usages := []*jobs.QueryColumnUsage{
+		{JobID: "a", BytesBilled: 1000, FilterColumns: []string{"event_date", "country"}},
+	}
+
+	got := jobs.RecommendTable(meta, usages, &jobs.RecommendConfig{})
+	if got.PartitioningField != "" || got.ClusteringFields != nil {
+		t.Errorf("want no recommendation but got partitioning=%s clustering=%v", got.PartitioningField, got.ClusteringFields)
+	}
+	if got.EstimatedSavedBytes != 0 {
+		t.Errorf("want 0 saved bytes but got %d", got.EstimatedSavedBytes)
+	}
+	if got.CurrentPartitioningField != "event_date" {
+		t.Errorf("current partitioning field want event_date but got %s", got.CurrentPartitioningField)
+	}
+}
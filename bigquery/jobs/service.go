@@ -0,0 +1,17 @@
+package jobs
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigquery"
+)
+
+type Service struct {
+	bq *bigquery.Client
+}
+
+func NewService(ctx context.Context, bq *bigquery.Client) (*Service, error) {
+	return &Service{
+		bq: bq,
+	}, nil
+}
@@ -0,0 +1,300 @@
+package jobs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultPollInterval is WatchJobsでJobの状態を確認する間隔のデフォルト
+const DefaultPollInterval = 10 * time.Second
+
+// JobRef is Jobを特定するための情報
+type JobRef struct {
+	ProjectID string `json:"projectID"`
+	Location  string `json:"location"`
+	JobID     string `json:"jobID"`
+}
+
+// String is project:location.jobID 形式の文字列を返す
+func (r *JobRef) String() string {
+	return fmt.Sprintf("%s:%s.%s", r.ProjectID, r.Location, r.JobID)
+}
+
+// ParseJobRef is jobID もしくは bq commandの project:location.jobID 形式の文字列からJobRefを作る
+//
+// 省略されている場合はdefaultProjectID, defaultLocationを使う
+func ParseJobRef(v string, defaultProjectID string, defaultLocation string) *JobRef {
+	ref := &JobRef{ProjectID: defaultProjectID, Location: defaultLocation, JobID: v}
+	project, rest, ok := strings.Cut(v, ":")
+	if !ok {
+		return ref
+	}
+	ref.ProjectID = project
+	ref.JobID = rest
+	if location, jobID, ok := strings.Cut(rest, "."); ok {
+		ref.Location = location
+		ref.JobID = jobID
+	}
+	return ref
+}
+
+var (
+	exportJobPattern  = regexp.MustCompile(`job:(\S+)`)
+	workingJobPattern = regexp.MustCompile(`^working (\S+)`)
+
+	// jobIDPattern is jobID もしくは project:location.jobID
+	jobIDPattern = regexp.MustCompile(`^(?:[\w.-]+:)?(?:[\w-]+\.)?[\w-]+$`)
+)
+
+// ParseJobIDs is JobIDの一覧を読み込む
+//
+// 以下の形式に対応している. 重複したJobIDは1つにする
+//   - 1行に1つのJobID
+//   - bq2gcsのCLIが出力する working <jobID>
+//   - bq2gcsのEventのText出力、JSON Lines出力、HandlerのResponseのJSON. Actionが export job:<jobID> のもの
+func ParseJobIDs(data []byte) ([]string, error) {
+	var ids []string
+	exists := map[string]bool{}
+	add := func(id string) {
+		if id == "" || exists[id] {
+			return
+		}
+		exists[id] = true
+		ids = append(ids, id)
+	}
+
+	type event struct {
+		Action string `json:"action"`
+	}
+	var resp struct {
+		Events []*event `json:"events"`
+	}
+	if err := json.Unmarshal(data, &resp); err == nil && len(resp.Events) > 0 {
+		for _, e := range resp.Events {
+			add(jobIDFromText(e.Action))
+		}
+		return ids, nil
+	}
+
+	// bq2gcsの出力にはJobID以外の行も含まれるので、JobIDだけの行はbq2gcsの出力でない場合だけ使う
+	var bare []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var e event
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				return nil, fmt.Errorf("invalid json line %s : %w", line, err)
+			}
+			add(jobIDFromText(e.Action))
+			continue
+		}
+		if m := workingJobPattern.FindStringSubmatch(line); m != nil {
+			add(m[1])
+			continue
+		}
+		if m := exportJobPattern.FindStringSubmatch(line); m != nil {
+			add(m[1])
+			continue
+		}
+		if jobIDPattern.MatchString(line) {
+			bare = append(bare, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		return ids, nil
+	}
+	for _, v := range bare {
+		add(v)
+	}
+	return ids, nil
+}
+
+func jobIDFromText(v string) string {
+	if m := exportJobPattern.FindStringSubmatch(v); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// WatchedJob is WatchJobsで確認したJobの状態
+type WatchedJob struct {
+	Ref *JobRef `json:"ref"`
+
+	// JobType is QUERY, LOAD, EXTRACT, COPY
+	JobType string `json:"jobType,omitempty"`
+
+	// State is PENDING, RUNNING, DONE
+	State        string    `json:"state"`
+	CreationTime time.Time `json:"creationTime,omitempty"`
+	StartTime    time.Time `json:"startTime,omitempty"`
+	EndTime      time.Time `json:"endTime,omitempty"`
+
+	// ErrorReason is 失敗した場合の理由. eg. notFound, invalid
+	ErrorReason string `json:"errorReason,omitempty"`
+
+	// Error is 失敗した場合のError Message. Jobの取得に失敗した場合もここに入る
+	Error string `json:"error,omitempty"`
+
+	// DestinationURIFileCounts is Extract Jobが出力したFileの数. Destination URIの順番
+	DestinationURIFileCounts []int64 `json:"destinationURIFileCounts,omitempty"`
+}
+
+// Done is Jobが終わっているかどうか
+func (j *WatchedJob) Done() bool {
+	return j.State == "DONE"
+}
+
+// Failed is Jobが失敗したかどうか
+func (j *WatchedJob) Failed() bool {
+	return j.Done() && j.Error != ""
+}
+
+// WatchConfig is WatchJobsの設定
+type WatchConfig struct {
+	// PollInterval is Jobの状態を確認する間隔. 0の場合はDefaultPollInterval
+	PollInterval time.Duration
+
+	// Concurrency is 並列にJobの状態を確認する数. 0の場合は1
+	Concurrency int
+}
+
+// WatchJobs is 全てのJobが終わるまでJobの状態を確認し続け、最後の状態を返す
+//
+// 状態を確認するたびに、全てのJobの状態をrefsの順番でfnに渡す
+// Jobが見つからないか権限が無くて取得できない場合は、そのJobは失敗として扱い確認を止める
+// それ以外の理由でJobの取得に失敗した場合は、前回の状態のまま次の確認でやり直す
+func (s *Service) WatchJobs(ctx context.Context, refs []*JobRef, cfg *WatchConfig, fn func(jobs []*WatchedJob)) ([]*WatchedJob, error) {
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]*WatchedJob, len(refs))
+	for i, ref := range refs {
+		results[i] = &WatchedJob{Ref: ref, State: "UNKNOWN"}
+	}
+	for {
+		indexes := make(chan int)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range indexes {
+					results[index] = s.watchedJob(ctx, results[index])
+				}
+			}()
+		}
+		for i, v := range results {
+			if v.Done() {
+				continue
+			}
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+
+		if fn != nil {
+			fn(results)
+		}
+		done := true
+		for _, v := range results {
+			if !v.Done() {
+				done = false
+				break
+			}
+		}
+		if done {
+			return results, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return results, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// watchedJob is Jobの最新の状態を取得する. 一時的なerrorで取得できなかった場合はprevの状態を返す
+func (s *Service) watchedJob(ctx context.Context, prev *WatchedJob) *WatchedJob {
+	ref := prev.Ref
+	v := &WatchedJob{Ref: ref}
+	job, err := s.bq.JobFromProject(ctx, ref.ProjectID, ref.JobID, ref.Location)
+	if err != nil {
+		if isNotFound(err) || isPermissionDenied(err) {
+			v.State = "DONE"
+			v.Error = fmt.Sprintf("failed get job : %s", err)
+			return v
+		}
+		// 一時的なerrorかもしれないので、Jobの状態は変えずに次の確認でやり直す
+		c := *prev
+		c.Error = fmt.Sprintf("failed get job, retry next time : %s", err)
+		return &c
+	}
+	if cfg, err := job.Config(); err == nil {
+		v.JobType = jobType(cfg)
+	}
+	status := job.LastStatus()
+	if status == nil {
+		v.State = "UNKNOWN"
+		return v
+	}
+	v.State = jobState(status.State)
+	if stats := status.Statistics; stats != nil {
+		v.CreationTime = stats.CreationTime
+		v.StartTime = stats.StartTime
+		v.EndTime = stats.EndTime
+		if es, ok := stats.Details.(*bigquery.ExtractStatistics); ok {
+			v.DestinationURIFileCounts = es.DestinationURIFileCounts
+		}
+	}
+	if err := status.Err(); err != nil {
+		v.Error = err.Error()
+		var bqErr *bigquery.Error
+		if errors.As(err, &bqErr) {
+			v.ErrorReason = bqErr.Reason
+			v.Error = bqErr.Message
+		}
+	}
+	return v
+}
+
+// isPermissionDenied is errが権限が無い時のBigQuery APIの403かどうか
+//
+// Rate LimitやQuotaを超えた時も403になるが、時間を置けば成功するのでfalseを返す
+func isPermissionDenied(err error) bool {
+	var gapiErr *googleapi.Error
+	if !errors.As(err, &gapiErr) || gapiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, e := range gapiErr.Errors {
+		if e.Reason == "rateLimitExceeded" || e.Reason == "quotaExceeded" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package jobs_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+	"google.golang.org/api/option"
+)
+
+func TestParseJobIDs(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"job ids", "job_a\njob_b\n\njob_a\n", []string{"job_a", "job_b"}},
+		{"bq2gcs cli", "ProjectID=hoge\nworking job_a\nworking job_b\n\nDone\n", []string{"job_a", "job_b"}},
+		{"event text", "access_20240101 export job:job_a gs://bucket/{{TABLE_ID}}\naccess is skipped. not match\n", []string{"job_a"}},
+		{"event json lines", `{"type":"exported","action":"export job:job_a","resource":"t1"}` + "\n" + `{"type":"skipped","resource":"t2"}` + "\n", []string{"job_a"}},
+		{"handler response", "{\n  \"events\": [\n    {\"type\":\"exported\",\"action\":\"export job:job_a\"},\n    {\"type\":\"exported\",\"action\":\"export job:job_b\"}\n  ]\n}\n", []string{"job_a", "job_b"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jobs.ParseJobIDs([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("want %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseJobRef(t *testing.T) {
+	cases := []struct {
+		v    string
+		want jobs.JobRef
+	}{
+		{"job_a", jobs.JobRef{ProjectID: "hoge", Location: "US", JobID: "job_a"}},
+		{"fuga:job_a", jobs.JobRef{ProjectID: "fuga", Location: "US", JobID: "job_a"}},
+		{"fuga:asia-northeast1.job_a", jobs.JobRef{ProjectID: "fuga", Location: "asia-northeast1", JobID: "job_a"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.v, func(t *testing.T) {
+			if g, e := *jobs.ParseJobRef(tt.v, "hoge", "US"), tt.want; g != e {
+				t.Errorf("want %+v but got %+v", e, g)
+			}
+		})
+	}
+}
+
+// fakeJobServer is jobs.getだけを返すBigQuery APIのFake
+//
+// responsesにJobIDごとに返すHTTP Status Codeを順番に入れておく. 使い切った後はDONEのJobを返す
+type fakeJobServer struct {
+	mu        sync.Mutex
+	responses map[string][]int
+}
+
+func (f *fakeJobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	jobID := path.Base(r.URL.Path)
+	f.mu.Lock()
+	var status int
+	if l := f.responses[jobID]; len(l) > 0 {
+		status = l[0]
+		f.responses[jobID] = l[1:]
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if status != 0 && status != http.StatusOK {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error":{"code":%d,"message":"%s"}}`, status, http.StatusText(status))
+		return
+	}
+	fmt.Fprintf(w, `{"jobReference":{"projectId":"p","jobId":"%s","location":"US"},"configuration":{"query":{"query":"SELECT 1"}},"status":{"state":"DONE"}}`, jobID)
+}
+
+func TestWatchJobs(t *testing.T) {
+	ctx := context.Background()
+
+	f := &fakeJobServer{responses: map[string][]int{
+		"transient": {http.StatusBadRequest, http.StatusBadRequest},
+		"notfound":  {http.StatusNotFound},
+		"forbidden": {http.StatusForbidden},
+	}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	bq, err := bigquery.NewClient(ctx, "p", option.WithEndpoint(srv.URL), option.WithoutAuthentication(), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := bq.Close(); err != nil {
+			t.Logf("failed bq.Close %s", err)
+		}
+	}()
+	s, err := jobs.NewService(ctx, bq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs := []*jobs.JobRef{
+		{ProjectID: "p", Location: "US", JobID: "transient"},
+		{ProjectID: "p", Location: "US", JobID: "notfound"},
+		{ProjectID: "p", Location: "US", JobID: "forbidden"},
+	}
+	var polls int
+	got, err := s.WatchJobs(ctx, refs, &jobs.WatchConfig{PollInterval: time.Millisecond}, func(l []*jobs.WatchedJob) {
+		polls++
+		if polls <= 2 && (l[0].Done() || l[0].Error == "") {
+			t.Errorf("poll %d: transient error want not done with error but got state=%s error=%s", polls, l[0].State, l[0].Error)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 一時的なerrorは次の確認でやり直し、最後は成功する
+	if got[0].Failed() {
+		t.Errorf("transient want succeeded but got %s", got[0].Error)
+	}
+	if g, e := polls, 3; g != e {
+		t.Errorf("polls want %d but got %d", e, g)
+	}
+	for _, v := range got[1:] {
+		if !v.Failed() {
+			t.Errorf("%s want failed", v.Ref.JobID)
+		}
+	}
+}
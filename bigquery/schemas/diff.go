@@ -0,0 +1,127 @@
+package schemas
+
+import (
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// FieldDiffKind is Fieldの差分の種類
+type FieldDiffKind string
+
+const (
+	FieldAdded              FieldDiffKind = "added"
+	FieldRemoved            FieldDiffKind = "removed"
+	FieldTypeChanged        FieldDiffKind = "typeChanged"
+	FieldModeChanged        FieldDiffKind = "modeChanged"
+	FieldDescriptionChanged FieldDiffKind = "descriptionChanged"
+)
+
+// FieldDiff is 2つのSchemaの1つのFieldの差分
+type FieldDiff struct {
+	// Path is Fieldの名前. RECORDの中のFieldは parent.child で表す
+	Path string        `json:"path"`
+	Kind FieldDiffKind `json:"kind"`
+
+	// Before is 比較元の値. FieldAddedの場合は空
+	Before string `json:"before,omitempty"`
+
+	// After is 比較先の値. FieldRemovedの場合は空
+	After string `json:"after,omitempty"`
+}
+
+// Mode is FieldのModeを NULLABLE, REQUIRED, REPEATED のいずれかで返す
+func Mode(f *bigquery.FieldSchema) string {
+	switch {
+	case f.Repeated:
+		return "REPEATED"
+	case f.Required:
+		return "REQUIRED"
+	}
+	return "NULLABLE"
+}
+
+// Diff is beforeのSchemaからafterのSchemaへの差分を返す
+//
+// Fieldの名前は大文字小文字を区別せずに比較する. Fieldの順番の違いは差分としない
+func Diff(before bigquery.Schema, after bigquery.Schema) []*FieldDiff {
+	return diff(before, after, "")
+}
+
+func diff(before bigquery.Schema, after bigquery.Schema, parent string) []*FieldDiff {
+	afterFields := map[string]*bigquery.FieldSchema{}
+	for _, f := range after {
+		afterFields[strings.ToLower(f.Name)] = f
+	}
+
+	var diffs []*FieldDiff
+	beforeFields := map[string]bool{}
+	for _, b := range before {
+		key := strings.ToLower(b.Name)
+		beforeFields[key] = true
+		path := fieldPath(parent, b.Name)
+		a, ok := afterFields[key]
+		if !ok {
+			diffs = append(diffs, &FieldDiff{Path: path, Kind: FieldRemoved, Before: TypeSQL(b)})
+			continue
+		}
+		if b.Type != a.Type {
+			diffs = append(diffs, &FieldDiff{Path: path, Kind: FieldTypeChanged, Before: string(b.Type), After: string(a.Type)})
+		}
+		if Mode(b) != Mode(a) {
+			diffs = append(diffs, &FieldDiff{Path: path, Kind: FieldModeChanged, Before: Mode(b), After: Mode(a)})
+		}
+		if b.Description != a.Description {
+			diffs = append(diffs, &FieldDiff{Path: path, Kind: FieldDescriptionChanged, Before: b.Description, After: a.Description})
+		}
+		if b.Type == bigquery.RecordFieldType && a.Type == bigquery.RecordFieldType {
+			diffs = append(diffs, diff(b.Schema, a.Schema, path)...)
+		}
+	}
+	for _, a := range after {
+		if beforeFields[strings.ToLower(a.Name)] {
+			continue
+		}
+		diffs = append(diffs, &FieldDiff{Path: fieldPath(parent, a.Name), Kind: FieldAdded, After: TypeSQL(a)})
+	}
+	return diffs
+}
+
+// OrderChanged is beforeとafterの両方に存在するFieldの順番が異なるかどうか
+//
+// Fieldの名前は大文字小文字を区別せずに比較する. RECORDの中のFieldの順番も比較する
+func OrderChanged(before bigquery.Schema, after bigquery.Schema) bool {
+	afterFields := map[string]*bigquery.FieldSchema{}
+	for _, f := range after {
+		afterFields[strings.ToLower(f.Name)] = f
+	}
+	var beforeOrder []string
+	for _, b := range before {
+		key := strings.ToLower(b.Name)
+		a, ok := afterFields[key]
+		if !ok {
+			continue
+		}
+		beforeOrder = append(beforeOrder, key)
+		if b.Type == bigquery.RecordFieldType && a.Type == bigquery.RecordFieldType && OrderChanged(b.Schema, a.Schema) {
+			return true
+		}
+	}
+
+	beforeFields := map[string]bool{}
+	for _, key := range beforeOrder {
+		beforeFields[key] = true
+	}
+	var i int
+	for _, a := range after {
+		key := strings.ToLower(a.Name)
+		if !beforeFields[key] {
+			continue
+		}
+		if beforeOrder[i] != key {
+			return true
+		}
+		i++
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package schemas_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+)
+
+func TestDiff(t *testing.T) {
+	before := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "removed", Type: bigquery.StringFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType, Description: "user name"},
+		}},
+	}
+	after := bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "count", Type: bigquery.FloatFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "age", Type: bigquery.IntegerFieldType},
+		}},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	}
+
+	got := schemas.Diff(before, after)
+	want := []schemas.FieldDiff{
+		{Path: "id", Kind: schemas.FieldModeChanged, Before: "REQUIRED", After: "NULLABLE"},
+		{Path: "count", Kind: schemas.FieldTypeChanged, Before: "INTEGER", After: "FLOAT"},
+		{Path: "removed", Kind: schemas.FieldRemoved, Before: "STRING"},
+		{Path: "user.name", Kind: schemas.FieldDescriptionChanged, Before: "user name"},
+		{Path: "user.age", Kind: schemas.FieldAdded, After: "INT64"},
+		{Path: "tags", Kind: schemas.FieldAdded, After: "ARRAY<STRING>"},
+	}
+	if g, e := len(got), len(want); g != e {
+		t.Fatalf("want %d diffs but got %d", e, g)
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("want %+v but got %+v", want[i], *got[i])
+		}
+	}
+}
+
+func TestDiffNoDiff(t *testing.T) {
+	s := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+	}
+	reordered := bigquery.Schema{s[1], s[0]}
+	if got := schemas.Diff(s, reordered); len(got) != 0 {
+		t.Errorf("want no diff but got %d", len(got))
+	}
+}
+
+func TestOrderChanged(t *testing.T) {
+	id := &bigquery.FieldSchema{Name: "id", Type: bigquery.StringFieldType}
+	count := &bigquery.FieldSchema{Name: "count", Type: bigquery.IntegerFieldType}
+	name := &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType}
+	user := func(fields ...*bigquery.FieldSchema) *bigquery.FieldSchema {
+		return &bigquery.FieldSchema{Name: "user", Type: bigquery.RecordFieldType, Schema: fields}
+	}
+
+	cases := []struct {
+		name   string
+		before bigquery.Schema
+		after  bigquery.Schema
+		want   bool
+	}{
+		{"same", bigquery.Schema{id, count}, bigquery.Schema{id, count}, false},
+		{"reordered", bigquery.Schema{id, count}, bigquery.Schema{count, id}, true},
+		{"added", bigquery.Schema{id, count}, bigquery.Schema{id, name, count}, false},
+		{"reordered and added", bigquery.Schema{id, count}, bigquery.Schema{count, name, id}, true},
+		{"removed", bigquery.Schema{id, name, count}, bigquery.Schema{id, count}, false},
+		{"reordered in record", bigquery.Schema{id, user(name, count)}, bigquery.Schema{id, user(count, name)}, true},
+		{"case insensitive", bigquery.Schema{id, count}, bigquery.Schema{{Name: "ID", Type: bigquery.StringFieldType}, count}, false},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if g, e := schemas.OrderChanged(tt.before, tt.after), tt.want; g != e {
+				t.Errorf("want %t but got %t", e, g)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package schemas
+
+import (
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Equal is 2つのSchemaのFieldの名前・型・Modeと順番が同じかどうかを返す
+//
+// DescriptionやPolicyTagsなどは比較しない
+func Equal(a bigquery.Schema, b bigquery.Schema) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !fieldEqual(a[i], b[i]) || a[i].Required != b[i].Required {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldEqual is Fieldの名前・型・REPEATEDかどうかが同じかを返す. RecordのFieldはModeも含めて比較する
+func fieldEqual(a *bigquery.FieldSchema, b *bigquery.FieldSchema) bool {
+	if !strings.EqualFold(a.Name, b.Name) || a.Type != b.Type || a.Repeated != b.Repeated {
+		return false
+	}
+	if a.Type == bigquery.RecordFieldType {
+		return Equal(a.Schema, b.Schema)
+	}
+	return true
+}
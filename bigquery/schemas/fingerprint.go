@@ -0,0 +1,34 @@
+package schemas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Fingerprint is SchemaのFieldの名前・型・Modeと順番から計算したhashを返す
+//
+// DescriptionやPolicyTagsは含まない. Fieldの名前は大文字小文字を区別しない
+func Fingerprint(s bigquery.Schema) string {
+	sb := &strings.Builder{}
+	writeCanonical(sb, s)
+	h := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(h[:])[:16]
+}
+
+func writeCanonical(sb *strings.Builder, s bigquery.Schema) {
+	sb.WriteString("[")
+	for i, f := range s {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(sb, "%s %s %s", strings.ToLower(f.Name), f.Type, Mode(f))
+		if f.Type == bigquery.RecordFieldType {
+			writeCanonical(sb, f.Schema)
+		}
+	}
+	sb.WriteString("]")
+}
@@ -0,0 +1,52 @@
+package schemas_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+	}
+
+	cases := []struct {
+		name  string
+		s     bigquery.Schema
+		equal bool
+	}{
+		{"same", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType},
+			{Name: "count", Type: bigquery.IntegerFieldType},
+		}, true},
+		{"description and case", bigquery.Schema{
+			{Name: "ID", Type: bigquery.StringFieldType, Description: "id"},
+			{Name: "count", Type: bigquery.IntegerFieldType},
+		}, true},
+		{"type", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType},
+			{Name: "count", Type: bigquery.FloatFieldType},
+		}, false},
+		{"mode", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "count", Type: bigquery.IntegerFieldType},
+		}, false},
+		{"order", bigquery.Schema{
+			{Name: "count", Type: bigquery.IntegerFieldType},
+			{Name: "id", Type: bigquery.StringFieldType},
+		}, false},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := schemas.Fingerprint(tt.s) == schemas.Fingerprint(base)
+			if got != tt.equal {
+				t.Errorf("want %t but got %t", tt.equal, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package schemas
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// GoFile is Schemaから、bigquery tagを付けたGoのstructを定義したFileの内容を作る
+//
+// NULLABLEのFieldはbigquery.NullString等のNull型、REPEATEDのFieldはSlice、NULLABLEのRECORDはPointerにする
+// RECORDはtypeNameにField名を繋げた名前の別のstructにする
+func GoFile(packageName string, typeName string, s bigquery.Schema) ([]byte, error) {
+	g := &goStructGenerator{imports: map[string]bool{}}
+	g.writeStruct(GoName(typeName), s)
+
+	var b strings.Builder
+	b.WriteString("// Code generated by gcptoolbox bq schema export. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", packageName)
+	if len(g.imports) > 0 {
+		// goimportsと同じように標準Packageとそれ以外を分ける
+		var std, others []string
+		for k := range g.imports {
+			if strings.Contains(strings.Split(k, "/")[0], ".") {
+				others = append(others, k)
+			} else {
+				std = append(std, k)
+			}
+		}
+		sort.Strings(std)
+		sort.Strings(others)
+		b.WriteString("import (\n")
+		for _, v := range std {
+			fmt.Fprintf(&b, "\t%q\n", v)
+		}
+		if len(std) > 0 && len(others) > 0 {
+			b.WriteString("\n")
+		}
+		for _, v := range others {
+			fmt.Fprintf(&b, "\t%q\n", v)
+		}
+		b.WriteString(")\n\n")
+	}
+	for i, v := range g.structs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(v)
+	}
+	return format.Source([]byte(b.String()))
+}
+
+type goStructGenerator struct {
+	imports map[string]bool
+	structs []string
+}
+
+func (g *goStructGenerator) writeStruct(name string, s bigquery.Schema) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	// structを書き終わる前にRECORDのstructが追加されないように、後でまとめて書く
+	type nested struct {
+		name   string
+		schema bigquery.Schema
+	}
+	var nests []*nested
+	used := map[string]int{}
+	for _, f := range s {
+		fieldName := GoName(f.Name)
+		used[fieldName]++
+		if n := used[fieldName]; n > 1 {
+			fieldName = fmt.Sprintf("%s%d", fieldName, n)
+		}
+		if f.Description != "" {
+			fmt.Fprintf(&b, "\t// %s is %s\n", fieldName, strings.ReplaceAll(f.Description, "\n", " "))
+		}
+
+		var typ string
+		if f.Type == bigquery.RecordFieldType {
+			typ = name + fieldName
+			nests = append(nests, &nested{name: typ, schema: f.Schema})
+			if !f.Repeated && !f.Required {
+				typ = "*" + typ
+			}
+		} else {
+			typ = g.scalarType(f.Type, !f.Repeated && !f.Required)
+		}
+		if f.Repeated {
+			typ = "[]" + typ
+		}
+		fmt.Fprintf(&b, "\t%s %s `bigquery:%q`\n", fieldName, typ, f.Name)
+	}
+	b.WriteString("}\n")
+	g.structs = append(g.structs, b.String())
+
+	for _, v := range nests {
+		g.writeStruct(v.name, v.schema)
+	}
+}
+
+func (g *goStructGenerator) scalarType(t bigquery.FieldType, nullable bool) string {
+	var typ, nullType string
+	switch t {
+	case bigquery.StringFieldType:
+		typ, nullType = "string", "bigquery.NullString"
+	case bigquery.BytesFieldType:
+		typ, nullType = "[]byte", "[]byte"
+	case bigquery.IntegerFieldType:
+		typ, nullType = "int64", "bigquery.NullInt64"
+	case bigquery.FloatFieldType:
+		typ, nullType = "float64", "bigquery.NullFloat64"
+	case bigquery.BooleanFieldType:
+		typ, nullType = "bool", "bigquery.NullBool"
+	case bigquery.TimestampFieldType:
+		typ, nullType = "time.Time", "bigquery.NullTimestamp"
+		if !nullable {
+			g.imports["time"] = true
+		}
+	case bigquery.DateFieldType:
+		typ, nullType = "civil.Date", "bigquery.NullDate"
+	case bigquery.TimeFieldType:
+		typ, nullType = "civil.Time", "bigquery.NullTime"
+	case bigquery.DateTimeFieldType:
+		typ, nullType = "civil.DateTime", "bigquery.NullDateTime"
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		typ, nullType = "*big.Rat", "*big.Rat"
+		g.imports["math/big"] = true
+	case bigquery.GeographyFieldType:
+		typ, nullType = "string", "bigquery.NullGeography"
+	case bigquery.JSONFieldType:
+		typ, nullType = "string", "bigquery.NullJSON"
+	case bigquery.IntervalFieldType:
+		typ, nullType = "*bigquery.IntervalValue", "*bigquery.IntervalValue"
+	case bigquery.RangeFieldType:
+		typ, nullType = "*bigquery.RangeValue", "*bigquery.RangeValue"
+	default:
+		typ, nullType = "bigquery.Value", "bigquery.Value"
+	}
+	if nullable {
+		typ = nullType
+	}
+	if strings.Contains(typ, "civil.") {
+		g.imports["cloud.google.com/go/civil"] = true
+	}
+	if strings.Contains(typ, "bigquery.") {
+		g.imports["cloud.google.com/go/bigquery"] = true
+	}
+	return typ
+}
+
+// goInitialisms is GoNameで全て大文字にする単語
+var goInitialisms = map[string]bool{
+	"api": true, "http": true, "https": true, "id": true, "ip": true, "json": true,
+	"sql": true, "uri": true, "url": true, "uuid": true,
+}
+
+// GoName is Column名やTable名をGoのExportされた識別子にする
+//
+// eg. user_id -> UserID, access_log_20240101 -> AccessLog20240101
+func GoName(v string) string {
+	words := strings.FieldsFunc(v, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, w := range words {
+		if goInitialisms[strings.ToLower(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	name := b.String()
+	if name == "" {
+		return "X"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
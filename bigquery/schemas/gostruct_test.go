@@ -0,0 +1,83 @@
+package schemas_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+)
+
+func TestGoFile(t *testing.T) {
+	s := bigquery.Schema{
+		{Name: "user_id", Type: bigquery.StringFieldType, Required: true, Description: "ID of the user"},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "created_at", Type: bigquery.TimestampFieldType, Required: true},
+		{Name: "amount", Type: bigquery.NumericFieldType},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "device", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "os", Type: bigquery.StringFieldType},
+			{Name: "date", Type: bigquery.DateFieldType},
+		}},
+		{Name: "items", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType, Required: true},
+		}},
+	}
+	got, err := schemas.GoFile("logs", "access_log", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// Code generated by gcptoolbox bq schema export. DO NOT EDIT.\n" +
+		"\n" +
+		"package logs\n" +
+		"\n" +
+		"import (\n" +
+		"\t\"math/big\"\n" +
+		"\t\"time\"\n" +
+		"\n" +
+		"\t\"cloud.google.com/go/bigquery\"\n" +
+		")\n" +
+		"\n" +
+		"type AccessLog struct {\n" +
+		"\t// UserID is ID of the user\n" +
+		"\tUserID    string             `bigquery:\"user_id\"`\n" +
+		"\tCount     bigquery.NullInt64 `bigquery:\"count\"`\n" +
+		"\tCreatedAt time.Time          `bigquery:\"created_at\"`\n" +
+		"\tAmount    *big.Rat           `bigquery:\"amount\"`\n" +
+		"\tTags      []string           `bigquery:\"tags\"`\n" +
+		"\tDevice    *AccessLogDevice   `bigquery:\"device\"`\n" +
+		"\tItems     []AccessLogItems   `bigquery:\"items\"`\n" +
+		"}\n" +
+		"\n" +
+		"type AccessLogDevice struct {\n" +
+		"\tOs   bigquery.NullString `bigquery:\"os\"`\n" +
+		"\tDate bigquery.NullDate   `bigquery:\"date\"`\n" +
+		"}\n" +
+		"\n" +
+		"type AccessLogItems struct {\n" +
+		"\tName string `bigquery:\"name\"`\n" +
+		"}\n"
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	cases := []struct {
+		name string
+		v    string
+		want string
+	}{
+		{"snake", "user_id", "UserID"},
+		{"initialism", "request_url", "RequestURL"},
+		{"shard", "access_log_20240101", "AccessLog20240101"},
+		{"leading digit", "1st_place", "X1stPlace"},
+		{"hyphen", "my-dataset", "MyDataset"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schemas.GoName(tt.v); got != tt.want {
+				t.Errorf("want %s but got %s", tt.want, got)
+			}
+		})
+	}
+}
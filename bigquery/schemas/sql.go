@@ -0,0 +1,114 @@
+package schemas
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// TypeSQL is FieldをGoogleSQLの型で表した文字列を返す
+//
+// eg. INT64, ARRAY<STRING>, STRUCT<name STRING, age INT64>
+func TypeSQL(f *bigquery.FieldSchema) string {
+	t := scalarTypeSQL(f)
+	if f.Repeated {
+		return fmt.Sprintf("ARRAY<%s>", t)
+	}
+	return t
+}
+
+func scalarTypeSQL(f *bigquery.FieldSchema) string {
+	switch f.Type {
+	case bigquery.IntegerFieldType:
+		return "INT64"
+	case bigquery.FloatFieldType:
+		return "FLOAT64"
+	case bigquery.BooleanFieldType:
+		return "BOOL"
+	case bigquery.RecordFieldType:
+		var l []string
+		for _, c := range f.Schema {
+			l = append(l, fmt.Sprintf("`%s` %s", c.Name, TypeSQL(c)))
+		}
+		return fmt.Sprintf("STRUCT<%s>", strings.Join(l, ", "))
+	}
+	return string(f.Type)
+}
+
+// SelectListSQL is sourceのSchemaを持つTableをtargetのSchemaに合わせてSELECTするためのSELECT句の中身を返す
+//
+// targetはWidenSchemaでsourceを含めて広げたSchemaであることを想定している
+// sourceに存在しないFieldはNULL, 型が異なるFieldはCASTする
+func SelectListSQL(target bigquery.Schema, source bigquery.Schema) (string, error) {
+	l, err := selectList(target, source, "", 0)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(l, ",\n"), nil
+}
+
+func selectList(target bigquery.Schema, source bigquery.Schema, parent string, depth int) ([]string, error) {
+	sourceFields := map[string]*bigquery.FieldSchema{}
+	for _, f := range source {
+		sourceFields[strings.ToLower(f.Name)] = f
+	}
+
+	var l []string
+	for _, f := range target {
+		var path string
+		if parent == "" {
+			path = fmt.Sprintf("`%s`", f.Name)
+		} else {
+			path = fmt.Sprintf("%s.`%s`", parent, f.Name)
+		}
+		expr, err := fieldExpr(f, sourceFields[strings.ToLower(f.Name)], path, depth)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, fmt.Sprintf("%s AS `%s`", expr, f.Name))
+	}
+	return l, nil
+}
+
+// fieldExpr is sourceのFieldをtargetの型に合わせる式を返す
+//
+// depthはUNNESTのaliasがネストした時に重複しないようにするために使う
+func fieldExpr(target *bigquery.FieldSchema, source *bigquery.FieldSchema, path string, depth int) (string, error) {
+	if source == nil {
+		if target.Repeated {
+			return fmt.Sprintf("CAST([] AS %s)", TypeSQL(target)), nil
+		}
+		return fmt.Sprintf("CAST(NULL AS %s)", TypeSQL(target)), nil
+	}
+	if target.Repeated != source.Repeated {
+		return "", fmt.Errorf("%s: REPEATED and non REPEATED fields cannot be converted", path)
+	}
+	if fieldEqual(target, source) {
+		return path, nil
+	}
+
+	alias := fmt.Sprintf("e%d", depth)
+	if target.Type != bigquery.RecordFieldType {
+		if target.Repeated {
+			return fmt.Sprintf("ARRAY(SELECT CAST(%[1]s AS %[2]s) FROM UNNEST(%[3]s) AS %[1]s)", alias, scalarTypeSQL(target), path), nil
+		}
+		return fmt.Sprintf("CAST(%s AS %s)", path, TypeSQL(target)), nil
+	}
+	if source.Type != bigquery.RecordFieldType {
+		return "", fmt.Errorf("%s: %s cannot be converted to RECORD", path, source.Type)
+	}
+
+	if target.Repeated {
+		l, err := selectList(target.Schema, source.Schema, alias, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ARRAY(SELECT AS STRUCT %s FROM UNNEST(%s) AS %s)", strings.Join(l, ", "), path, alias), nil
+	}
+	l, err := selectList(target.Schema, source.Schema, path, depth)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("IF(%s IS NULL, NULL, STRUCT(%s))", path, strings.Join(l, ", ")), nil
+}
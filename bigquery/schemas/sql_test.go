@@ -0,0 +1,63 @@
+package schemas_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+)
+
+func TestSelectListSQL(t *testing.T) {
+	target := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "count", Type: bigquery.FloatFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "age", Type: bigquery.IntegerFieldType},
+		}},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	}
+	source := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+		}},
+	}
+
+	got, err := schemas.SelectListSQL(target, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "`id` AS `id`,\n" +
+		"CAST(`count` AS FLOAT64) AS `count`,\n" +
+		"IF(`user` IS NULL, NULL, STRUCT(`user`.`name` AS `name`, CAST(NULL AS INT64) AS `age`)) AS `user`,\n" +
+		"CAST([] AS ARRAY<STRING>) AS `tags`"
+	if got != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestTypeSQL(t *testing.T) {
+	cases := []struct {
+		name  string
+		field *bigquery.FieldSchema
+		want  string
+	}{
+		{"integer", &bigquery.FieldSchema{Type: bigquery.IntegerFieldType}, "INT64"},
+		{"repeated", &bigquery.FieldSchema{Type: bigquery.BooleanFieldType, Repeated: true}, "ARRAY<BOOL>"},
+		{"record", &bigquery.FieldSchema{Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "a", Type: bigquery.FloatFieldType},
+			{Name: "b", Type: bigquery.TimestampFieldType},
+		}}, "STRUCT<`a` FLOAT64, `b` TIMESTAMP>"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if g, e := schemas.TypeSQL(tt.field), tt.want; g != e {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
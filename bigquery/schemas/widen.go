@@ -0,0 +1,208 @@
+package schemas
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// numericRank is 数値型を広げる時の順番. BigQueryのSupertypeの規則に合わせている
+var numericRank = map[bigquery.FieldType]int{
+	bigquery.IntegerFieldType:    1,
+	bigquery.NumericFieldType:    2,
+	bigquery.BigNumericFieldType: 3,
+	bigquery.FloatFieldType:      4,
+}
+
+// WidenSchema is 複数のSchemaを全て受け入れられるSchemaを返す
+//
+// 一部のSchemaにしか存在しないFieldはNULLABLEとして追加する
+// 型が異なる場合は INTEGER -> NUMERIC -> BIGNUMERIC -> FLOAT, DATE -> DATETIME の順に広い方を採用する
+// それ以外の型の違いや、REPEATEDかどうかの違いはerrorを返す
+// Fieldの順番は最初に出現した順
+func WidenSchema(schemas ...bigquery.Schema) (bigquery.Schema, error) {
+	var widened bigquery.Schema
+	for i, s := range schemas {
+		var err error
+		widened, err = widen(widened, s, i == 0, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return widened, nil
+}
+
+func widen(base bigquery.Schema, s bigquery.Schema, first bool, parent string) (bigquery.Schema, error) {
+	result := make(bigquery.Schema, 0, len(base))
+	index := map[string]int{}
+	for _, f := range base {
+		index[strings.ToLower(f.Name)] = len(result)
+		c := *f
+		result = append(result, &c)
+	}
+
+	seen := map[string]bool{}
+	for _, f := range s {
+		key := strings.ToLower(f.Name)
+		seen[key] = true
+		i, ok := index[key]
+		if !ok {
+			c := *f
+			if !first {
+				// 途中から追加されたFieldは、それ以前のSchemaには存在しないのでNULLABLE
+				c.Required = false
+			}
+			if c.Type == bigquery.RecordFieldType {
+				var err error
+				c.Schema, err = widen(nil, f.Schema, first, fieldPath(parent, f.Name))
+				if err != nil {
+					return nil, err
+				}
+			}
+			index[key] = len(result)
+			result = append(result, &c)
+			continue
+		}
+
+		w, err := widenField(result[i], f, fieldPath(parent, f.Name))
+		if err != nil {
+			return nil, err
+		}
+		result[i] = w
+	}
+
+	// 今回のSchemaに存在しないFieldはNULLABLEにする
+	for _, f := range result {
+		if !seen[strings.ToLower(f.Name)] {
+			f.Required = false
+		}
+	}
+	return result, nil
+}
+
+func widenField(base *bigquery.FieldSchema, f *bigquery.FieldSchema, path string) (*bigquery.FieldSchema, error) {
+	if base.Repeated != f.Repeated {
+		return nil, fmt.Errorf("%s: REPEATED and non REPEATED fields cannot be merged", path)
+	}
+
+	c := *base
+	c.Required = base.Required && f.Required
+	if f.Description != "" {
+		c.Description = f.Description
+	}
+
+	t, err := widenType(base.Type, f.Type)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.Type = t
+
+	if t == bigquery.RecordFieldType {
+		c.Schema, err = widen(base.Schema, f.Schema, false, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+func widenType(a bigquery.FieldType, b bigquery.FieldType) (bigquery.FieldType, error) {
+	if a == b {
+		return a, nil
+	}
+	ra, okA := numericRank[a]
+	rb, okB := numericRank[b]
+	if okA && okB {
+		if ra > rb {
+			return a, nil
+		}
+		return b, nil
+	}
+	if (a == bigquery.DateFieldType && b == bigquery.DateTimeFieldType) || (a == bigquery.DateTimeFieldType && b == bigquery.DateFieldType) {
+		return bigquery.DateTimeFieldType, nil
+	}
+	return "", fmt.Errorf("%s and %s cannot be merged", a, b)
+}
+
+func fieldPath(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", parent, name)
+}
+
+// CheckRelaxation is beforeのSchemaのTableをafterのSchemaに更新できるかを確認する
+//
+// Tableの更新で許されている、REQUIREDでないFieldの追加と、REQUIREDからNULLABLEへの変更以外の差分がある場合はerrorを返す
+func CheckRelaxation(before bigquery.Schema, after bigquery.Schema) error {
+	return checkRelaxation(before, after, "")
+}
+
+func checkRelaxation(before bigquery.Schema, after bigquery.Schema, parent string) error {
+	afterFields := map[string]*bigquery.FieldSchema{}
+	for _, f := range after {
+		afterFields[strings.ToLower(f.Name)] = f
+	}
+
+	beforeFields := map[string]bool{}
+	for _, b := range before {
+		key := strings.ToLower(b.Name)
+		beforeFields[key] = true
+		path := fieldPath(parent, b.Name)
+		a, ok := afterFields[key]
+		if !ok {
+			return fmt.Errorf("%s: field cannot be removed", path)
+		}
+		if b.Type != a.Type {
+			return fmt.Errorf("%s: type cannot be changed from %s to %s", path, b.Type, a.Type)
+		}
+		if b.Repeated != a.Repeated || (!b.Required && a.Required) {
+			return fmt.Errorf("%s: mode cannot be changed from %s to %s", path, Mode(b), Mode(a))
+		}
+		if b.Type == bigquery.RecordFieldType {
+			if err := checkRelaxation(b.Schema, a.Schema, path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, a := range after {
+		if beforeFields[strings.ToLower(a.Name)] {
+			continue
+		}
+		if err := checkAddedField(a, fieldPath(parent, a.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAddedField is 追加するFieldとその中のFieldがREQUIREDでないことを確認する
+func checkAddedField(f *bigquery.FieldSchema, path string) error {
+	if f.Required {
+		return fmt.Errorf("%s: REQUIRED field cannot be added", path)
+	}
+	for _, c := range f.Schema {
+		if err := checkAddedField(c, fieldPath(path, c.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Relax is 全てのREQUIREDのFieldをNULLABLEにしたSchemaを返す. RECORDの中のFieldも含む
+func Relax(schema bigquery.Schema) bigquery.Schema {
+	if schema == nil {
+		return nil
+	}
+	result := make(bigquery.Schema, 0, len(schema))
+	for _, f := range schema {
+		c := *f
+		c.Required = false
+		if c.Type == bigquery.RecordFieldType {
+			c.Schema = Relax(f.Schema)
+		}
+		result = append(result, &c)
+	}
+	return result
+}
@@ -0,0 +1,194 @@
+package schemas_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+)
+
+func TestWidenSchema(t *testing.T) {
+	v1 := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+		}},
+	}
+	v2 := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "count", Type: bigquery.FloatFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "age", Type: bigquery.IntegerFieldType, Required: true},
+		}},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	}
+
+	got, err := schemas.WidenSchema(v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "count", Type: bigquery.FloatFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "age", Type: bigquery.IntegerFieldType},
+		}},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	}
+	if !schemas.Equal(got, want) {
+		t.Errorf("want %s but got %s", schemaString(want), schemaString(got))
+	}
+}
+
+func TestWidenSchemaMissingFieldBecomesNullable(t *testing.T) {
+	v1 := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "name", Type: bigquery.StringFieldType, Required: true},
+	}
+	v2 := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+	}
+
+	got, err := schemas.WidenSchema(v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got[0].Required {
+		t.Errorf("id want REQUIRED")
+	}
+	if got[1].Required {
+		t.Errorf("name want NULLABLE")
+	}
+}
+
+func TestWidenSchemaError(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *bigquery.FieldSchema
+		b    *bigquery.FieldSchema
+	}{
+		{"string and integer", &bigquery.FieldSchema{Name: "v", Type: bigquery.StringFieldType}, &bigquery.FieldSchema{Name: "v", Type: bigquery.IntegerFieldType}},
+		{"repeated", &bigquery.FieldSchema{Name: "v", Type: bigquery.StringFieldType}, &bigquery.FieldSchema{Name: "v", Type: bigquery.StringFieldType, Repeated: true}},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schemas.WidenSchema(bigquery.Schema{tt.a}, bigquery.Schema{tt.b})
+			if err == nil {
+				t.Errorf("want error but got nil")
+			}
+		})
+	}
+}
+
+func TestCheckRelaxation(t *testing.T) {
+	before := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+		}},
+	}
+
+	cases := []struct {
+		name    string
+		after   bigquery.Schema
+		wantErr bool
+	}{
+		{"same", before, false},
+		{"add nullable and repeated", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "count", Type: bigquery.IntegerFieldType},
+			{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+				{Name: "age", Type: bigquery.IntegerFieldType},
+			}},
+			{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		}, false},
+		{"relax required", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType},
+			{Name: "count", Type: bigquery.IntegerFieldType},
+			{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			}},
+		}, false},
+		{"change type", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "count", Type: bigquery.FloatFieldType},
+			{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			}},
+		}, true},
+		{"nullable to required", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "count", Type: bigquery.IntegerFieldType, Required: true},
+			{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			}},
+		}, true},
+		{"add required in record", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "count", Type: bigquery.IntegerFieldType},
+			{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+				{Name: "age", Type: bigquery.IntegerFieldType, Required: true},
+			}},
+		}, true},
+		{"remove", bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+			}},
+		}, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := schemas.CheckRelaxation(before, tt.after)
+			if tt.wantErr && err == nil {
+				t.Errorf("want error but got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("want nil but got %s", err)
+			}
+		})
+	}
+}
+
+func TestRelax(t *testing.T) {
+	s := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "user", Type: bigquery.RecordFieldType, Required: true, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType, Required: true},
+		}},
+	}
+
+	got := schemas.Relax(s)
+	want := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+		}},
+	}
+	if !schemas.Equal(got, want) {
+		t.Errorf("want %s but got %s", schemaString(want), schemaString(got))
+	}
+	if !s[0].Required || !s[2].Schema[0].Required {
+		t.Errorf("original schema must not be changed")
+	}
+}
+
+func schemaString(s bigquery.Schema) string {
+	j, err := s.ToJSONFields()
+	if err != nil {
+		return err.Error()
+	}
+	return string(j)
+}
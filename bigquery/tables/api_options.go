@@ -1,9 +1,25 @@
 package tables
 
+import (
+	"context"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/events"
+	"golang.org/x/time/rate"
+)
+
 type apiOptions struct {
 	overwriteExpiration bool
 	dryRun              bool
 	baseDate            BaseDate
+	journal             Journal
+	snapshotDatasetID   string
+	snapshotExpiration  time.Duration
+	concurrency         int
+	limiter             *rate.Limiter
+	reporter            events.Reporter
+	maxUpdateRetries    int
+	contentionStats     *ContentionStats
 }
 
 type APIOptions func(options *apiOptions)
@@ -28,3 +44,81 @@ func WithBaseDate(baseDate BaseDate) APIOptions {
 		ops.baseDate = baseDate
 	}
 }
+
+// WithJournal is Tableに変更を加える前の状態をJournalに記録する
+func WithJournal(journal Journal) APIOptions {
+	return func(ops *apiOptions) {
+		ops.journal = journal
+	}
+}
+
+// WithSnapshot is Tableを削除する前に、datasetIDにTable Snapshotを作成する
+// Table Snapshotを作成できないTABLE以外のTableは削除しない
+// expirationが0より大きい場合はSnapshotにExpirationを設定する
+func WithSnapshot(datasetID string, expiration time.Duration) APIOptions {
+	return func(ops *apiOptions) {
+		ops.snapshotDatasetID = datasetID
+		ops.snapshotExpiration = expiration
+	}
+}
+
+// WithConcurrency is 複数のTableを処理する時に、並列に処理するTableの数
+func WithConcurrency(concurrency int) APIOptions {
+	return func(ops *apiOptions) {
+		ops.concurrency = concurrency
+	}
+}
+
+// WithRateLimit is Tableを更新するAPIの実行を1秒あたりupdatesPerSecond回までに制限する
+//
+// BigQueryのTable更新のQuotaを超えないようにするために使う. burstは一度に実行できる回数
+func WithRateLimit(updatesPerSecond float64, burst int) APIOptions {
+	limiter := rate.NewLimiter(rate.Limit(updatesPerSecond), burst)
+	return func(ops *apiOptions) {
+		ops.limiter = limiter
+	}
+}
+
+// waitRateLimit is WithRateLimitが指定されている場合、Tableを更新できるまで待つ
+func (ops *apiOptions) waitRateLimit(ctx context.Context) error {
+	if ops.limiter == nil {
+		return nil
+	}
+	return ops.limiter.Wait(ctx)
+}
+
+// WithReporter is 処理の結果のEventを受け取るReporterを指定する
+//
+// 指定しない場合はStdoutにTextで出力する
+func WithReporter(reporter events.Reporter) APIOptions {
+	return func(ops *apiOptions) {
+		ops.reporter = reporter
+	}
+}
+
+var stdoutReporter = events.NewStdoutReporter()
+
+// report is Reporterに処理の結果のEventを送る
+func (ops *apiOptions) report(ctx context.Context, e *events.Event) {
+	reporter := ops.reporter
+	if reporter == nil {
+		reporter = stdoutReporter
+	}
+	events.Report(ctx, reporter, e)
+}
+
+// WithMaxUpdateRetries is ETagが一致せずにTableの更新に失敗した時に、やり直す回数
+//
+// 指定しない場合はDefaultMaxUpdateRetries. 負の値を指定するとやり直さない
+func WithMaxUpdateRetries(retries int) APIOptions {
+	return func(ops *apiOptions) {
+		ops.maxUpdateRetries = retries
+	}
+}
+
+// WithContentionStats is ETagが一致せずにTableの更新をやり直した回数をstatsに集計する
+func WithContentionStats(stats *ContentionStats) APIOptions {
+	return func(ops *apiOptions) {
+		ops.contentionStats = stats
+	}
+}
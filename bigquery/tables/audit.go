@@ -0,0 +1,212 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// Severity is Auditで見つかった問題の深刻度
+//
+//go:generate stringer -type=Severity -trimprefix=Severity
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+// ParseSeverity is 文字列からSeverityを返す. 大文字小文字は区別しない
+func ParseSeverity(v string) (Severity, error) {
+	switch strings.ToLower(v) {
+	case "info":
+		return SeverityInfo, nil
+	case "low":
+		return SeverityLow, nil
+	case "medium":
+		return SeverityMedium, nil
+	case "high":
+		return SeverityHigh, nil
+	case "critical":
+		return SeverityCritical, nil
+	}
+	return 0, fmt.Errorf("invalid severity %s", v)
+}
+
+// MarshalText is JSONにSeverityの名前で出力する
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// AuditRule is Auditで確認する項目
+type AuditRule string
+
+const (
+	// AuditRulePublicAccess is allUsers, allAuthenticatedUsersに権限が付与されている
+	AuditRulePublicAccess AuditRule = "public_access"
+
+	// AuditRuleExternalDomain is 許可されていないDomainのUser, Group, Domainに権限が付与されている
+	AuditRuleExternalDomain AuditRule = "external_domain"
+
+	// AuditRuleNoCMEK is Customer Managed Encryption Keyが設定されていない
+	AuditRuleNoCMEK AuditRule = "no_cmek"
+
+	// AuditRuleNoDefaultExpiration is Default Table Expiration, Default Partition Expirationのどちらも設定されていない
+	AuditRuleNoDefaultExpiration AuditRule = "no_default_expiration"
+
+	// AuditRuleNoLabels is Labelが1つも付いていない
+	AuditRuleNoLabels AuditRule = "no_labels"
+
+	// AuditRuleAuthorizedView is Authorized Viewが設定されている
+	AuditRuleAuthorizedView AuditRule = "authorized_view"
+)
+
+// AuditConfig is Auditの設定
+type AuditConfig struct {
+	// AllowedDomains is 権限を付与しても問題ないDomain. eg. example.com
+	// 空の場合はexternal_domainを確認しない
+	AllowedDomains []string
+}
+
+// AuditFinding is Auditで見つかった問題
+type AuditFinding struct {
+	ProjectID string    `json:"projectID"`
+	DatasetID string    `json:"datasetID"`
+	Rule      AuditRule `json:"rule"`
+	Severity  Severity  `json:"severity"`
+
+	// Member is 問題のある権限が付与されている対象. Datasetの設定に関する問題の場合は空
+	Member string `json:"member,omitempty"`
+
+	// Role is Memberに付与されているRole
+	Role    string `json:"role,omitempty"`
+	Message string `json:"message"`
+}
+
+// AuditDatasets is projectIDの全てのDatasetの設定を確認して、見つかった問題を返す
+func (s *Service) AuditDatasets(ctx context.Context, projectID string, cfg *AuditConfig) ([]*AuditFinding, error) {
+	var results []*AuditFinding
+	it := s.bq.Datasets(ctx)
+	it.ProjectID = projectID
+	for {
+		ds, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		meta, err := ds.Metadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed get metadata %s.%s : %w", projectID, ds.DatasetID, err)
+		}
+		results = append(results, AuditDataset(projectID, ds.DatasetID, meta, cfg)...)
+	}
+	return results, nil
+}
+
+// AuditDataset is DatasetMetadataを確認して、見つかった問題を返す
+func AuditDataset(projectID string, datasetID string, meta *bigquery.DatasetMetadata, cfg *AuditConfig) []*AuditFinding {
+	if cfg == nil {
+		cfg = &AuditConfig{}
+	}
+	var results []*AuditFinding
+	add := func(rule AuditRule, severity Severity, entry *bigquery.AccessEntry, message string) {
+		f := &AuditFinding{
+			ProjectID: projectID,
+			DatasetID: datasetID,
+			Rule:      rule,
+			Severity:  severity,
+			Message:   message,
+		}
+		if entry != nil {
+			f.Member = entry.Entity
+			f.Role = string(entry.Role)
+		}
+		results = append(results, f)
+	}
+
+	for _, entry := range meta.Access {
+		switch entry.EntityType {
+		case bigquery.SpecialGroupEntity, bigquery.IAMMemberEntity:
+			switch entry.Entity {
+			case "allUsers":
+				add(AuditRulePublicAccess, SeverityCritical, entry, "dataset is accessible by anyone on the internet")
+				continue
+			case "allAuthenticatedUsers":
+				add(AuditRulePublicAccess, SeverityHigh, entry, "dataset is accessible by any Google account")
+				continue
+			}
+		case bigquery.ViewEntity:
+			if entry.View != nil {
+				add(AuditRuleAuthorizedView, SeverityInfo, entry, fmt.Sprintf("authorized view %s.%s.%s can read the dataset", entry.View.ProjectID, entry.View.DatasetID, entry.View.TableID))
+			}
+			continue
+		}
+		if domain, ok := memberDomain(entry); ok && len(cfg.AllowedDomains) > 0 && !slices.Contains(cfg.AllowedDomains, domain) {
+			add(AuditRuleExternalDomain, SeverityHigh, entry, fmt.Sprintf("access is granted to external domain %s", domain))
+		}
+	}
+
+	if meta.DefaultEncryptionConfig == nil || meta.DefaultEncryptionConfig.KMSKeyName == "" {
+		add(AuditRuleNoCMEK, SeverityMedium, nil, "default encryption is Google-managed key")
+	}
+	if meta.DefaultTableExpiration == 0 && meta.DefaultPartitionExpiration == 0 {
+		add(AuditRuleNoDefaultExpiration, SeverityLow, nil, "default table expiration and default partition expiration are not set")
+	}
+	if len(meta.Labels) == 0 {
+		add(AuditRuleNoLabels, SeverityLow, nil, "dataset has no labels")
+	}
+	return results
+}
+
+// memberDomain is User, Group, Domainに対するAccessEntryの場合、そのDomainを返す
+//
+// Service Accountはgserviceaccount.comになり所属する組織を判断できないので対象外
+func memberDomain(entry *bigquery.AccessEntry) (string, bool) {
+	var domain string
+	switch entry.EntityType {
+	case bigquery.DomainEntity:
+		domain = entry.Entity
+	case bigquery.UserEmailEntity, bigquery.GroupEmailEntity:
+		_, domain, _ = strings.Cut(entry.Entity, "@")
+	case bigquery.IAMMemberEntity:
+		// eg. user:foo@example.com, domain:example.com
+		kind, member, ok := strings.Cut(entry.Entity, ":")
+		if !ok {
+			return "", false
+		}
+		switch kind {
+		case "domain":
+			domain = member
+		case "user", "group":
+			_, domain, _ = strings.Cut(member, "@")
+		}
+	}
+	domain = strings.ToLower(domain)
+	if domain == "" || strings.HasSuffix(domain, "gserviceaccount.com") {
+		return "", false
+	}
+	return domain, true
+}
+
+// MaxSeverity is findingsの中で最も深刻なSeverityを返す. findingsが空の場合はfalseを返す
+func MaxSeverity(findings []*AuditFinding) (Severity, bool) {
+	if len(findings) == 0 {
+		return 0, false
+	}
+	var highest Severity
+	for _, f := range findings {
+		if f.Severity > highest {
+			highest = f.Severity
+		}
+	}
+	return highest, true
+}
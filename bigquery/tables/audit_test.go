@@ -0,0 +1,96 @@
+package tables_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestAuditDataset(t *testing.T) {
+	meta := &bigquery.DatasetMetadata{
+		Access: []*bigquery.AccessEntry{
+			{Role: bigquery.ReaderRole, EntityType: bigquery.IAMMemberEntity, Entity: "allUsers"},
+			{Role: bigquery.ReaderRole, EntityType: bigquery.SpecialGroupEntity, Entity: "allAuthenticatedUsers"},
+			{Role: bigquery.OwnerRole, EntityType: bigquery.SpecialGroupEntity, Entity: "projectOwners"},
+			{Role: bigquery.ReaderRole, EntityType: bigquery.UserEmailEntity, Entity: "alice@example.com"},
+			{Role: bigquery.WriterRole, EntityType: bigquery.UserEmailEntity, Entity: "bob@partner.example.net"},
+			{Role: bigquery.ReaderRole, EntityType: bigquery.IAMMemberEntity, Entity: "group:dev@partner.example.net"},
+			{Role: bigquery.WriterRole, EntityType: bigquery.UserEmailEntity, Entity: "sa@other.iam.gserviceaccount.com"},
+			{EntityType: bigquery.ViewEntity, View: &bigquery.Table{ProjectID: "p", DatasetID: "shared", TableID: "v"}},
+		},
+	}
+	got := tables.AuditDataset("p", "d", meta, &tables.AuditConfig{AllowedDomains: []string{"example.com"}})
+
+	want := []struct {
+		rule     tables.AuditRule
+		severity tables.Severity
+		member   string
+	}{
+		{tables.AuditRulePublicAccess, tables.SeverityCritical, "allUsers"},
+		{tables.AuditRulePublicAccess, tables.SeverityHigh, "allAuthenticatedUsers"},
+		{tables.AuditRuleExternalDomain, tables.SeverityHigh, "bob@partner.example.net"},
+		{tables.AuditRuleExternalDomain, tables.SeverityHigh, "group:dev@partner.example.net"},
+		{tables.AuditRuleAuthorizedView, tables.SeverityInfo, ""},
+		{tables.AuditRuleNoCMEK, tables.SeverityMedium, ""},
+		{tables.AuditRuleNoDefaultExpiration, tables.SeverityLow, ""},
+		{tables.AuditRuleNoLabels, tables.SeverityLow, ""},
+	}
+	if g, e := len(got), len(want); g != e {
+		for _, v := range got {
+			t.Logf("%+v", v)
+		}
+		t.Fatalf("want %d findings but got %d", e, g)
+	}
+	for i, e := range want {
+		g := got[i]
+		if g.Rule != e.rule || g.Severity != e.severity || g.Member != e.member {
+			t.Errorf("[%d] want %s %s %s but got %s %s %s", i, e.rule, e.severity, e.member, g.Rule, g.Severity, g.Member)
+		}
+	}
+}
+
+func TestAuditDataset_NoFindings(t *testing.T) {
+	meta := &bigquery.DatasetMetadata{
+		Access: []*bigquery.AccessEntry{
+			{Role: bigquery.ReaderRole, EntityType: bigquery.UserEmailEntity, Entity: "alice@example.com"},
+		},
+		DefaultEncryptionConfig: &bigquery.EncryptionConfig{KMSKeyName: "projects/p/locations/us/keyRings/r/cryptoKeys/k"},
+		DefaultTableExpiration:  30 * 24 * time.Hour,
+		Labels:                  map[string]string{"team": "data"},
+	}
+	got := tables.AuditDataset("p", "d", meta, &tables.AuditConfig{AllowedDomains: []string{"example.com"}})
+	if len(got) != 0 {
+		t.Errorf("want no findings but got %d", len(got))
+	}
+	if _, ok := tables.MaxSeverity(got); ok {
+		t.Errorf("want no max severity")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	v, err := tables.ParseSeverity("HIGH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != tables.SeverityHigh {
+		t.Errorf("want %s but got %s", tables.SeverityHigh, v)
+	}
+	if _, err := tables.ParseSeverity("unknown"); err == nil {
+		t.Errorf("unknown must be error")
+	}
+
+	j, err := json.Marshal(&tables.AuditFinding{Severity: tables.SeverityCritical})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(j, &m); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := m["severity"], "Critical"; g != e {
+		t.Errorf("want %s but got %v", e, g)
+	}
+}
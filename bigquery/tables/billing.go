@@ -0,0 +1,191 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// StorageBillingModel is DatasetのStorageの課金モデル
+type StorageBillingModel string
+
+const (
+	LogicalStorageBilling  StorageBillingModel = "LOGICAL"
+	PhysicalStorageBilling StorageBillingModel = "PHYSICAL"
+)
+
+// DatasetStorageBilling is DatasetのStorageをLogicalとPhysicalのそれぞれで課金した場合の料金
+type DatasetStorageBilling struct {
+	ProjectID string `json:"projectID"`
+	DatasetID string `json:"datasetID"`
+	Location  string `json:"location"`
+
+	// CurrentModel is 今設定されている課金モデル
+	CurrentModel StorageBillingModel `json:"currentModel"`
+
+	ActiveLogicalBytes   int64 `json:"activeLogicalBytes"`
+	LongTermLogicalBytes int64 `json:"longTermLogicalBytes"`
+
+	// ActivePhysicalBytes is Time Travelの分を除いたActive Storageの圧縮後のサイズ
+	ActivePhysicalBytes   int64 `json:"activePhysicalBytes"`
+	LongTermPhysicalBytes int64 `json:"longTermPhysicalBytes"`
+
+	// TimeTravelPhysicalBytes is Time Travelのために保持されているサイズ. Physical Billingの場合だけActive Storageとして課金される
+	TimeTravelPhysicalBytes int64 `json:"timeTravelPhysicalBytes"`
+
+	// FailSafePhysicalBytes is Fail-safeのために保持されているサイズ. Physical Billingの場合だけActive Storageとして課金される
+	FailSafePhysicalBytes int64 `json:"failSafePhysicalBytes"`
+
+	// LogicalMonthlyCost is Logical Billingの場合の1ヶ月あたりの料金(USD)
+	LogicalMonthlyCost float64 `json:"logicalMonthlyCost"`
+
+	// PhysicalMonthlyCost is Physical Billingの場合の1ヶ月あたりの料金(USD)
+	PhysicalMonthlyCost float64 `json:"physicalMonthlyCost"`
+
+	// RecommendedModel is 安くなる課金モデル
+	RecommendedModel StorageBillingModel `json:"recommendedModel"`
+
+	// MonthlySavings is RecommendedModelに切り替えた場合に1ヶ月あたりに安くなる料金(USD). 切り替える必要がない場合は0
+	MonthlySavings float64 `json:"monthlySavings"`
+}
+
+// ShouldSwitch is 課金モデルを切り替えた方が安くなるかどうか
+func (b *DatasetStorageBilling) ShouldSwitch() bool {
+	return b.RecommendedModel != b.CurrentModel
+}
+
+// Estimate is pricingで料金を計算して、安くなる課金モデルを決める
+func (b *DatasetStorageBilling) Estimate(pricing *StoragePricing) {
+	b.LogicalMonthlyCost = float64(b.ActiveLogicalBytes)/GiB*pricing.ActiveLogical +
+		float64(b.LongTermLogicalBytes)/GiB*pricing.LongTermLogical
+	b.PhysicalMonthlyCost = float64(b.ActivePhysicalBytes+b.TimeTravelPhysicalBytes+b.FailSafePhysicalBytes)/GiB*pricing.ActivePhysical +
+		float64(b.LongTermPhysicalBytes)/GiB*pricing.LongTermPhysical
+
+	b.RecommendedModel = b.CurrentModel
+	b.MonthlySavings = 0
+	switch {
+	case b.CurrentModel == LogicalStorageBilling && b.PhysicalMonthlyCost < b.LogicalMonthlyCost:
+		b.RecommendedModel = PhysicalStorageBilling
+		b.MonthlySavings = b.LogicalMonthlyCost - b.PhysicalMonthlyCost
+	case b.CurrentModel == PhysicalStorageBilling && b.LogicalMonthlyCost < b.PhysicalMonthlyCost:
+		b.RecommendedModel = LogicalStorageBilling
+		b.MonthlySavings = b.PhysicalMonthlyCost - b.LogicalMonthlyCost
+	}
+}
+
+type datasetStorageRow struct {
+	TableSchema             string `bigquery:"table_schema"`
+	ActiveLogicalBytes      int64  `bigquery:"active_logical_bytes"`
+	LongTermLogicalBytes    int64  `bigquery:"long_term_logical_bytes"`
+	ActivePhysicalBytes     int64  `bigquery:"active_physical_bytes"`
+	LongTermPhysicalBytes   int64  `bigquery:"long_term_physical_bytes"`
+	TimeTravelPhysicalBytes int64  `bigquery:"time_travel_physical_bytes"`
+	FailSafePhysicalBytes   int64  `bigquery:"fail_safe_physical_bytes"`
+}
+
+// StorageBillingReport is INFORMATION_SCHEMA.TABLE_STORAGEから、DatasetごとにLogicalとPhysicalの料金を計算して、安くなる課金モデルを返す
+//
+// locationを指定した場合はそのRegionのDatasetだけが対象. 空の場合はProjectの全てのRegionのDatasetが対象
+// pricingがnilの場合はDefaultStoragePricingで計算する
+// 安くなる料金が大きい順に返す
+func (s *Service) StorageBillingReport(ctx context.Context, projectID string, location string, pricing *StoragePricing) ([]*DatasetStorageBilling, error) {
+	if pricing == nil {
+		pricing = &DefaultStoragePricing
+	}
+
+	// 課金モデルはINFORMATION_SCHEMA.TABLE_STORAGEには無いので、DatasetのMetadataから取る
+	datasets := map[string]*DatasetStorageBilling{}
+	locations := map[string]bool{}
+	iter := s.bq.Datasets(ctx)
+	iter.ProjectID = projectID
+	for {
+		ds, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed list datasets %s : %w", projectID, err)
+		}
+		meta, err := ds.Metadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed get metadata %s.%s : %w", projectID, ds.DatasetID, err)
+		}
+		if location != "" && !strings.EqualFold(location, meta.Location) {
+			continue
+		}
+		model := LogicalStorageBilling
+		if meta.StorageBillingModel == bigquery.PhysicalStorageBillingModel {
+			model = PhysicalStorageBilling
+		}
+		datasets[ds.DatasetID] = &DatasetStorageBilling{
+			ProjectID:    projectID,
+			DatasetID:    ds.DatasetID,
+			Location:     meta.Location,
+			CurrentModel: model,
+		}
+		locations[meta.Location] = true
+	}
+
+	for loc := range locations {
+		if err := s.readDatasetStorage(ctx, projectID, loc, datasets); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []*DatasetStorageBilling
+	for _, v := range datasets {
+		v.Estimate(pricing)
+		results = append(results, v)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].MonthlySavings != results[j].MonthlySavings {
+			return results[i].MonthlySavings > results[j].MonthlySavings
+		}
+		return results[i].DatasetID < results[j].DatasetID
+	})
+	return results, nil
+}
+
+// readDatasetStorage is locationのINFORMATION_SCHEMA.TABLE_STORAGEをDatasetごとに集計してdatasetsに入れる
+func (s *Service) readDatasetStorage(ctx context.Context, projectID string, location string, datasets map[string]*DatasetStorageBilling) error {
+	sql := fmt.Sprintf("SELECT table_schema,\n"+
+		"  IFNULL(SUM(active_logical_bytes), 0) AS active_logical_bytes,\n"+
+		"  IFNULL(SUM(long_term_logical_bytes), 0) AS long_term_logical_bytes,\n"+
+		"  IFNULL(SUM(active_physical_bytes - time_travel_physical_bytes), 0) AS active_physical_bytes,\n"+
+		"  IFNULL(SUM(long_term_physical_bytes), 0) AS long_term_physical_bytes,\n"+
+		"  IFNULL(SUM(time_travel_physical_bytes), 0) AS time_travel_physical_bytes,\n"+
+		"  IFNULL(SUM(fail_safe_physical_bytes), 0) AS fail_safe_physical_bytes\n"+
+		"FROM `%s`.`%s`.INFORMATION_SCHEMA.TABLE_STORAGE\n"+
+		"GROUP BY table_schema", projectID, RegionQualifier(location))
+	q := s.bq.Query(sql)
+	q.Location = location
+	it, err := q.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("failed query table storage %s : %w", location, err)
+	}
+	for {
+		var row datasetStorageRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		v, ok := datasets[row.TableSchema]
+		if !ok {
+			// 削除済みのDatasetのTableはFail-safeの間残っているが、課金モデルは変更できないので対象外
+			continue
+		}
+		v.ActiveLogicalBytes = row.ActiveLogicalBytes
+		v.LongTermLogicalBytes = row.LongTermLogicalBytes
+		v.ActivePhysicalBytes = row.ActivePhysicalBytes
+		v.LongTermPhysicalBytes = row.LongTermPhysicalBytes
+		v.TimeTravelPhysicalBytes = row.TimeTravelPhysicalBytes
+		v.FailSafePhysicalBytes = row.FailSafePhysicalBytes
+	}
+	return nil
+}
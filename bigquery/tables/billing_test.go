@@ -0,0 +1,89 @@
+package tables_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestDatasetStorageBilling_Estimate(t *testing.T) {
+	cases := []struct {
+		name          string
+		billing       *tables.DatasetStorageBilling
+		wantLogical   float64
+		wantPhysical  float64
+		wantSwitch    bool
+		wantRecommend tables.StorageBillingModel
+		wantSavings   float64
+	}{
+		{
+			name: "well compressed",
+			billing: &tables.DatasetStorageBilling{
+				CurrentModel:          tables.LogicalStorageBilling,
+				ActiveLogicalBytes:    100 * tables.GiB,
+				LongTermLogicalBytes:  100 * tables.GiB,
+				ActivePhysicalBytes:   10 * tables.GiB,
+				LongTermPhysicalBytes: 10 * tables.GiB,
+				FailSafePhysicalBytes: 5 * tables.GiB,
+			},
+			wantLogical:   3,
+			wantPhysical:  0.8,
+			wantSwitch:    true,
+			wantRecommend: tables.PhysicalStorageBilling,
+			wantSavings:   2.2,
+		},
+		{
+			name: "large time travel",
+			billing: &tables.DatasetStorageBilling{
+				CurrentModel:            tables.PhysicalStorageBilling,
+				ActiveLogicalBytes:      100 * tables.GiB,
+				ActivePhysicalBytes:     40 * tables.GiB,
+				TimeTravelPhysicalBytes: 40 * tables.GiB,
+			},
+			wantLogical:   2,
+			wantPhysical:  3.2,
+			wantSwitch:    true,
+			wantRecommend: tables.LogicalStorageBilling,
+			wantSavings:   1.2,
+		},
+		{
+			name: "already cheaper",
+			billing: &tables.DatasetStorageBilling{
+				CurrentModel:        tables.LogicalStorageBilling,
+				ActiveLogicalBytes:  100 * tables.GiB,
+				ActivePhysicalBytes: 80 * tables.GiB,
+			},
+			wantLogical:   2,
+			wantPhysical:  3.2,
+			wantSwitch:    false,
+			wantRecommend: tables.LogicalStorageBilling,
+			wantSavings:   0,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.billing.Estimate(&tables.DefaultStoragePricing)
+			if !almostEqual(tt.billing.LogicalMonthlyCost, tt.wantLogical) {
+				t.Errorf("want logical %f but got %f", tt.wantLogical, tt.billing.LogicalMonthlyCost)
+			}
+			if !almostEqual(tt.billing.PhysicalMonthlyCost, tt.wantPhysical) {
+				t.Errorf("want physical %f but got %f", tt.wantPhysical, tt.billing.PhysicalMonthlyCost)
+			}
+			if tt.billing.ShouldSwitch() != tt.wantSwitch {
+				t.Errorf("want switch %t but got %t", tt.wantSwitch, tt.billing.ShouldSwitch())
+			}
+			if tt.billing.RecommendedModel != tt.wantRecommend {
+				t.Errorf("want recommend %s but got %s", tt.wantRecommend, tt.billing.RecommendedModel)
+			}
+			if !almostEqual(tt.billing.MonthlySavings, tt.wantSavings) {
+				t.Errorf("want savings %f but got %f", tt.wantSavings, tt.billing.MonthlySavings)
+			}
+		})
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
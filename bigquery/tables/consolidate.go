@@ -0,0 +1,294 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	ShardCopyMethodCopy  = "copy"
+	ShardCopyMethodQuery = "query"
+
+	ShardSourceActionDeleted = "deleted"
+	ShardSourceActionExpired = "expired"
+)
+
+// ConsolidateShardsConfig is 日付ShardingされたTableをPartitioned Tableにまとめる時の設定
+type ConsolidateShardsConfig struct {
+	// ClusteringFields is 作成するTableのClustering. 指定しない場合はClusteringしない
+	ClusteringFields []string
+
+	// DeleteSource is コピーと件数の確認が終わったShardを削除する
+	DeleteSource bool
+
+	// SourceExpiration is 0より大きい場合、コピーと件数の確認が終わったShardのExpirationを現在時刻+SourceExpirationにする
+	SourceExpiration time.Duration
+}
+
+// ShardCopyResult is 1つのShardをPartitionにコピーした結果
+type ShardCopyResult struct {
+	TableID   string `json:"tableID"`
+	Partition string `json:"partition"`
+
+	// Method is copy or query. ShardのSchemaがコピー先と同じ場合はCopy Job, 異なる場合はSchemaを合わせるQuery Jobを使う
+	// コピー先のColumnは全てNULLABLEなので、REQUIREDのColumnがあるShardはQuery Jobになる
+	// Copy JobはClusteringが異なるTableにコピーできないので、Clusteringを指定した場合やShardとコピー先のClusteringが異なる場合もQuery Jobを使う
+	Method string `json:"method"`
+
+	SourceRows      uint64 `json:"sourceRows"`
+	DestinationRows uint64 `json:"destinationRows"`
+
+	// SourceAction is コピー後にShardに対して行ったこと. deleted or expired or 空
+	SourceAction string `json:"sourceAction,omitempty"`
+}
+
+type shardMetadata struct {
+	shard *Shard
+	meta  *bigquery.TableMetadata
+}
+
+// ConsolidateShardsToPartitionedTable is tablePrefixに合致する日付ShardingされたTableを、1つの日付Partitioned Tableにまとめる
+//
+// コピー先のTableが存在しない場合は、全てのShardのSchemaを広げて全てのColumnをNULLABLEにしたSchemaで、取り込み時間で日付分割したTableを作成する
+// 各ShardはPartition Decoratorを使って日付のPartitionに上書きでコピーし、件数が一致することを確認する
+// 途中で失敗した場合もそれまでの結果は返す
+func (s *Service) ConsolidateShardsToPartitionedTable(ctx context.Context, projectID string, datasetID string, tablePrefix string, destinationTableID string, cfg *ConsolidateShardsConfig, ops ...APIOptions) ([]*ShardCopyResult, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+	if cfg == nil {
+		cfg = &ConsolidateShardsConfig{}
+	}
+
+	shards, err := s.ListShards(ctx, projectID, datasetID, tablePrefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("shard not found. prefix=%s", tablePrefix)
+	}
+
+	ds := s.bq.DatasetInProject(projectID, datasetID)
+	var sms []*shardMetadata
+	var schemaList []bigquery.Schema
+	dest := ds.Table(destinationTableID)
+	destMeta, err := dest.Metadata(ctx)
+	if isNotFound(err) {
+		destMeta = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed get metadata %s : %w", destinationTableID, err)
+	} else {
+		if destMeta.TimePartitioning == nil || destMeta.TimePartitioning.Field != "" {
+			return nil, fmt.Errorf("%s is not ingestion time partitioned table", destinationTableID)
+		}
+		schemaList = append(schemaList, destMeta.Schema)
+	}
+	for _, shard := range shards {
+		meta, err := ds.Table(shard.TableID).Metadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed get metadata %s : %w", shard.TableID, err)
+		}
+		if meta.Type != bigquery.RegularTable {
+			return nil, fmt.Errorf("%s is %s: %w", shard.TableID, meta.Type, ErrNotApplicableTableType)
+		}
+		sms = append(sms, &shardMetadata{shard: shard, meta: meta})
+		schemaList = append(schemaList, meta.Schema)
+	}
+
+	widened, err := schemas.WidenSchema(schemaList...)
+	if err != nil {
+		return nil, fmt.Errorf("failed widen schema : %w", err)
+	}
+	// Schemaが異なるShardはQueryの結果を書き込むが、Queryの結果のColumnはNULLABLEなので
+	// REQUIREDのColumnがあるとPartitionに書き込めない. コピー先のTableは全てのColumnをNULLABLEにする
+	widened = schemas.Relax(widened)
+	if destMeta != nil {
+		// コピー先のTableのSchemaはFieldの追加とREQUIREDの緩和しかできないので、コピーを始める前に確認する
+		if err := schemas.CheckRelaxation(destMeta.Schema, widened); err != nil {
+			return nil, fmt.Errorf("schema of %s cannot be updated to accept the shards. only adding NULLABLE fields and relaxing REQUIRED to NULLABLE are allowed : %w", destinationTableID, err)
+		}
+	}
+
+	if !opt.dryRun {
+		if err := s.prepareConsolidateDestination(ctx, dest, destMeta, widened, cfg, &opt); err != nil {
+			return nil, err
+		}
+	}
+
+	// コピー先のTableのClustering. 作成する場合はcfg.ClusteringFieldsになる
+	destClustering := cfg.ClusteringFields
+	if destMeta != nil {
+		destClustering = nil
+		if destMeta.Clustering != nil {
+			destClustering = destMeta.Clustering.Fields
+		}
+	}
+
+	var results []*ShardCopyResult
+	for _, sm := range sms {
+		result := &ShardCopyResult{
+			TableID:    sm.shard.TableID,
+			Partition:  PartitionDecorator(destinationTableID, sm.shard.Date),
+			Method:     ShardCopyMethodCopy,
+			SourceRows: sm.meta.NumRows,
+		}
+		if !schemas.Equal(sm.meta.Schema, widened) || len(cfg.ClusteringFields) > 0 || !slices.Equal(shardClustering(sm.meta), destClustering) {
+			result.Method = ShardCopyMethodQuery
+		}
+		e := &events.Event{
+			Type:     events.Created,
+			Action:   fmt.Sprintf("copy by %s", result.Method),
+			Resource: result.Partition,
+			Source:   result.TableID,
+			DryRun:   opt.dryRun,
+		}
+		if opt.dryRun {
+			opt.report(ctx, e)
+			results = append(results, result)
+			continue
+		}
+
+		if err := s.copyShardToPartition(ctx, ds, sm, result, widened, destClustering); err != nil {
+			return results, fmt.Errorf("failed copy %s to %s : %w", result.TableID, result.Partition, err)
+		}
+		rows, err := s.countPartitionRows(ctx, dest, sm.shard.Date)
+		if err != nil {
+			return results, fmt.Errorf("failed count rows %s : %w", result.Partition, err)
+		}
+		result.DestinationRows = rows
+		results = append(results, result)
+		if result.SourceRows != result.DestinationRows {
+			return results, fmt.Errorf("row count mismatch %s=%d %s=%d", result.TableID, result.SourceRows, result.Partition, result.DestinationRows)
+		}
+		opt.report(ctx, e)
+
+		if err := s.cleanupShard(ctx, ds.Table(sm.shard.TableID), sm.meta, result, cfg, &opt); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// prepareConsolidateDestination is コピー先のTableが無ければ作成し、あればSchemaを広げる
+func (s *Service) prepareConsolidateDestination(ctx context.Context, dest *bigquery.Table, destMeta *bigquery.TableMetadata, schema bigquery.Schema, cfg *ConsolidateShardsConfig, opt *apiOptions) error {
+	if destMeta == nil {
+		meta := &bigquery.TableMetadata{
+			Schema: schema,
+			TimePartitioning: &bigquery.TimePartitioning{
+				Type: bigquery.DayPartitioningType,
+			},
+		}
+		if len(cfg.ClusteringFields) > 0 {
+			meta.Clustering = &bigquery.Clustering{
+				Fields: cfg.ClusteringFields,
+			}
+		}
+		if err := dest.Create(ctx, meta); err != nil {
+			return fmt.Errorf("failed create %s : %w", dest.TableID, err)
+		}
+		opt.report(ctx, &events.Event{Type: events.Created, Action: "create", Resource: dest.TableID})
+		return nil
+	}
+
+	if schemas.Equal(destMeta.Schema, schema) {
+		return nil
+	}
+	if _, err := dest.Update(ctx, bigquery.TableMetadataToUpdate{
+		Schema: schema,
+	}, destMeta.ETag); err != nil {
+		return fmt.Errorf("failed update schema %s : %w", dest.TableID, err)
+	}
+	opt.report(ctx, &events.Event{Type: events.Updated, Action: "update schema", Resource: dest.TableID})
+	return nil
+}
+
+func (s *Service) copyShardToPartition(ctx context.Context, ds *bigquery.Dataset, sm *shardMetadata, result *ShardCopyResult, schema bigquery.Schema, clustering []string) error {
+	dst := ds.Table(result.Partition)
+	if result.Method == ShardCopyMethodCopy {
+		copier := dst.CopierFrom(ds.Table(sm.shard.TableID))
+		copier.WriteDisposition = bigquery.WriteTruncate
+		return s.runJob(ctx, copier)
+	}
+
+	selectList, err := schemas.SelectListSQL(schema, sm.meta.Schema)
+	if err != nil {
+		return err
+	}
+	q := s.bq.Query(fmt.Sprintf("SELECT\n%s\nFROM `%s.%s.%s`", selectList, ds.ProjectID, ds.DatasetID, sm.shard.TableID))
+	q.Dst = dst
+	q.WriteDisposition = bigquery.WriteTruncate
+	if len(clustering) > 0 {
+		q.Clustering = &bigquery.Clustering{Fields: clustering}
+	}
+	return s.runJob(ctx, q)
+}
+
+// shardClustering is ShardのClusteringのFieldを返す. Clusteringしていない場合はnil
+func shardClustering(meta *bigquery.TableMetadata) []string {
+	if meta.Clustering == nil {
+		return nil
+	}
+	return meta.Clustering.Fields
+}
+
+func (s *Service) countPartitionRows(ctx context.Context, table *bigquery.Table, date time.Time) (uint64, error) {
+	q := s.bq.Query(fmt.Sprintf("SELECT COUNT(*) AS c FROM `%s.%s.%s` WHERE _PARTITIONTIME = TIMESTAMP(@date)", table.ProjectID, table.DatasetID, table.TableID))
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "date", Value: date.Format("2006-01-02")},
+	}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var row struct {
+		C int64 `bigquery:"c"`
+	}
+	if err := it.Next(&row); err != nil {
+		if err == iterator.Done {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return uint64(row.C), nil
+}
+
+// cleanupShard is コピーが終わったShardを削除するか、Expirationを設定する
+func (s *Service) cleanupShard(ctx context.Context, table *bigquery.Table, meta *bigquery.TableMetadata, result *ShardCopyResult, cfg *ConsolidateShardsConfig, opt *apiOptions) error {
+	if cfg.DeleteSource {
+		if err := recordJournal(ctx, opt, newJournalEntry(JournalOperationDelete, table, meta)); err != nil {
+			return err
+		}
+		if err := table.Delete(ctx); err != nil {
+			return fmt.Errorf("failed delete %s : %w", table.TableID, err)
+		}
+		result.SourceAction = ShardSourceActionDeleted
+		opt.report(ctx, &events.Event{Type: events.Deleted, Action: "delete", Resource: table.TableID})
+		return nil
+	}
+	if cfg.SourceExpiration > 0 {
+		expirationTime := time.Now().Add(cfg.SourceExpiration)
+		updated, err := s.updateTable(ctx, table, func(meta *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error) {
+			// 更新してからJournalの記録に失敗するとUndoできなくなるので、更新する前に記録する
+			if err := recordJournal(ctx, opt, newJournalEntry(JournalOperationUpdateExpiration, table, meta)); err != nil {
+				return nil, err
+			}
+			return &bigquery.TableMetadataToUpdate{
+				ExpirationTime: expirationTime,
+			}, nil
+		}, opt)
+		if err != nil {
+			return fmt.Errorf("failed update expiration %s : %w", table.TableID, err)
+		}
+		result.SourceAction = ShardSourceActionExpired
+		opt.report(ctx, &events.Event{Type: events.Updated, Action: "update Table.ExpirationTime", Resource: table.TableID, After: expirationTime.String(), Retries: updated.Retries})
+	}
+	return nil
+}
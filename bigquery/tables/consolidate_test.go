@@ -0,0 +1,208 @@
+package tables_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+	bqv2 "google.golang.org/api/bigquery/v2"
+)
+
+// fakeConsolidateServer is ConsolidateShardsToPartitionedTableが使うBigQuery APIのFake
+//
+// 全てのJobはすぐにDONEになり、件数を数えるQueryは1件を返す
+type fakeConsolidateServer struct {
+	// shards is TableIDごとのShardのSchema
+	shards map[string][]*bqv2.TableFieldSchema
+
+	mu      sync.Mutex
+	created *bqv2.Table
+	jobs    []*bqv2.JobConfiguration
+}
+
+func (f *fakeConsolidateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	p := r.URL.Path
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(p, "/datasets/d/tables"):
+		var l []map[string]any
+		for id := range f.shards {
+			l = append(l, map[string]any{"tableReference": map[string]string{"projectId": "p", "datasetId": "d", "tableId": id}, "type": "TABLE"})
+		}
+		writeJSON(w, map[string]any{"tables": l})
+	case r.Method == http.MethodGet && strings.Contains(p, "/datasets/d/tables/"):
+		id := p[strings.LastIndex(p, "/")+1:]
+		fields, ok := f.shards[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"message":"not found"}}`)
+			return
+		}
+		writeJSON(w, &bqv2.Table{
+			TableReference: &bqv2.TableReference{ProjectId: "p", DatasetId: "d", TableId: id},
+			Type:           "TABLE",
+			Schema:         &bqv2.TableSchema{Fields: fields},
+			NumRows:        1,
+		})
+	case r.Method == http.MethodPost && strings.HasSuffix(p, "/datasets/d/tables"):
+		var t bqv2.Table
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.created = &t
+		f.mu.Unlock()
+		writeJSON(w, &t)
+	case r.Method == http.MethodPost && strings.HasSuffix(p, "/jobs"):
+		var job bqv2.Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.jobs = append(f.jobs, job.Configuration)
+		f.mu.Unlock()
+		job.Status = &bqv2.JobStatus{State: "DONE"}
+		writeJSON(w, &job)
+	case r.Method == http.MethodGet && strings.Contains(p, "/jobs/"):
+		id := p[strings.LastIndex(p, "/")+1:]
+		writeJSON(w, &bqv2.Job{
+			JobReference: &bqv2.JobReference{ProjectId: "p", JobId: id},
+			Status:       &bqv2.JobStatus{State: "DONE"},
+		})
+	case strings.Contains(p, "/queries"):
+		var req bqv2.QueryRequest
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.mu.Lock()
+			f.jobs = append(f.jobs, &bqv2.JobConfiguration{Query: &bqv2.JobConfigurationQuery{Query: req.Query}})
+			f.mu.Unlock()
+		}
+		writeJSON(w, map[string]any{
+			"jobComplete":  true,
+			"jobReference": map[string]string{"projectId": "p", "jobId": "count"},
+			"totalRows":    "1",
+			"schema":       map[string]any{"fields": []map[string]string{{"name": "c", "type": "INTEGER"}}},
+			"rows":         []map[string]any{{"f": []map[string]string{{"v": "1"}}}},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error":{"code":404,"message":"%s %s"}}`, r.Method, p)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		panic(err)
+	}
+}
+
+func TestConsolidateShardsToPartitionedTableRequiredColumn(t *testing.T) {
+	ctx := context.Background()
+
+	id := &bqv2.TableFieldSchema{Name: "id", Type: "STRING", Mode: "REQUIRED"}
+	name := &bqv2.TableFieldSchema{Name: "name", Type: "STRING", Mode: "NULLABLE"}
+	f := &fakeConsolidateServer{shards: map[string][]*bqv2.TableFieldSchema{
+		"log_20240101": {id},
+		"log_20240102": {id, name},
+	}}
+	s, _ := newFakeTable(t, f)
+
+	results, err := s.ConsolidateShardsToPartitionedTable(ctx, "p", "d", "log_", "log", nil, tables.WithReporter(events.NewCollector()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queryの結果はNULLABLEなので、コピー先のTableにREQUIREDのColumnを作らない
+	if f.created == nil {
+		t.Fatal("destination table was not created")
+	}
+	for _, v := range f.created.Schema.Fields {
+		if v.Mode == "REQUIRED" {
+			t.Errorf("%s want NULLABLE but got REQUIRED", v.Name)
+		}
+	}
+
+	if g, e := len(results), 2; g != e {
+		t.Fatalf("want %d results but got %d", e, g)
+	}
+	for _, v := range results {
+		if g, e := v.Method, tables.ShardCopyMethodQuery; g != e {
+			t.Errorf("%s want %s but got %s", v.TableID, e, g)
+		}
+	}
+	var queries int
+	for _, v := range f.jobs {
+		if v.Query == nil || v.Query.DestinationTable == nil {
+			continue
+		}
+		queries++
+		if g, e := v.Query.WriteDisposition, string(bigquery.WriteTruncate); g != e {
+			t.Errorf("write disposition want %s but got %s", e, g)
+		}
+	}
+	if g, e := queries, 2; g != e {
+		t.Errorf("want %d queries into partitions but got %d", e, g)
+	}
+}
+
+func TestConsolidateShardsToPartitionedTableClustering(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name       string
+		clustering []string
+		want       string
+	}{
+		{"same schema without clustering", nil, tables.ShardCopyMethodCopy},
+		{"clustering", []string{"id"}, tables.ShardCopyMethodQuery},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			id := &bqv2.TableFieldSchema{Name: "id", Type: "STRING", Mode: "NULLABLE"}
+			f := &fakeConsolidateServer{shards: map[string][]*bqv2.TableFieldSchema{
+				"log_20240101": {id},
+			}}
+			s, _ := newFakeTable(t, f)
+
+			cfg := &tables.ConsolidateShardsConfig{ClusteringFields: tt.clustering}
+			results, err := s.ConsolidateShardsToPartitionedTable(ctx, "p", "d", "log_", "log", cfg, tables.WithReporter(events.NewCollector()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g, e := results[0].Method, tt.want; g != e {
+				t.Errorf("want %s but got %s", e, g)
+			}
+			if tt.want != tables.ShardCopyMethodQuery {
+				return
+			}
+			// Clusteringしたコピー先に書き込むQueryにも同じClusteringを指定する
+			var queries int
+			for _, v := range f.jobs {
+				if v.Query == nil || v.Query.DestinationTable == nil {
+					continue
+				}
+				queries++
+				if v.Query.Clustering == nil || !slices.Equal(v.Query.Clustering.Fields, tt.clustering) {
+					t.Errorf("want clustering %v but got %+v", tt.clustering, v.Query.Clustering)
+				}
+			}
+			if queries != 1 {
+				t.Errorf("want 1 query into partition but got %d", queries)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+	"google.golang.org/api/iterator"
+)
+
+// DatasetFilter is 対象にするDatasetの条件
+type DatasetFilter struct {
+	// Pattern is DatasetIDのpattern. path.Matchの書式. eg. logs_*
+	// 空の場合は全てのDatasetが対象
+	Pattern string
+
+	// Labels is Datasetに付いていないといけないLabel
+	// valueが空の場合はkeyが付いていれば対象にする
+	Labels map[string]string
+}
+
+// Match is DatasetIDとLabelが条件に合致するかどうか
+func (f *DatasetFilter) Match(datasetID string, labels map[string]string) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+	if ok, err := f.matchDatasetID(datasetID); err != nil || !ok {
+		return false, err
+	}
+	for k, v := range f.Labels {
+		lv, ok := labels[k]
+		if !ok {
+			return false, nil
+		}
+		if v != "" && v != lv {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (f *DatasetFilter) matchDatasetID(datasetID string) (bool, error) {
+	if f == nil || f.Pattern == "" {
+		return true, nil
+	}
+	ok, err := path.Match(f.Pattern, datasetID)
+	if err != nil {
+		return false, fmt.Errorf("invalid dataset pattern %s : %w", f.Pattern, err)
+	}
+	return ok, nil
+}
+
+// DatasetExpiration is DatasetのDefault Expiration
+type DatasetExpiration struct {
+	ProjectID string `json:"projectID"`
+	DatasetID string `json:"datasetID"`
+
+	// DefaultTableExpiration is 新しく作ったTableに設定されるExpiration. 0の場合は設定されていない
+	DefaultTableExpiration time.Duration `json:"defaultTableExpiration"`
+
+	// DefaultPartitionExpiration is 新しく作ったPartitioned TableのPartitionに設定されるExpiration. 0の場合は設定されていない
+	DefaultPartitionExpiration time.Duration `json:"defaultPartitionExpiration"`
+
+	ETag string `json:"-"`
+}
+
+// DatasetExpirationUpdate is DatasetのDefault Expirationの更新内容
+//
+// nilのものは変更しない. 0を指定すると設定を消す
+type DatasetExpirationUpdate struct {
+	DefaultTableExpiration     *time.Duration
+	DefaultPartitionExpiration *time.Duration
+}
+
+// DatasetExpirationChange is DatasetのDefault Expirationの変更前後
+type DatasetExpirationChange struct {
+	Before  *DatasetExpiration `json:"before"`
+	After   *DatasetExpiration `json:"after"`
+	Changed bool               `json:"changed"`
+}
+
+// ListDatasetExpirations is filterに合致するDatasetのDefault Expirationの一覧をDatasetID順に返す
+func (s *Service) ListDatasetExpirations(ctx context.Context, projectID string, filter *DatasetFilter) ([]*DatasetExpiration, error) {
+	var l []*DatasetExpiration
+	iter := s.bq.Datasets(ctx)
+	iter.ProjectID = projectID
+	for {
+		ds, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed list datasets %s : %w", projectID, err)
+		}
+		// Labelを見るにはMetadataを取らないといけないので、DatasetIDで除外できるものは先に除外する
+		if ok, err := filter.matchDatasetID(ds.DatasetID); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		meta, err := ds.Metadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed get metadata %s.%s : %w", projectID, ds.DatasetID, err)
+		}
+		ok, err := filter.Match(ds.DatasetID, meta.Labels)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		l = append(l, &DatasetExpiration{
+			ProjectID:                  projectID,
+			DatasetID:                  ds.DatasetID,
+			DefaultTableExpiration:     meta.DefaultTableExpiration,
+			DefaultPartitionExpiration: meta.DefaultPartitionExpiration,
+			ETag:                       meta.ETag,
+		})
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].DatasetID < l[j].DatasetID
+	})
+	return l, nil
+}
+
+// UpdateDatasetsDefaultExpiration is filterに合致するDatasetのDefault Expirationをまとめて更新する
+//
+// 更新はETagを指定して行うので、読み込んでから更新までの間にDatasetが変更されていた場合は失敗する
+// 途中で失敗した場合もそれまでの結果は返す
+func (s *Service) UpdateDatasetsDefaultExpiration(ctx context.Context, projectID string, filter *DatasetFilter, update *DatasetExpirationUpdate, ops ...APIOptions) ([]*DatasetExpirationChange, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	l, err := s.ListDatasetExpirations(ctx, projectID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*DatasetExpirationChange
+	for _, before := range l {
+		after := *before
+		var dm bigquery.DatasetMetadataToUpdate
+		if update.DefaultTableExpiration != nil && *update.DefaultTableExpiration != before.DefaultTableExpiration {
+			after.DefaultTableExpiration = *update.DefaultTableExpiration
+			dm.DefaultTableExpiration = *update.DefaultTableExpiration
+		}
+		if update.DefaultPartitionExpiration != nil && *update.DefaultPartitionExpiration != before.DefaultPartitionExpiration {
+			after.DefaultPartitionExpiration = *update.DefaultPartitionExpiration
+			dm.DefaultPartitionExpiration = *update.DefaultPartitionExpiration
+		}
+		change := &DatasetExpirationChange{
+			Before:  before,
+			After:   &after,
+			Changed: dm.DefaultTableExpiration != nil || dm.DefaultPartitionExpiration != nil,
+		}
+		results = append(results, change)
+		if !change.Changed {
+			opt.report(ctx, &events.Event{Type: events.Skipped, Resource: before.DatasetID, Reason: "already default expiration setting"})
+			continue
+		}
+
+		e := &events.Event{
+			Type:     events.Updated,
+			Action:   "update default expiration",
+			Resource: before.DatasetID,
+			Before:   fmt.Sprintf("table=%s partition=%s", before.DefaultTableExpiration, before.DefaultPartitionExpiration),
+			After:    fmt.Sprintf("table=%s partition=%s", after.DefaultTableExpiration, after.DefaultPartitionExpiration),
+			DryRun:   opt.dryRun,
+		}
+		if opt.dryRun {
+			opt.report(ctx, e)
+			continue
+		}
+		if err := opt.waitRateLimit(ctx); err != nil {
+			return results, err
+		}
+		if _, err := s.bq.DatasetInProject(projectID, before.DatasetID).Update(ctx, dm, before.ETag); err != nil {
+			return results, fmt.Errorf("failed update default expiration %s.%s : %w", projectID, before.DatasetID, err)
+		}
+		opt.report(ctx, e)
+	}
+	return results, nil
+}
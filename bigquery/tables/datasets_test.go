@@ -0,0 +1,38 @@
+package tables_test
+
+import (
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestDatasetFilter_Match(t *testing.T) {
+	cases := []struct {
+		name      string
+		filter    *tables.DatasetFilter
+		datasetID string
+		labels    map[string]string
+		want      bool
+	}{
+		{"nil", nil, "logs", nil, true},
+		{"pattern match", &tables.DatasetFilter{Pattern: "logs_*"}, "logs_dev", nil, true},
+		{"pattern not match", &tables.DatasetFilter{Pattern: "logs_*"}, "app", nil, false},
+		{"label value", &tables.DatasetFilter{Labels: map[string]string{"env": "dev"}}, "logs", map[string]string{"env": "dev"}, true},
+		{"label other value", &tables.DatasetFilter{Labels: map[string]string{"env": "dev"}}, "logs", map[string]string{"env": "prod"}, false},
+		{"label key only", &tables.DatasetFilter{Labels: map[string]string{"env": ""}}, "logs", map[string]string{"env": "prod"}, true},
+		{"label missing", &tables.DatasetFilter{Labels: map[string]string{"env": ""}}, "logs", nil, false},
+		{"pattern and label", &tables.DatasetFilter{Pattern: "logs_*", Labels: map[string]string{"env": "dev"}}, "app", map[string]string{"env": "dev"}, false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.Match(tt.datasetID, tt.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("want %t but got %t", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// Dependent is Tableを参照しているView, Materialized View, Routine
+type Dependent struct {
+	ProjectID string `json:"projectID"`
+	DatasetID string `json:"datasetID"`
+	Name      string `json:"name"`
+
+	// Type is VIEW, MATERIALIZED VIEW, FUNCTION, PROCEDURE など
+	Type string `json:"type"`
+
+	// References is 参照している対象のTableID
+	References []string `json:"references"`
+}
+
+// String is project.dataset.name (type) 形式の文字列を返す
+func (d *Dependent) String() string {
+	return fmt.Sprintf("%s.%s.%s (%s)", d.ProjectID, d.DatasetID, d.Name, d.Type)
+}
+
+// TableReference is SQLの中に書かれたTableへの参照
+type TableReference struct {
+	ProjectID string
+	DatasetID string
+
+	// TableID is Wildcard Tableの場合は末尾に*が付く. eg. events_*
+	TableID string
+}
+
+// Match is 参照がprojectID.datasetID.tableIDを指しているかどうか
+//
+// Wildcard Tableの場合は*より前がPrefixとして一致すればtrue
+func (r *TableReference) Match(projectID string, datasetID string, tableID string) bool {
+	if r.ProjectID != projectID || r.DatasetID != datasetID {
+		return false
+	}
+	if p, ok := strings.CutSuffix(r.TableID, "*"); ok {
+		return strings.HasPrefix(tableID, p)
+	}
+	return r.TableID == tableID
+}
+
+var tableReferencePattern = regexp.MustCompile(`[\w-]+(?:\.[\w-]+){1,2}\*?`)
+
+// ParseTableReferences is SQLの中から dataset.table, project.dataset.table 形式の参照を取り出す
+//
+// Projectを省略している参照はdefaultProjectIDとして扱う
+// SQLを構文解析しているわけではないので、Columnの参照やコメントの中の文字列も含まれる
+func ParseTableReferences(sql string, defaultProjectID string) []*TableReference {
+	sql = strings.ReplaceAll(sql, "`", "")
+	var refs []*TableReference
+	for _, v := range tableReferencePattern.FindAllString(sql, -1) {
+		parts := strings.Split(v, ".")
+		ref := &TableReference{ProjectID: defaultProjectID}
+		switch len(parts) {
+		case 2:
+			ref.DatasetID, ref.TableID = parts[0], parts[1]
+		case 3:
+			ref.ProjectID, ref.DatasetID, ref.TableID = parts[0], parts[1], parts[2]
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+type dependentRow struct {
+	ProjectID  string `bigquery:"project_id"`
+	DatasetID  string `bigquery:"dataset_id"`
+	Name       string `bigquery:"name"`
+	Type       string `bigquery:"type"`
+	Definition string `bigquery:"definition"`
+}
+
+// FindDependents is projectID内のView, Materialized View, Routineの定義を見て、datasetIDのtableIDsを参照しているものを返す
+//
+// 対象はdatasetIDと同じRegionにあるprojectID内のView, Routineだけなので、別のProjectやScheduled Queryからの参照は検出できない
+// tableIDsに含まれるView自身は返さない
+func (s *Service) FindDependents(ctx context.Context, projectID string, datasetID string, tableIDs []string) ([]*Dependent, error) {
+	if len(tableIDs) == 0 {
+		return nil, nil
+	}
+
+	meta, err := s.bq.DatasetInProject(projectID, datasetID).Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	region := RegionQualifier(meta.Location)
+
+	// Datasetの名前が含まれていない定義は参照しようがないので、Query側で絞り込んでおく
+	sql := fmt.Sprintf("SELECT * FROM (\n"+
+		"  SELECT table_catalog AS project_id, table_schema AS dataset_id, table_name AS name, table_type AS type, ddl AS definition\n"+
+		"  FROM `%[1]s`.`%[2]s`.INFORMATION_SCHEMA.TABLES\n"+
+		"  WHERE table_type IN ('VIEW', 'MATERIALIZED VIEW')\n"+
+		"  UNION ALL\n"+
+		"  SELECT routine_catalog, routine_schema, routine_name, routine_type, IFNULL(routine_definition, '')\n"+
+		"  FROM `%[1]s`.`%[2]s`.INFORMATION_SCHEMA.ROUTINES\n"+
+		")\n"+
+		"WHERE STRPOS(definition, @dataset) > 0\n"+
+		"ORDER BY project_id, dataset_id, name", projectID, region)
+	q := s.bq.Query(sql)
+	q.Location = meta.Location
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "dataset", Value: datasetID},
+	}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed query views and routines : %w", err)
+	}
+
+	targets := map[string]bool{}
+	for _, v := range tableIDs {
+		targets[v] = true
+	}
+	var results []*Dependent
+	for {
+		var row dependentRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row.ProjectID == projectID && row.DatasetID == datasetID && targets[row.Name] {
+			continue
+		}
+		refs := dependentReferences(row.Definition, row.ProjectID, projectID, datasetID, tableIDs)
+		if len(refs) == 0 {
+			continue
+		}
+		results = append(results, &Dependent{
+			ProjectID:  row.ProjectID,
+			DatasetID:  row.DatasetID,
+			Name:       row.Name,
+			Type:       row.Type,
+			References: refs,
+		})
+	}
+	return results, nil
+}
+
+// dependentReferences is definitionが参照しているtableIDsを昇順で返す
+func dependentReferences(definition string, defaultProjectID string, projectID string, datasetID string, tableIDs []string) []string {
+	refs := ParseTableReferences(definition, defaultProjectID)
+	var results []string
+	for _, tableID := range tableIDs {
+		for _, ref := range refs {
+			if ref.Match(projectID, datasetID, tableID) {
+				results = append(results, tableID)
+				break
+			}
+		}
+	}
+	sort.Strings(results)
+	return results
+}
@@ -0,0 +1,52 @@
+package tables_test
+
+import (
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestParseTableReferences(t *testing.T) {
+	sql := "SELECT * FROM `other-project.logs.access_20240101` UNION ALL\n" +
+		"SELECT * FROM logs.access_20240102 UNION ALL\n" +
+		"SELECT * FROM `my-project`.`logs`.`events_*`"
+	got := tables.ParseTableReferences(sql, "my-project")
+
+	want := []tables.TableReference{
+		{ProjectID: "other-project", DatasetID: "logs", TableID: "access_20240101"},
+		{ProjectID: "my-project", DatasetID: "logs", TableID: "access_20240102"},
+		{ProjectID: "my-project", DatasetID: "logs", TableID: "events_*"},
+	}
+	if g, e := len(got), len(want); g != e {
+		t.Fatalf("want %d references but got %d", e, g)
+	}
+	for i, e := range want {
+		if g := *got[i]; g != e {
+			t.Errorf("[%d] want %+v but got %+v", i, e, g)
+		}
+	}
+}
+
+func TestTableReference_Match(t *testing.T) {
+	cases := []struct {
+		name    string
+		ref     tables.TableReference
+		tableID string
+		want    bool
+	}{
+		{"same", tables.TableReference{ProjectID: "p", DatasetID: "d", TableID: "t_20240101"}, "t_20240101", true},
+		{"other table", tables.TableReference{ProjectID: "p", DatasetID: "d", TableID: "t_20240101"}, "t_20240102", false},
+		{"other dataset", tables.TableReference{ProjectID: "p", DatasetID: "x", TableID: "t_20240101"}, "t_20240101", false},
+		{"other project", tables.TableReference{ProjectID: "x", DatasetID: "d", TableID: "t_20240101"}, "t_20240101", false},
+		{"wildcard", tables.TableReference{ProjectID: "p", DatasetID: "d", TableID: "t_*"}, "t_20240101", true},
+		{"wildcard not match", tables.TableReference{ProjectID: "p", DatasetID: "d", TableID: "u_*"}, "t_20240101", false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if g, e := tt.ref.Match("p", "d", tt.tableID), tt.want; g != e {
+				t.Errorf("want %t but got %t", e, g)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+	"google.golang.org/api/iterator"
+)
+
+// PropertyDiff is TableやDatasetのSchema以外の設定の差分
+type PropertyDiff struct {
+	// Name is 設定の名前. eg. timePartitioning, clustering, description, labels
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// TableDiff is 2つのTableの差分
+type TableDiff struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+
+	Fields     []*schemas.FieldDiff `json:"fields,omitempty"`
+	Properties []*PropertyDiff      `json:"properties,omitempty"`
+}
+
+// HasDiff is 差分があるかどうか
+func (d *TableDiff) HasDiff() bool {
+	return len(d.Fields) > 0 || len(d.Properties) > 0
+}
+
+// DatasetDiff is 2つのDatasetの差分
+type DatasetDiff struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+
+	// MissingTables is Beforeには存在するが、Afterには存在しないTable
+	MissingTables []string `json:"missingTables,omitempty"`
+
+	// ExtraTables is Beforeには存在しないが、Afterには存在するTable
+	ExtraTables []string `json:"extraTables,omitempty"`
+
+	Properties []*PropertyDiff `json:"properties,omitempty"`
+
+	// Tables is 両方に存在し、差分があるTable
+	Tables []*TableDiff `json:"tables,omitempty"`
+}
+
+// HasDiff is 差分があるかどうか
+func (d *DatasetDiff) HasDiff() bool {
+	return len(d.MissingTables) > 0 || len(d.ExtraTables) > 0 || len(d.Properties) > 0 || len(d.Tables) > 0
+}
+
+// DiffTables is beforeのTableからafterのTableへの差分を返す
+//
+// Schema, Tableの種類, Partitioning, Clustering, Description, Labelsを比較する
+// Expirationは環境ごとに異なることが多いので比較しない
+func (s *Service) DiffTables(ctx context.Context, before *bigquery.Table, after *bigquery.Table) (*TableDiff, error) {
+	bm, err := before.Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get metadata %s : %w", before.FullyQualifiedName(), err)
+	}
+	am, err := after.Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get metadata %s : %w", after.FullyQualifiedName(), err)
+	}
+
+	d := &TableDiff{
+		Before: before.FullyQualifiedName(),
+		After:  after.FullyQualifiedName(),
+		Fields: schemas.Diff(bm.Schema, am.Schema),
+	}
+	d.Properties = diffProperties(
+		[]*PropertyDiff{
+			{Name: "type", Before: string(bm.Type), After: string(am.Type)},
+			{Name: "timePartitioning", Before: timePartitioningString(bm.TimePartitioning), After: timePartitioningString(am.TimePartitioning)},
+			{Name: "rangePartitioning", Before: rangePartitioningString(bm.RangePartitioning), After: rangePartitioningString(am.RangePartitioning)},
+			{Name: "clustering", Before: clusteringString(bm.Clustering), After: clusteringString(am.Clustering)},
+			{Name: "description", Before: bm.Description, After: am.Description},
+			{Name: "labels", Before: LabelsString(bm.Labels), After: LabelsString(am.Labels)},
+		})
+	return d, nil
+}
+
+// DiffDatasets is beforeのDatasetからafterのDatasetへの差分を返す
+//
+// 両方に存在するTableはDiffTablesで比較する
+func (s *Service) DiffDatasets(ctx context.Context, before *bigquery.Dataset, after *bigquery.Dataset) (*DatasetDiff, error) {
+	bm, err := before.Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get metadata %s.%s : %w", before.ProjectID, before.DatasetID, err)
+	}
+	am, err := after.Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get metadata %s.%s : %w", after.ProjectID, after.DatasetID, err)
+	}
+
+	d := &DatasetDiff{
+		Before: fmt.Sprintf("%s.%s", before.ProjectID, before.DatasetID),
+		After:  fmt.Sprintf("%s.%s", after.ProjectID, after.DatasetID),
+	}
+	d.Properties = diffProperties(
+		[]*PropertyDiff{
+			{Name: "location", Before: bm.Location, After: am.Location},
+			{Name: "description", Before: bm.Description, After: am.Description},
+			{Name: "labels", Before: LabelsString(bm.Labels), After: LabelsString(am.Labels)},
+		})
+
+	beforeTables, err := listTableIDs(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	afterTables, err := listTableIDs(ctx, after)
+	if err != nil {
+		return nil, err
+	}
+	beforeSet := map[string]bool{}
+	for _, tableID := range beforeTables {
+		beforeSet[tableID] = true
+	}
+	afterSet := map[string]bool{}
+	for _, tableID := range afterTables {
+		afterSet[tableID] = true
+	}
+	for _, tableID := range beforeTables {
+		if !afterSet[tableID] {
+			d.MissingTables = append(d.MissingTables, tableID)
+			continue
+		}
+		td, err := s.DiffTables(ctx, before.Table(tableID), after.Table(tableID))
+		if err != nil {
+			return nil, err
+		}
+		if td.HasDiff() {
+			d.Tables = append(d.Tables, td)
+		}
+	}
+	for _, tableID := range afterTables {
+		if !beforeSet[tableID] {
+			d.ExtraTables = append(d.ExtraTables, tableID)
+		}
+	}
+	return d, nil
+}
+
+// LabelsString is Labelをkeyでsortして key=value,key=value 形式の文字列にする
+func LabelsString(labels map[string]string) string {
+	var l []string
+	for k, v := range labels {
+		l = append(l, fmt.Sprintf("%s=%s", k, v))
+	}
+	slices.Sort(l)
+	return strings.Join(l, ",")
+}
+
+func listTableIDs(ctx context.Context, ds *bigquery.Dataset) ([]string, error) {
+	var l []string
+	iter := ds.Tables(ctx)
+	for {
+		t, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed list tables %s.%s : %w", ds.ProjectID, ds.DatasetID, err)
+		}
+		l = append(l, t.TableID)
+	}
+	slices.Sort(l)
+	return l, nil
+}
+
+// diffProperties is BeforeとAfterが異なるものだけを返す
+func diffProperties(l []*PropertyDiff) []*PropertyDiff {
+	var diffs []*PropertyDiff
+	for _, v := range l {
+		if v.Before != v.After {
+			diffs = append(diffs, v)
+		}
+	}
+	return diffs
+}
+
+func timePartitioningString(p *bigquery.TimePartitioning) string {
+	if p == nil {
+		return ""
+	}
+	field := p.Field
+	if field == "" {
+		field = "_PARTITIONTIME"
+	}
+	return fmt.Sprintf("%s field=%s requirePartitionFilter=%t", p.Type, field, p.RequirePartitionFilter)
+}
+
+func rangePartitioningString(p *bigquery.RangePartitioning) string {
+	if p == nil {
+		return ""
+	}
+	if p.Range == nil {
+		return fmt.Sprintf("field=%s", p.Field)
+	}
+	return fmt.Sprintf("field=%s start=%d end=%d interval=%d", p.Field, p.Range.Start, p.Range.End, p.Range.Interval)
+}
+
+func clusteringString(c *bigquery.Clustering) string {
+	if c == nil {
+		return ""
+	}
+	return strings.Join(c.Fields, ",")
+}
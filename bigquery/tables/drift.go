@@ -0,0 +1,78 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+)
+
+// SchemaPeriod is 同じSchemaが続いている日付Shardの期間
+type SchemaPeriod struct {
+	// Version is Schemaの種類ごとに最初に出現した順に1から振った番号. 一度変わったSchemaに戻った場合は同じ番号になる
+	Version     int    `json:"version"`
+	Fingerprint string `json:"fingerprint"`
+
+	StartTableID string    `json:"startTableID"`
+	EndTableID   string    `json:"endTableID"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	ShardCount   int       `json:"shardCount"`
+
+	// Changes is 1つ前の期間のSchemaからの差分. 最初の期間は空
+	Changes []*schemas.FieldDiff `json:"changes,omitempty"`
+
+	// OrderChanged is 1つ前の期間のSchemaと両方に存在するFieldの順番が異なる. Changesがある場合も判定する
+	OrderChanged bool `json:"orderChanged,omitempty"`
+
+	schema bigquery.Schema
+}
+
+// DetectSchemaDrift is tablePrefixに合致する日付ShardingされたTableを日付順に見て、Schemaが変わった期間ごとに返す
+func (s *Service) DetectSchemaDrift(ctx context.Context, projectID string, datasetID string, tablePrefix string) ([]*SchemaPeriod, error) {
+	shards, err := s.ListShards(ctx, projectID, datasetID, tablePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := s.bq.DatasetInProject(projectID, datasetID)
+	versions := map[string]int{}
+	var periods []*SchemaPeriod
+	var current *SchemaPeriod
+	for _, shard := range shards {
+		meta, err := ds.Table(shard.TableID).Metadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed get metadata %s : %w", shard.TableID, err)
+		}
+		fp := schemas.Fingerprint(meta.Schema)
+		if current != nil && current.Fingerprint == fp {
+			current.EndTableID = shard.TableID
+			current.End = shard.Date
+			current.ShardCount++
+			continue
+		}
+
+		if _, ok := versions[fp]; !ok {
+			versions[fp] = len(versions) + 1
+		}
+		next := &SchemaPeriod{
+			Version:      versions[fp],
+			Fingerprint:  fp,
+			StartTableID: shard.TableID,
+			EndTableID:   shard.TableID,
+			Start:        shard.Date,
+			End:          shard.Date,
+			ShardCount:   1,
+			schema:       meta.Schema,
+		}
+		if current != nil {
+			next.Changes = schemas.Diff(current.schema, meta.Schema)
+			next.OrderChanged = schemas.OrderChanged(current.schema, meta.Schema)
+		}
+		periods = append(periods, next)
+		current = next
+	}
+	return periods, nil
+}
@@ -0,0 +1,26 @@
+package tables
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+)
+
+// UpdateBackoff is テストからupdateBackoffを呼ぶために公開する
+var UpdateBackoff = updateBackoff
+
+// UpdateTablesInOrder is テストからupdateTablesInOrderを呼ぶために公開する
+func UpdateTablesInOrder(ctx context.Context, nextTable func() (*bigquery.Table, error), update func(table *bigquery.Table) (*events.Event, error), ops ...APIOptions) error {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+	return updateTablesInOrder(ctx, nextTable, update, &opt)
+}
+
+// NewTableInventory is テストからnewTableInventoryを呼ぶために公開する
+var NewTableInventory = newTableInventory
+
+// SmallShardTargets is テストからsmallShardTargetsを呼ぶために公開する
+var SmallShardTargets = smallShardTargets
@@ -0,0 +1,236 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultSmallShardRatio is 前後のShardの中央値に対してこの割合より小さいShardを小さいとみなす
+	DefaultSmallShardRatio = 0.5
+
+	// DefaultSmallShardWindow is 小さいShardを判定する時に比較する前後それぞれのShardの数
+	DefaultSmallShardWindow = 3
+)
+
+// ShardGap is 日付ShardingされたTableで、連続して欠けている日付の範囲
+type ShardGap struct {
+	// From is 欠けている最初の日. この日を含む
+	From time.Time `json:"from"`
+
+	// To is 欠けている最後の日. この日を含む
+	To time.Time `json:"to"`
+
+	Days int `json:"days"`
+}
+
+// ShardSize is Shardの大きさ
+type ShardSize struct {
+	TableID  string    `json:"tableID"`
+	Date     time.Time `json:"date"`
+	NumRows  uint64    `json:"numRows"`
+	NumBytes int64     `json:"numBytes"`
+}
+
+// SmallShard is 前後のShardに比べて小さいShard
+type SmallShard struct {
+	*ShardSize
+
+	// NeighborMedianBytes is 前後のShardのByte数の中央値
+	NeighborMedianBytes int64 `json:"neighborMedianBytes"`
+
+	// Ratio is NeighborMedianBytesに対するByte数の割合
+	Ratio float64 `json:"ratio"`
+}
+
+// ShardGapConfig is DetectShardGapsの設定
+type ShardGapConfig struct {
+	// From is 確認する最初の日. Zeroの場合は最初のShardの日
+	From time.Time
+
+	// To is 確認する最後の日. この日を含む. Zeroの場合は最後のShardの日
+	To time.Time
+
+	// SmallRatio is 前後のShardの中央値に対してこの割合より小さいShardを小さいとみなす. 0以下の場合は確認しない
+	SmallRatio float64
+
+	// SmallWindow is 小さいShardを判定する時に比較する前後それぞれのShardの数. 0の場合はDefaultSmallShardWindow
+	SmallWindow int
+}
+
+// ShardGapReport is 日付ShardingされたTableの欠けている日付と小さいShard
+type ShardGapReport struct {
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	ShardCount  int           `json:"shardCount"`
+	MissingDays int           `json:"missingDays"`
+	Gaps        []*ShardGap   `json:"gaps"`
+	SmallShards []*SmallShard `json:"smallShards"`
+}
+
+// DetectShardGaps is tablePrefixに合致する日付ShardingされたTableの欠けている日付と、前後に比べて小さいShardを返す
+//
+// 範囲の前後window個ずつのShardは小さいShardの判定の比較には使うが、結果には含めない
+func (s *Service) DetectShardGaps(ctx context.Context, projectID string, datasetID string, tablePrefix string, cfg *ShardGapConfig) (*ShardGapReport, error) {
+	shards, err := s.ListShards(ctx, projectID, datasetID, tablePrefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("shard not found. prefix=%s", tablePrefix)
+	}
+
+	report := &ShardGapReport{
+		From: cfg.From,
+		To:   cfg.To,
+	}
+	if report.From.IsZero() {
+		report.From = shards[0].Date
+	}
+	if report.To.IsZero() {
+		report.To = shards[len(shards)-1].Date
+	}
+	var dates []time.Time
+	for _, v := range shards {
+		if inDateRange(v.Date, report.From, report.To) {
+			dates = append(dates, v.Date)
+		}
+	}
+	report.ShardCount = len(dates)
+	report.Gaps = FindShardGaps(dates, report.From, report.To)
+	for _, v := range report.Gaps {
+		report.MissingDays += v.Days
+	}
+
+	if cfg.SmallRatio <= 0 {
+		return report, nil
+	}
+	window := cfg.SmallWindow
+	if window <= 0 {
+		window = DefaultSmallShardWindow
+	}
+	targets := smallShardTargets(shards, report.From, report.To, window)
+	if len(targets) == 0 {
+		return report, nil
+	}
+	ds := s.bq.DatasetInProject(projectID, datasetID)
+	sizes := make([]*ShardSize, 0, len(targets))
+	for _, shard := range targets {
+		meta, err := ds.Table(shard.TableID).Metadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed get metadata %s : %w", shard.TableID, err)
+		}
+		sizes = append(sizes, &ShardSize{
+			TableID:  shard.TableID,
+			Date:     shard.Date,
+			NumRows:  meta.NumRows,
+			NumBytes: meta.NumBytes,
+		})
+	}
+	for _, v := range FindSmallShards(sizes, window, cfg.SmallRatio) {
+		if inDateRange(v.Date, report.From, report.To) {
+			report.SmallShards = append(report.SmallShards, v)
+		}
+	}
+	return report, nil
+}
+
+// smallShardTargets is 小さいShardの判定に大きさが必要な、fromからtoまでのShardとその前後window個ずつのShardを返す
+//
+// shardsは日付の昇順に並んでいる必要がある. 範囲内にShardが無い場合は空
+func smallShardTargets(shards []*Shard, from time.Time, to time.Time, window int) []*Shard {
+	first, last := -1, -1
+	for i, v := range shards {
+		if !inDateRange(v.Date, from, to) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 {
+		return nil
+	}
+	return shards[max(0, first-window):min(len(shards), last+window+1)]
+}
+
+func inDateRange(date time.Time, from time.Time, to time.Time) bool {
+	return !date.Before(from) && !date.After(to)
+}
+
+// FindShardGaps is fromからtoまでの日付で、datesに含まれない連続した日付の範囲を返す
+//
+// datesは日付の昇順に並んでいる必要はない
+func FindShardGaps(dates []time.Time, from time.Time, to time.Time) []*ShardGap {
+	exists := map[time.Time]bool{}
+	for _, v := range dates {
+		exists[truncateDate(v)] = true
+	}
+
+	var gaps []*ShardGap
+	var current *ShardGap
+	for d := truncateDate(from); !d.After(truncateDate(to)); d = d.AddDate(0, 0, 1) {
+		if exists[d] {
+			current = nil
+			continue
+		}
+		if current == nil {
+			current = &ShardGap{From: d}
+			gaps = append(gaps, current)
+		}
+		current.To = d
+		current.Days++
+	}
+	return gaps
+}
+
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// FindSmallShards is 前後window個ずつのShardのByte数の中央値に対して、ratioより小さいShardを返す
+//
+// sizesは日付の昇順に並んでいる必要がある. 比較できるShardが無い場合は判定しない
+func FindSmallShards(sizes []*ShardSize, window int, ratio float64) []*SmallShard {
+	var results []*SmallShard
+	for i, v := range sizes {
+		var neighbors []int64
+		for j := max(0, i-window); j <= min(len(sizes)-1, i+window); j++ {
+			if j == i {
+				continue
+			}
+			neighbors = append(neighbors, sizes[j].NumBytes)
+		}
+		if len(neighbors) == 0 {
+			continue
+		}
+		median := medianInt64(neighbors)
+		if median <= 0 {
+			continue
+		}
+		r := float64(v.NumBytes) / float64(median)
+		if r < ratio {
+			results = append(results, &SmallShard{
+				ShardSize:           v,
+				NeighborMedianBytes: median,
+				Ratio:               r,
+			})
+		}
+	}
+	return results
+}
+
+func medianInt64(l []int64) int64 {
+	sorted := append([]int64(nil), l...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,109 @@
+package tables_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestFindShardGaps(t *testing.T) {
+	dates := []time.Time{
+		date(2024, 1, 5),
+		date(2024, 1, 1),
+		date(2024, 1, 2),
+		date(2024, 1, 6),
+	}
+
+	cases := []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		wantFrom []time.Time
+		wantDays []int
+	}{
+		{"between shards", date(2024, 1, 1), date(2024, 1, 6), []time.Time{date(2024, 1, 3)}, []int{2}},
+		{"range", date(2023, 12, 31), date(2024, 1, 8), []time.Time{date(2023, 12, 31), date(2024, 1, 3), date(2024, 1, 7)}, []int{1, 2, 2}},
+		{"no gap", date(2024, 1, 1), date(2024, 1, 2), nil, nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tables.FindShardGaps(dates, tt.from, tt.to)
+			if g, e := len(got), len(tt.wantFrom); g != e {
+				t.Fatalf("want %d gaps but got %d", e, g)
+			}
+			for i, v := range got {
+				if !v.From.Equal(tt.wantFrom[i]) || v.Days != tt.wantDays[i] {
+					t.Errorf("[%d] want from %s %d days but got from %s %d days", i, tt.wantFrom[i], tt.wantDays[i], v.From, v.Days)
+				}
+				if e := v.From.AddDate(0, 0, v.Days-1); !v.To.Equal(e) {
+					t.Errorf("[%d] want to %s but got %s", i, e, v.To)
+				}
+			}
+		})
+	}
+}
+
+func TestFindSmallShards(t *testing.T) {
+	bytes := []int64{100, 110, 90, 10, 105, 95, 100}
+	var sizes []*tables.ShardSize
+	for i, v := range bytes {
+		sizes = append(sizes, &tables.ShardSize{TableID: "t", Date: date(2024, 1, i+1), NumBytes: v})
+	}
+
+	got := tables.FindSmallShards(sizes, 3, 0.5)
+	if len(got) != 1 {
+		t.Fatalf("want 1 small shard but got %d", len(got))
+	}
+	if e, g := date(2024, 1, 4), got[0].Date; !e.Equal(g) {
+		t.Errorf("want %s but got %s", e, g)
+	}
+	if e, g := int64(100), got[0].NeighborMedianBytes; e != g {
+		t.Errorf("want %d but got %d", e, g)
+	}
+}
+
+func TestSmallShardTargets(t *testing.T) {
+	var shards []*tables.Shard
+	for day := 1; day <= 10; day++ {
+		d := date(2024, 1, day)
+		shards = append(shards, &tables.Shard{TableID: "log_" + d.Format("20060102"), Date: d})
+	}
+
+	cases := []struct {
+		name      string
+		from      time.Time
+		to        time.Time
+		window    int
+		wantFirst string
+		wantLast  string
+	}{
+		{"middle", date(2024, 1, 5), date(2024, 1, 6), 2, "log_20240103", "log_20240108"},
+		{"edges", date(2024, 1, 1), date(2024, 1, 10), 3, "log_20240101", "log_20240110"},
+		{"near the start", date(2024, 1, 2), date(2024, 1, 2), 3, "log_20240101", "log_20240105"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tables.SmallShardTargets(shards, tt.from, tt.to, tt.window)
+			if len(got) == 0 {
+				t.Fatalf("want shards but got empty")
+			}
+			if g, e := got[0].TableID, tt.wantFirst; g != e {
+				t.Errorf("first want %s but got %s", e, g)
+			}
+			if g, e := got[len(got)-1].TableID, tt.wantLast; g != e {
+				t.Errorf("last want %s but got %s", e, g)
+			}
+		})
+	}
+
+	if got := tables.SmallShardTargets(shards, date(2024, 2, 1), date(2024, 2, 5), 3); len(got) != 0 {
+		t.Errorf("out of range want empty but got %d", len(got))
+	}
+}
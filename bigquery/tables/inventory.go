@@ -0,0 +1,258 @@
+package tables
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// TableInventory is ある時点でのTableのMetadata
+type TableInventory struct {
+	ProjectID string `json:"projectID"`
+	DatasetID string `json:"datasetID"`
+	TableID   string `json:"tableID"`
+	Location  string `json:"location"`
+
+	// Type is TABLE, VIEW, MATERIALIZED_VIEW, EXTERNAL, SNAPSHOT
+	Type string `json:"type"`
+
+	// PartitioningType is DAY, HOUR, MONTH, YEAR, RANGE. Partitioned Tableでない場合は空
+	PartitioningType string `json:"partitioningType,omitempty"`
+
+	// PartitioningField is Partitioningに使っているColumn. Ingestion Time Partitioningの場合は空
+	PartitioningField string   `json:"partitioningField,omitempty"`
+	ClusteringFields  []string `json:"clusteringFields,omitempty"`
+
+	NumRows               uint64 `json:"numRows"`
+	LogicalBytes          int64  `json:"logicalBytes"`
+	LongTermLogicalBytes  int64  `json:"longTermLogicalBytes"`
+	PhysicalBytes         int64  `json:"physicalBytes"`
+	LongTermPhysicalBytes int64  `json:"longTermPhysicalBytes"`
+
+	CreationTime     time.Time `json:"creationTime"`
+	LastModifiedTime time.Time `json:"lastModifiedTime"`
+
+	// ExpirationTime is Expirationが設定されていない場合はnil
+	ExpirationTime *time.Time `json:"expirationTime,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// SnapshotTime is Inventoryを作成した時間
+	SnapshotTime time.Time `json:"snapshotTime"`
+}
+
+type tablePhysicalStorageRow struct {
+	TableSchema           string `bigquery:"table_schema"`
+	TableName             string `bigquery:"table_name"`
+	TotalPhysicalBytes    int64  `bigquery:"total_physical_bytes"`
+	LongTermPhysicalBytes int64  `bigquery:"long_term_physical_bytes"`
+}
+
+type tablePhysicalStorage struct {
+	total    int64
+	longTerm int64
+}
+
+// ExportInventory is filterに合致するDatasetの全てのTableのTableInventoryを1行に1つのJSONでwに書き込み、書き込んだ数を返す
+//
+// Physical BytesはTable MetadataのAPIでは取れないので、INFORMATION_SCHEMA.TABLE_STORAGEから取る
+// WithConcurrencyでTable Metadataを並列に取得する
+func (s *Service) ExportInventory(ctx context.Context, w io.Writer, projectID string, filter *DatasetFilter, ops ...APIOptions) (int, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+	snapshotTime := time.Now()
+
+	type dataset struct {
+		id       string
+		location string
+	}
+	var datasets []*dataset
+	storages := map[string]map[string]*tablePhysicalStorage{}
+	iter := s.bq.Datasets(ctx)
+	iter.ProjectID = projectID
+	for {
+		ds, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("failed list datasets %s : %w", projectID, err)
+		}
+		if ok, err := filter.matchDatasetID(ds.DatasetID); err != nil {
+			return 0, err
+		} else if !ok {
+			continue
+		}
+		meta, err := ds.Metadata(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed get metadata %s.%s : %w", projectID, ds.DatasetID, err)
+		}
+		if ok, err := filter.Match(ds.DatasetID, meta.Labels); err != nil {
+			return 0, err
+		} else if !ok {
+			continue
+		}
+		datasets = append(datasets, &dataset{id: ds.DatasetID, location: meta.Location})
+		storages[meta.Location] = nil
+	}
+	for loc := range storages {
+		v, err := s.readTablePhysicalStorage(ctx, projectID, loc)
+		if err != nil {
+			return 0, err
+		}
+		storages[loc] = v
+	}
+
+	enc := json.NewEncoder(w)
+	var count int
+	for _, ds := range datasets {
+		l, err := s.datasetInventory(ctx, projectID, ds.id, &opt)
+		if err != nil {
+			return count, err
+		}
+		for _, v := range l {
+			v.Location = ds.location
+			v.SnapshotTime = snapshotTime
+			if st, ok := storages[ds.location][fmt.Sprintf("%s.%s", ds.id, v.TableID)]; ok {
+				v.PhysicalBytes = st.total
+				v.LongTermPhysicalBytes = st.longTerm
+			}
+			if err := enc.Encode(v); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// datasetInventory is Datasetの全てのTableのMetadataを取得して、TableIDの一覧の順番で返す
+func (s *Service) datasetInventory(ctx context.Context, projectID string, datasetID string, opt *apiOptions) ([]*TableInventory, error) {
+	var tableList []*bigquery.Table
+	iter := s.bq.DatasetInProject(projectID, datasetID).Tables(ctx)
+	for {
+		t, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed list tables %s.%s : %w", projectID, datasetID, err)
+		}
+		tableList = append(tableList, t)
+	}
+
+	concurrency := opt.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]*TableInventory, len(tableList))
+	errs := make([]error, len(tableList))
+	indexes := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				t := tableList[index]
+				meta, err := t.Metadata(ctx)
+				if isNotFound(err) {
+					// 一覧を取ってから削除されたTableは含めない
+					continue
+				} else if err != nil {
+					errs[index] = fmt.Errorf("failed get metadata %s.%s.%s : %w", projectID, datasetID, t.TableID, err)
+					continue
+				}
+				results[index] = newTableInventory(projectID, datasetID, t.TableID, meta)
+			}
+		}()
+	}
+	for i := range tableList {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var l []*TableInventory
+	for i, v := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if v != nil {
+			l = append(l, v)
+		}
+	}
+	return l, nil
+}
+
+func newTableInventory(projectID string, datasetID string, tableID string, meta *bigquery.TableMetadata) *TableInventory {
+	v := &TableInventory{
+		ProjectID:            projectID,
+		DatasetID:            datasetID,
+		TableID:              tableID,
+		Type:                 string(meta.Type),
+		NumRows:              meta.NumRows,
+		LogicalBytes:         meta.NumBytes,
+		LongTermLogicalBytes: meta.NumLongTermBytes,
+		CreationTime:         meta.CreationTime,
+		LastModifiedTime:     meta.LastModifiedTime,
+		Labels:               meta.Labels,
+	}
+	if meta.TimePartitioning != nil {
+		v.PartitioningType = string(meta.TimePartitioning.Type)
+		if v.PartitioningType == "" {
+			v.PartitioningType = string(bigquery.DayPartitioningType)
+		}
+		v.PartitioningField = meta.TimePartitioning.Field
+	} else if meta.RangePartitioning != nil {
+		v.PartitioningType = "RANGE"
+		v.PartitioningField = meta.RangePartitioning.Field
+	}
+	if meta.Clustering != nil {
+		v.ClusteringFields = meta.Clustering.Fields
+	}
+	if !meta.ExpirationTime.IsZero() {
+		expirationTime := meta.ExpirationTime
+		v.ExpirationTime = &expirationTime
+	}
+	return v
+}
+
+// readTablePhysicalStorage is locationのINFORMATION_SCHEMA.TABLE_STORAGEからTableごとのPhysical Bytesを読み込む
+//
+// keyは dataset.table
+func (s *Service) readTablePhysicalStorage(ctx context.Context, projectID string, location string) (map[string]*tablePhysicalStorage, error) {
+	sql := fmt.Sprintf("SELECT table_schema, table_name,\n"+
+		"  IFNULL(total_physical_bytes, 0) AS total_physical_bytes,\n"+
+		"  IFNULL(long_term_physical_bytes, 0) AS long_term_physical_bytes\n"+
+		"FROM `%s`.`%s`.INFORMATION_SCHEMA.TABLE_STORAGE\n"+
+		"WHERE NOT IFNULL(deleted, FALSE)", projectID, RegionQualifier(location))
+	q := s.bq.Query(sql)
+	q.Location = location
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed query table storage %s : %w", location, err)
+	}
+	results := map[string]*tablePhysicalStorage{}
+	for {
+		var row tablePhysicalStorageRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		results[fmt.Sprintf("%s.%s", row.TableSchema, row.TableName)] = &tablePhysicalStorage{
+			total:    row.TotalPhysicalBytes,
+			longTerm: row.LongTermPhysicalBytes,
+		}
+	}
+	return results, nil
+}
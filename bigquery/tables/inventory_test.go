@@ -0,0 +1,122 @@
+package tables_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestNewTableInventory(t *testing.T) {
+	creationTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expirationTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		meta *bigquery.TableMetadata
+		want *tables.TableInventory
+	}{
+		{"regular table",
+			&bigquery.TableMetadata{
+				Type:             bigquery.RegularTable,
+				NumRows:          10,
+				NumBytes:         100,
+				NumLongTermBytes: 50,
+				CreationTime:     creationTime,
+				LastModifiedTime: creationTime,
+			},
+			&tables.TableInventory{
+				Type:                 "TABLE",
+				NumRows:              10,
+				LogicalBytes:         100,
+				LongTermLogicalBytes: 50,
+				CreationTime:         creationTime,
+				LastModifiedTime:     creationTime,
+			},
+		},
+		{"time partitioning without type is DAY",
+			&bigquery.TableMetadata{
+				Type:             bigquery.RegularTable,
+				TimePartitioning: &bigquery.TimePartitioning{Field: "created_at"},
+			},
+			&tables.TableInventory{
+				Type:              "TABLE",
+				PartitioningType:  "DAY",
+				PartitioningField: "created_at",
+			},
+		},
+		{"hour partitioning by ingestion time",
+			&bigquery.TableMetadata{
+				Type:             bigquery.RegularTable,
+				TimePartitioning: &bigquery.TimePartitioning{Type: bigquery.HourPartitioningType},
+			},
+			&tables.TableInventory{
+				Type:             "TABLE",
+				PartitioningType: "HOUR",
+			},
+		},
+		{"range partitioning",
+			&bigquery.TableMetadata{
+				Type: bigquery.RegularTable,
+				RangePartitioning: &bigquery.RangePartitioning{
+					Field: "customer_id",
+					Range: &bigquery.RangePartitioningRange{Start: 0, End: 100, Interval: 10},
+				},
+			},
+			&tables.TableInventory{
+				Type:              "TABLE",
+				PartitioningType:  "RANGE",
+				PartitioningField: "customer_id",
+			},
+		},
+		{"clustering",
+			&bigquery.TableMetadata{
+				Type:       bigquery.RegularTable,
+				Clustering: &bigquery.Clustering{Fields: []string{"user_id", "country"}},
+			},
+			&tables.TableInventory{
+				Type:             "TABLE",
+				ClusteringFields: []string{"user_id", "country"},
+			},
+		},
+		{"expiration",
+			&bigquery.TableMetadata{
+				Type:           bigquery.RegularTable,
+				ExpirationTime: expirationTime,
+			},
+			&tables.TableInventory{
+				Type:           "TABLE",
+				ExpirationTime: &expirationTime,
+			},
+		},
+		{"labels",
+			&bigquery.TableMetadata{
+				Type:   bigquery.ViewTable,
+				Labels: map[string]string{"env": "prod"},
+			},
+			&tables.TableInventory{
+				Type:   "VIEW",
+				Labels: map[string]string{"env": "prod"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.ProjectID = "p"
+			tt.want.DatasetID = "d"
+			tt.want.TableID = "t"
+			got := tables.NewTableInventory("p", "d", "t", tt.meta)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %+v but got %+v", tt.want, got)
+			}
+			// Expirationが設定されていない場合はnilにして、JSONに出力しない
+			if tt.meta.ExpirationTime.IsZero() && got.ExpirationTime != nil {
+				t.Errorf("ExpirationTime want nil but got %s", got.ExpirationTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package tables
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JournalOperation is Journalに記録した操作の種類
+type JournalOperation string
+
+const (
+	JournalOperationUpdateExpiration JournalOperation = "UpdateExpiration"
+	JournalOperationDelete           JournalOperation = "Delete"
+)
+
+// JournalEntry is 変更を加える前のTableの状態
+//
+// Undoする時はこの値を元に戻す
+type JournalEntry struct {
+	Operation JournalOperation `json:"operation"`
+	ProjectID string           `json:"projectID"`
+	DatasetID string           `json:"datasetID"`
+	TableID   string           `json:"tableID"`
+
+	// ExpirationTime is 変更前のTable.ExpirationTime. 設定されていなかった場合はzero
+	ExpirationTime time.Time `json:"expirationTime"`
+
+	// TimePartitioned is 変更前のTableがTimePartitioningを持っていたか
+	TimePartitioned bool `json:"timePartitioned"`
+
+	// PartitionExpiration is 変更前のTimePartitioning.Expiration
+	PartitionExpiration time.Duration `json:"partitionExpiration"`
+
+	// ETag is 変更前のTableのETag
+	ETag string `json:"etag"`
+
+	// SnapshotTime is 削除直前の時刻
+	// Time Travelの期間内であれば、この時刻のTableの状態から復元できる
+	SnapshotTime time.Time `json:"snapshotTime"`
+
+	// BackupDatasetID, BackupTableID is 削除前に作成したTable Snapshot. 作成していない場合は空
+	// 指定されている場合はTime TravelではなくTable Snapshotから復元する
+	BackupDatasetID string `json:"backupDatasetID,omitempty"`
+	BackupTableID   string `json:"backupTableID,omitempty"`
+
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// SnapshotTableID is SnapshotTimeの時点のTableを参照するためのSnapshot Decorator付きのTableIDを返す
+func (e *JournalEntry) SnapshotTableID() string {
+	return TimeTravelTableID(e.TableID, e.SnapshotTime)
+}
+
+// Journal is Tableに変更を加える前の状態を記録する
+type Journal interface {
+	Record(ctx context.Context, entry *JournalEntry) error
+}
+
+// JSONLinesJournal is JournalEntryを1行1JSONで書き込むJournal
+type JSONLinesJournal struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLinesJournal(w io.Writer) *JSONLinesJournal {
+	return &JSONLinesJournal{
+		w: w,
+	}
+}
+
+func (j *JSONLinesJournal) Record(ctx context.Context, entry *JournalEntry) error {
+	if entry.RecordedAt.IsZero() {
+		entry.RecordedAt = time.Now()
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := fmt.Fprintf(j.w, "%s\n", b); err != nil {
+		return fmt.Errorf("failed write journal. %s: %w", entry.TableID, err)
+	}
+	return nil
+}
+
+// ReadJournal is JSONLinesJournalで書き込んだJournalを読み込む
+func ReadJournal(r io.Reader) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	scanner := bufio.NewScanner(r)
+	var line int
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid journal line %d: %w", line, err)
+		}
+		entries = append(entries, &e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,58 @@
+package tables_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestJSONLinesJournal(t *testing.T) {
+	ctx := context.Background()
+
+	snapshotTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := new(bytes.Buffer)
+	j := tables.NewJSONLinesJournal(buf)
+	entries := []*tables.JournalEntry{
+		{
+			Operation:           tables.JournalOperationUpdateExpiration,
+			ProjectID:           "hoge",
+			DatasetID:           "fuga",
+			TableID:             "partitioned",
+			TimePartitioned:     true,
+			PartitionExpiration: 24 * time.Hour,
+			ETag:                "etag1",
+		},
+		{
+			Operation:    tables.JournalOperationDelete,
+			ProjectID:    "hoge",
+			DatasetID:    "fuga",
+			TableID:      "shard_20240101",
+			SnapshotTime: snapshotTime,
+		},
+	}
+	for _, e := range entries {
+		if err := j.Record(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := tables.ReadJournal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := len(got), len(entries); g != e {
+		t.Fatalf("want %d but got %d", e, g)
+	}
+	if g, e := got[0].PartitionExpiration, entries[0].PartitionExpiration; g != e {
+		t.Errorf("want %s but got %s", e, g)
+	}
+	if g, e := got[1].SnapshotTableID(), "shard_20240101@1704164645000"; g != e {
+		t.Errorf("want %s but got %s", e, g)
+	}
+	if got[1].RecordedAt.IsZero() {
+		t.Errorf("RecordedAt is zero")
+	}
+}
@@ -0,0 +1,158 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// LabelChange is Label更新前後の状態
+type LabelChange struct {
+	ProjectID string `json:"projectID"`
+	DatasetID string `json:"datasetID"`
+
+	// TableID is Datasetに対する変更の場合は空
+	TableID string `json:"tableID,omitempty"`
+
+	Before map[string]string `json:"before"`
+	After  map[string]string `json:"after"`
+
+	// Changed is Labelが変わったかどうか. DryRunの場合は変わる予定かどうか
+	Changed bool `json:"changed"`
+}
+
+// LabelUpdate is 追加・変更するLabelと削除するLabel
+type LabelUpdate struct {
+	Set    map[string]string
+	Delete []string
+}
+
+// apply is labelsにLabelUpdateを適用した結果を返す
+func (u *LabelUpdate) apply(labels map[string]string) map[string]string {
+	after := maps.Clone(labels)
+	if after == nil {
+		after = map[string]string{}
+	}
+	for k, v := range u.Set {
+		after[k] = v
+	}
+	for _, k := range u.Delete {
+		delete(after, k)
+	}
+	return after
+}
+
+// ListTableLabels is 指定したPrefixに合致するTableのLabelを返す
+func (s *Service) ListTableLabels(ctx context.Context, projectID string, datasetID string, tablePrefix string) ([]*LabelChange, error) {
+	var results []*LabelChange
+	err := s.forEachTableByPrefix(ctx, projectID, datasetID, tablePrefix, func(t *bigquery.Table) error {
+		meta, err := t.Metadata(ctx)
+		if err != nil {
+			return fmt.Errorf("failed get metadata %s.%s.%s : %w", projectID, datasetID, t.TableID, err)
+		}
+		results = append(results, &LabelChange{
+			ProjectID: projectID,
+			DatasetID: datasetID,
+			TableID:   t.TableID,
+			Before:    meta.Labels,
+			After:     meta.Labels,
+		})
+		return nil
+	})
+	return results, err
+}
+
+// ListDatasetLabels is DatasetのLabelを返す
+func (s *Service) ListDatasetLabels(ctx context.Context, projectID string, datasetID string) (map[string]string, error) {
+	meta, err := s.bq.DatasetInProject(projectID, datasetID).Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get metadata %s.%s : %w", projectID, datasetID, err)
+	}
+	return meta.Labels, nil
+}
+
+// UpdateTableLabels is 指定したPrefixに合致するTableのLabelを更新する
+//
+// 読み込んでから更新までの間にTableが変更されていた場合は、読み直して更新内容を決め直す
+// 途中で失敗した場合もそれまでの結果は返す
+func (s *Service) UpdateTableLabels(ctx context.Context, projectID string, datasetID string, tablePrefix string, update *LabelUpdate, ops ...APIOptions) ([]*LabelChange, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	var results []*LabelChange
+	err := s.forEachTableByPrefix(ctx, projectID, datasetID, tablePrefix, func(t *bigquery.Table) error {
+		var change *LabelChange
+		_, err := s.updateTable(ctx, t, func(meta *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error) {
+			change = &LabelChange{
+				ProjectID: projectID,
+				DatasetID: datasetID,
+				TableID:   t.TableID,
+				Before:    meta.Labels,
+				After:     update.apply(meta.Labels),
+			}
+			change.Changed = !maps.Equal(change.Before, change.After)
+			if !change.Changed || opt.dryRun {
+				return nil, nil
+			}
+
+			var tm bigquery.TableMetadataToUpdate
+			for k, v := range update.Set {
+				tm.SetLabel(k, v)
+			}
+			for _, k := range update.Delete {
+				tm.DeleteLabel(k)
+			}
+			return &tm, nil
+		}, &opt)
+		if change != nil {
+			results = append(results, change)
+		}
+		if err != nil {
+			return fmt.Errorf("failed update labels %s.%s.%s : %w", projectID, datasetID, t.TableID, err)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// UpdateDatasetLabels is DatasetのLabelを更新する
+//
+// 更新はETagを指定して行うので、読み込んでから更新までの間にDatasetが変更されていた場合は失敗する
+func (s *Service) UpdateDatasetLabels(ctx context.Context, projectID string, datasetID string, update *LabelUpdate, ops ...APIOptions) (*LabelChange, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	ds := s.bq.DatasetInProject(projectID, datasetID)
+	meta, err := ds.Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get metadata %s.%s : %w", projectID, datasetID, err)
+	}
+	change := &LabelChange{
+		ProjectID: projectID,
+		DatasetID: datasetID,
+		Before:    meta.Labels,
+		After:     update.apply(meta.Labels),
+	}
+	change.Changed = !maps.Equal(change.Before, change.After)
+	if !change.Changed || opt.dryRun {
+		return change, nil
+	}
+
+	var dm bigquery.DatasetMetadataToUpdate
+	for k, v := range update.Set {
+		dm.SetLabel(k, v)
+	}
+	for _, k := range update.Delete {
+		dm.DeleteLabel(k)
+	}
+	if _, err := ds.Update(ctx, dm, meta.ETag); err != nil {
+		return nil, fmt.Errorf("failed update labels %s.%s : %w", projectID, datasetID, err)
+	}
+	return change, nil
+}
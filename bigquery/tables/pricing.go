@@ -0,0 +1,42 @@
+package tables
+
+const (
+	// GiB is BigQueryの料金計算の単位
+	GiB = 1024 * 1024 * 1024
+
+	// ActiveLogicalStoragePricePerGiB is Logical StorageのActive Storageの1ヶ月あたりの料金(USD). US multi-region
+	ActiveLogicalStoragePricePerGiB = 0.02
+
+	// LongTermLogicalStoragePricePerGiB is Logical StorageのLong-term Storageの1ヶ月あたりの料金(USD). US multi-region
+	LongTermLogicalStoragePricePerGiB = 0.01
+
+	// ActivePhysicalStoragePricePerGiB is Physical StorageのActive Storageの1ヶ月あたりの料金(USD). US multi-region
+	ActivePhysicalStoragePricePerGiB = 0.04
+
+	// LongTermPhysicalStoragePricePerGiB is Physical StorageのLong-term Storageの1ヶ月あたりの料金(USD). US multi-region
+	LongTermPhysicalStoragePricePerGiB = 0.02
+)
+
+// StoragePricing is Storageの1GiB 1ヶ月あたりの料金(USD)
+//
+// RegionによってPriceが異なるので、US multi-region以外の場合は指定する
+type StoragePricing struct {
+	ActiveLogical   float64 `json:"activeLogical"`
+	LongTermLogical float64 `json:"longTermLogical"`
+
+	ActivePhysical   float64 `json:"activePhysical"`
+	LongTermPhysical float64 `json:"longTermPhysical"`
+}
+
+// DefaultStoragePricing is US multi-regionのStorageの料金
+var DefaultStoragePricing = StoragePricing{
+	ActiveLogical:    ActiveLogicalStoragePricePerGiB,
+	LongTermLogical:  LongTermLogicalStoragePricePerGiB,
+	ActivePhysical:   ActivePhysicalStoragePricePerGiB,
+	LongTermPhysical: LongTermPhysicalStoragePricePerGiB,
+}
+
+// LogicalStorageMonthlyCost is Logical Storageの1ヶ月あたりの料金(USD)を返す
+func LogicalStorageMonthlyCost(activeBytes int64, longTermBytes int64) float64 {
+	return float64(activeBytes)/GiB*ActiveLogicalStoragePricePerGiB + float64(longTermBytes)/GiB*LongTermLogicalStoragePricePerGiB
+}
@@ -0,0 +1,46 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// TableSchema is TableのSchema
+type TableSchema struct {
+	TableID string
+
+	// Type is TABLE, VIEW, MATERIALIZED_VIEW, EXTERNAL, SNAPSHOT
+	Type   string
+	Schema bigquery.Schema
+}
+
+// ListTableSchemas is tablePrefixに合致するTableのSchemaをTableIDの一覧の順番で返す
+//
+// Schemaを持たないTableは含めない
+func (s *Service) ListTableSchemas(ctx context.Context, projectID string, datasetID string, tablePrefix string) ([]*TableSchema, error) {
+	var results []*TableSchema
+	err := s.forEachTableByPrefix(ctx, projectID, datasetID, tablePrefix, func(t *bigquery.Table) error {
+		meta, err := t.Metadata(ctx)
+		if isNotFound(err) {
+			// 一覧を取ってから削除されたTableは含めない
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed get metadata %s.%s.%s : %w", projectID, datasetID, t.TableID, err)
+		}
+		if len(meta.Schema) == 0 {
+			return nil
+		}
+		results = append(results, &TableSchema{
+			TableID: t.TableID,
+			Type:    string(meta.Type),
+			Schema:  meta.Schema,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
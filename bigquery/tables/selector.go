@@ -0,0 +1,139 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+)
+
+// TableSelector is 処理の対象にするTableの条件
+//
+// 全ての条件に合致するTableが対象になる
+type TableSelector struct {
+	// Prefix is TableIDのPrefix
+	Prefix string
+
+	// Pattern is TableIDが合致する正規表現. nilの場合は条件にしない
+	Pattern *regexp.Regexp
+
+	// DateBase is From, To, MinAgeで使うTableの日付を何にするか
+	// TableSuffixの場合、TableIDの末尾がYYYYMMDDではないTableは対象にしない
+	DateBase BaseDate
+
+	// From is Tableの日付がこの時刻以降のものが対象. Zeroの場合は条件にしない
+	From time.Time
+
+	// To is Tableの日付がこの時刻より前のものが対象. Zeroの場合は条件にしない
+	To time.Time
+
+	// MinAge is Tableの日付からこの期間が経過していないTableは対象にしない
+	MinAge time.Duration
+
+	// Protected is 他の条件に合致しても対象にしないTableID
+	Protected map[string]bool
+}
+
+// SelectedTable is TableSelectorに合致したTable
+type SelectedTable struct {
+	TableID string `json:"tableID"`
+
+	// Date is TableSelector.DateBaseで決めたTableの日付
+	Date time.Time `json:"date"`
+
+	NumBytes int64 `json:"numBytes"`
+}
+
+// MatchTableID is TableIDがPrefixとPatternに合致するかどうか
+//
+// Protectedは見ない
+func (sel *TableSelector) MatchTableID(tableID string) bool {
+	if !strings.HasPrefix(tableID, sel.Prefix) {
+		return false
+	}
+	if sel.Pattern != nil && !sel.Pattern.MatchString(tableID) {
+		return false
+	}
+	return true
+}
+
+// MatchDate is Tableの日付がFrom, To, MinAgeに合致するかどうか
+func (sel *TableSelector) MatchDate(date time.Time, now time.Time) bool {
+	if !sel.From.IsZero() && date.Before(sel.From) {
+		return false
+	}
+	if !sel.To.IsZero() && !date.Before(sel.To) {
+		return false
+	}
+	if sel.MinAge > 0 && now.Sub(date) < sel.MinAge {
+		return false
+	}
+	return true
+}
+
+// TableDate is DateBaseに従ってTableの日付を返す
+//
+// TableSuffixでTableIDの末尾がYYYYMMDDではない場合はfalseを返す
+func TableDate(tableID string, meta *bigquery.TableMetadata, base BaseDate) (time.Time, bool) {
+	switch base {
+	case LastModifiedTime:
+		return meta.LastModifiedTime, true
+	case TableSuffix:
+		if len(tableID) < 8 {
+			return time.Time{}, false
+		}
+		return ParseShardDate(tableID, tableID[:len(tableID)-8])
+	default:
+		return meta.CreationTime, true
+	}
+}
+
+// SelectTables is selに合致するTableの一覧を返す
+//
+// ProtectedやMinAgeによって対象から外したTableはSkippedとして報告する
+func (s *Service) SelectTables(ctx context.Context, projectID string, datasetID string, sel *TableSelector, ops ...APIOptions) ([]*SelectedTable, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	now := time.Now()
+	var results []*SelectedTable
+	err := s.forEachTableByPrefix(ctx, projectID, datasetID, sel.Prefix, func(t *bigquery.Table) error {
+		if !sel.MatchTableID(t.TableID) {
+			return nil
+		}
+		if sel.Protected[t.TableID] {
+			opt.report(ctx, &events.Event{Type: events.Skipped, Resource: t.TableID, Reason: "protected"})
+			return nil
+		}
+		meta, err := t.Metadata(ctx)
+		if err != nil {
+			if isNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed get metadata %s.%s.%s : %w", projectID, datasetID, t.TableID, err)
+		}
+		date, ok := TableDate(t.TableID, meta, sel.DateBase)
+		if !ok {
+			return nil
+		}
+		if !sel.MatchDate(date, now) {
+			if sel.MinAge > 0 && now.Sub(date) < sel.MinAge {
+				opt.report(ctx, &events.Event{Type: events.Skipped, Resource: t.TableID, Reason: fmt.Sprintf("younger than min age. %s=%s", sel.DateBase, date.Format(time.RFC3339))})
+			}
+			return nil
+		}
+		results = append(results, &SelectedTable{
+			TableID:  t.TableID,
+			Date:     date,
+			NumBytes: meta.NumBytes,
+		})
+		return nil
+	})
+	return results, err
+}
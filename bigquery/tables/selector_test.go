@@ -0,0 +1,79 @@
+package tables_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestTableSelector_MatchTableID(t *testing.T) {
+	cases := []struct {
+		name    string
+		sel     *tables.TableSelector
+		tableID string
+		want    bool
+	}{
+		{"prefix", &tables.TableSelector{Prefix: "access_log_"}, "access_log_20240101", true},
+		{"other prefix", &tables.TableSelector{Prefix: "access_log_"}, "error_log_20240101", false},
+		{"pattern", &tables.TableSelector{Pattern: regexp.MustCompile(`_2023\d{4}$`)}, "access_log_20231231", true},
+		{"not pattern", &tables.TableSelector{Pattern: regexp.MustCompile(`_2023\d{4}$`)}, "access_log_20240101", false},
+		{"prefix and pattern", &tables.TableSelector{Prefix: "access_", Pattern: regexp.MustCompile(`_2023\d{4}$`)}, "error_log_20231231", false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sel.MatchTableID(tt.tableID); got != tt.want {
+				t.Errorf("want %t but got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTableSelector_MatchDate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	sel := &tables.TableSelector{
+		From:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		MinAge: 40 * 24 * time.Hour,
+	}
+
+	cases := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{"before from", time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC), false},
+		{"from", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"younger than min age", time.Date(2024, 1, 25, 0, 0, 0, 0, time.UTC), false},
+		{"to", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sel.MatchDate(tt.date, now); got != tt.want {
+				t.Errorf("want %t but got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTableDate(t *testing.T) {
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	meta := &bigquery.TableMetadata{CreationTime: created}
+
+	if got, ok := tables.TableDate("log_20240101", meta, tables.TableSuffix); !ok || !got.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected suffix date %s %t", got, ok)
+	}
+	if _, ok := tables.TableDate("log", meta, tables.TableSuffix); ok {
+		t.Errorf("short table id must not have suffix date")
+	}
+	if _, ok := tables.TableDate("log_latest", meta, tables.TableSuffix); ok {
+		t.Errorf("table id without date must not have suffix date")
+	}
+	if got, ok := tables.TableDate("log_20240101", meta, tables.CreationTime); !ok || !got.Equal(created) {
+		t.Errorf("unexpected creation date %s %t", got, ok)
+	}
+}
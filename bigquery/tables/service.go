@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
@@ -28,6 +31,9 @@ func NewService(ctx context.Context, bq *bigquery.Client) (*Service, error) {
 }
 
 // UpdateTablesExpirationFromDatasetDefaultSetting is DatasetのDefault Table ExpirationをTableにコピーする
+//
+// WithConcurrencyを指定すると複数のTableを並列に処理するが、結果はTableの一覧の順番で出力する
+// 途中で失敗したTableがあっても残りのTableの処理は続け、最後にまとめてerrorを返す
 func (s *Service) UpdateTablesExpirationFromDatasetDefaultSetting(ctx context.Context, projectID string, dataset string, ops ...APIOptions) error {
 	opt := apiOptions{}
 	for _, o := range ops {
@@ -46,37 +52,101 @@ func (s *Service) UpdateTablesExpirationFromDatasetDefaultSetting(ctx context.Co
 	// TODO defaultPartitionExpirationMsがdatasetにある場合は、それを設定するのが正しい https://github.com/googleapis/google-cloud-go/issues/7021
 
 	iter := ds.Tables(ctx)
-	for {
-		t, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	return updateTablesInOrder(ctx, iter.Next, func(table *bigquery.Table) (*events.Event, error) {
+		return s.updateTableExpiration(ctx, table, dte, &opt)
+	}, &opt)
+}
 
-		if err := s.UpdateTableExpirationFromDatasetDefaultSetting(ctx, t, dte, ops...); err != nil {
-			if errors.Is(err, ErrNotApplicableTableType) {
-				fmt.Printf("%s is not applicable table type\n", t.TableID)
-				continue
-			}
-			if errors.Is(err, ErrAlreadyExpirationSetting) {
-				fmt.Printf("%s is already expiration setting\n", t.TableID)
-				continue
+// updateTablesInOrder is nextTableで取得したTableをWithConcurrencyの数のgoroutineでupdateし、結果をTableの一覧の順番でreportする
+//
+// nextTableはiterator.Doneを返すまで呼ぶ. 失敗したTableのerrorとnextTableのerrorは、残りのTableの処理を終えてからまとめて返す
+func updateTablesInOrder(ctx context.Context, nextTable func() (*bigquery.Table, error), update func(table *bigquery.Table) (*events.Event, error), opt *apiOptions) error {
+	type task struct {
+		index int
+		table *bigquery.Table
+	}
+	type result struct {
+		index   int
+		tableID string
+		event   *events.Event
+		err     error
+	}
+
+	concurrency := opt.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	tasks := make(chan *task)
+	results := make(chan *result)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				e, err := update(t.table)
+				results <- &result{index: t.index, tableID: t.table.TableID, event: e, err: err}
 			}
-			var gapiErr *googleapi.Error
-			if errors.As(err, &gapiErr) {
-				if gapiErr.Code == http.StatusNotFound {
-					fmt.Printf("%s is not found\n", t.TableID)
+		}()
+	}
+
+	// 並列に処理しても出力の順番が変わらないように、Tableの一覧の順番で結果を処理する
+	done := make(chan []error)
+	go func() {
+		var errs []error
+		pending := map[int]*result{}
+		next := 0
+		for r := range results {
+			pending[r.index] = r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+
+				if r.err == nil {
+					opt.report(ctx, r.event)
+					continue
+				}
+				if errors.Is(r.err, ErrNotApplicableTableType) || errors.Is(r.err, ErrAlreadyExpirationSetting) {
+					opt.report(ctx, &events.Event{Type: events.Skipped, Resource: r.tableID, Reason: r.err.Error()})
 					continue
-				} else {
-					return err
 				}
+				if isNotFound(r.err) {
+					opt.report(ctx, &events.Event{Type: events.Skipped, Resource: r.tableID, Reason: "not found"})
+					continue
+				}
+				opt.report(ctx, &events.Event{Type: events.Failed, Action: "update expiration", Resource: r.tableID, Err: r.err})
+				errs = append(errs, fmt.Errorf("failed update expiration. %s: %w", r.tableID, r.err))
 			}
-			return fmt.Errorf("failed update expiration. %s: %w", t.TableID, err)
 		}
+		done <- errs
+	}()
+
+	var listErr error
+	var index int
+	for {
+		t, err := nextTable()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			listErr = err
+			break
+		}
+		tasks <- &task{index: index, table: t}
+		index++
 	}
-	return nil
+	close(tasks)
+	wg.Wait()
+	close(results)
+	errs := <-done
+	if listErr != nil {
+		errs = append(errs, listErr)
+	}
+	return errors.Join(errs...)
 }
 
 func (s *Service) UpdateTableExpirationFromDatasetDefaultSetting(ctx context.Context, table *bigquery.Table, expiration time.Duration, ops ...APIOptions) error {
@@ -85,40 +155,74 @@ func (s *Service) UpdateTableExpirationFromDatasetDefaultSetting(ctx context.Con
 		o(&opt)
 	}
 
-	meta, err := table.Metadata(ctx)
+	e, err := s.updateTableExpiration(ctx, table, expiration, &opt)
 	if err != nil {
 		return err
 	}
+	opt.report(ctx, e)
+	return nil
+}
+
+// updateTableExpiration is TableにExpirationを設定して、結果のEventを返す
+//
+// 読み込んでから更新までの間にTableが変更されていた場合は、読み直して設定する内容を決め直す
+func (s *Service) updateTableExpiration(ctx context.Context, table *bigquery.Table, expiration time.Duration, opt *apiOptions) (*events.Event, error) {
+	var e *events.Event
+	result, err := s.updateTable(ctx, table, func(meta *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error) {
+		var tm *bigquery.TableMetadataToUpdate
+		var err error
+		e, tm, err = expirationUpdate(table, meta, expiration, opt)
+		if err != nil {
+			return nil, err
+		}
+		if opt.dryRun {
+			return nil, nil
+		}
+		// 更新してからJournalの記録に失敗するとUndoできなくなるので、更新する前に記録する
+		// ETagが一致せずにやり直す場合はやり直すたびに記録し、Undoは後の記録から戻す
+		if err := recordJournal(ctx, opt, newJournalEntry(JournalOperationUpdateExpiration, table, meta)); err != nil {
+			return nil, err
+		}
+		return tm, nil
+	}, opt)
+	if err != nil {
+		return nil, err
+	}
+	if result.Updated() {
+		e.Retries = result.Retries
+	}
+	return e, nil
+}
 
+// expirationUpdate is TableMetadataから、Tableに設定するExpirationを決める
+func expirationUpdate(table *bigquery.Table, meta *bigquery.TableMetadata, expiration time.Duration, opt *apiOptions) (*events.Event, *bigquery.TableMetadataToUpdate, error) {
 	// 実Table以外は対象外
 	if meta.Type != bigquery.RegularTable {
-		return ErrNotApplicableTableType
+		return nil, nil, ErrNotApplicableTableType
 	}
 
 	// TimePartitioningの場合
 	// TODO すでに設定されている場合、上書きするかスルーするか
 	if meta.TimePartitioning != nil {
-		msg := fmt.Sprintf("%s update TimePartitioning.Expiration %s \n", table.TableID, expiration)
-		if opt.dryRun {
-			fmt.Printf("DryRun: %s", msg)
-			return nil
+		e := &events.Event{
+			Type:     events.Updated,
+			Action:   "update TimePartitioning.Expiration",
+			Resource: table.TableID,
+			Before:   meta.TimePartitioning.Expiration.String(),
+			After:    expiration.String(),
+			DryRun:   opt.dryRun,
 		}
-		_, err := table.Update(ctx, bigquery.TableMetadataToUpdate{
+		return e, &bigquery.TableMetadataToUpdate{
 			TimePartitioning: &bigquery.TimePartitioning{
 				Expiration: expiration, // TODO defaultPartitionExpirationMsがdatasetにある場合は、それを設定するのが正しい https://github.com/googleapis/google-cloud-go/issues/7021
 			},
-		}, meta.ETag)
-		if err != nil {
-			return err
-		}
-		fmt.Print(msg)
-		return nil
+		}, nil
 	}
 
 	// 通常のTableの場合
 	if !meta.ExpirationTime.IsZero() && !opt.overwriteExpiration {
 		// 上書き指示がなく、すでに設定されていれば、更新しない
-		return ErrAlreadyExpirationSetting
+		return nil, nil, ErrAlreadyExpirationSetting
 	}
 
 	var expirationTime time.Time
@@ -128,28 +232,193 @@ func (s *Service) UpdateTableExpirationFromDatasetDefaultSetting(ctx context.Con
 	case TableSuffix:
 		v, err := getTableSuffixDate(table.TableID)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		expirationTime = v.Add(expiration)
 	default:
 		expirationTime = meta.CreationTime.Add(expiration)
 	}
 
-	msg := fmt.Sprintf("%s update Table.ExpirationTime %s \n", table.TableID, expirationTime)
-	if opt.dryRun {
-		fmt.Printf("DryRun: %s", msg)
-		return nil
+	e := &events.Event{
+		Type:     events.Updated,
+		Action:   "update Table.ExpirationTime",
+		Resource: table.TableID,
+		After:    expirationTime.String(),
+		DryRun:   opt.dryRun,
+	}
+	if !meta.ExpirationTime.IsZero() {
+		e.Before = meta.ExpirationTime.String()
 	}
-	_, err = table.Update(ctx, bigquery.TableMetadataToUpdate{
+	return e, &bigquery.TableMetadataToUpdate{
 		ExpirationTime: expirationTime,
-	}, meta.ETag)
+	}, nil
+}
+
+// DeleteTablesByTablePrefix is 指定したPrefixに合致するTableを削除する
+//
+// 削除したTableIDの一覧を返す. WithSnapshotの場合、TABLE以外のTableは削除しない
+// 途中で削除に失敗した場合もそれまで削除したTableIDの一覧は返す
+func (s *Service) DeleteTablesByTablePrefix(ctx context.Context, projectID string, datasetID string, tablePrefix string, ops ...APIOptions) ([]string, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	var deleteTableIDs []string
+	err := s.forEachTableByPrefix(ctx, projectID, datasetID, tablePrefix, func(t *bigquery.Table) error {
+		deleted, err := s.deleteTable(ctx, t, &opt)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			deleteTableIDs = append(deleteTableIDs, t.TableID)
+		}
+		return nil
+	})
+	return deleteTableIDs, err
+}
+
+// DeleteTables is 指定したTableを削除する
+//
+// 削除したTableIDの一覧を返す. WithSnapshotの場合、TABLE以外のTableは削除しない
+// 途中で削除に失敗した場合もそれまで削除したTableIDの一覧は返す
+func (s *Service) DeleteTables(ctx context.Context, projectID string, datasetID string, tableIDs []string, ops ...APIOptions) ([]string, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	ds := s.bq.DatasetInProject(projectID, datasetID)
+	var deleteTableIDs []string
+	for _, tableID := range tableIDs {
+		deleted, err := s.deleteTable(ctx, ds.Table(tableID), &opt)
+		if err != nil {
+			return deleteTableIDs, err
+		}
+		if deleted {
+			deleteTableIDs = append(deleteTableIDs, tableID)
+		}
+	}
+	return deleteTableIDs, nil
+}
+
+// deleteTable is Tableを削除し、削除したかどうかを返す. JournalやSnapshotが指定されている場合は削除前に作成する
+//
+// Snapshotが指定されている場合、Snapshotを作成できないTABLE以外のTableは削除せずにSkippedとして報告する
+func (s *Service) deleteTable(ctx context.Context, t *bigquery.Table, opt *apiOptions) (bool, error) {
+	var meta *bigquery.TableMetadata
+	if opt.journal != nil || opt.snapshotDatasetID != "" {
+		var err error
+		meta, err = t.Metadata(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed get metadata %s.%s.%s : %w", t.ProjectID, t.DatasetID, t.TableID, err)
+		}
+		if opt.snapshotDatasetID != "" && meta.Type != bigquery.RegularTable {
+			opt.report(ctx, &events.Event{Type: events.Skipped, Resource: t.TableID, Reason: fmt.Sprintf("snapshot is not available for %s", meta.Type), DryRun: opt.dryRun})
+			return false, nil
+		}
+	}
+
+	e := &events.Event{Type: events.Deleted, Action: "delete", Resource: t.TableID, DryRun: opt.dryRun}
+	if opt.dryRun {
+		opt.report(ctx, e)
+		return true, nil
+	}
+
+	if meta != nil {
+		entry := newJournalEntry(JournalOperationDelete, t, meta)
+		if opt.snapshotDatasetID != "" {
+			snapshot, err := s.CreateSnapshot(ctx, t, opt.snapshotDatasetID, opt.snapshotExpiration)
+			if err != nil {
+				return false, fmt.Errorf("failed create snapshot %s.%s.%s : %w", t.ProjectID, t.DatasetID, t.TableID, err)
+			}
+			opt.report(ctx, &events.Event{Type: events.Created, Action: "snapshot", Resource: t.TableID, After: fmt.Sprintf("%s.%s", snapshot.DatasetID, snapshot.TableID)})
+			entry.BackupDatasetID = snapshot.DatasetID
+			entry.BackupTableID = snapshot.TableID
+		}
+		if err := recordJournal(ctx, opt, entry); err != nil {
+			return false, err
+		}
+	}
+	if err := t.Delete(ctx); err != nil {
+		return false, fmt.Errorf("failed delete table %s.%s.%s : %w", t.ProjectID, t.DatasetID, t.TableID, err)
+	}
+	opt.report(ctx, e)
+	return true, nil
+}
+
+// ListTableIDs is 指定したPrefixに合致するTableのTableIDの一覧を返す. tablePrefixが空の場合はDatasetの全てのTable
+func (s *Service) ListTableIDs(ctx context.Context, projectID string, datasetID string, tablePrefix string) ([]string, error) {
+	var tableIDs []string
+	err := s.forEachTableByPrefix(ctx, projectID, datasetID, tablePrefix, func(t *bigquery.Table) error {
+		tableIDs = append(tableIDs, t.TableID)
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return tableIDs, nil
+}
+
+// forEachTableByPrefix is 指定したPrefixに合致するTableに対してfnを実行する
+//
+// fnがerrorを返した場合はそこで止める
+func (s *Service) forEachTableByPrefix(ctx context.Context, projectID string, datasetID string, tablePrefix string, fn func(t *bigquery.Table) error) error {
+	iter := s.bq.DatasetInProject(projectID, datasetID).Tables(ctx)
+	for {
+		t, err := iter.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed list tables : %w", err)
+		}
+		if !strings.HasPrefix(t.TableID, tablePrefix) {
+			continue
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newJournalEntry is 変更前のTableの状態からJournalEntryを作る
+func newJournalEntry(op JournalOperation, table *bigquery.Table, meta *bigquery.TableMetadata) *JournalEntry {
+	entry := &JournalEntry{
+		Operation:      op,
+		ProjectID:      table.ProjectID,
+		DatasetID:      table.DatasetID,
+		TableID:        table.TableID,
+		ExpirationTime: meta.ExpirationTime,
+		ETag:           meta.ETag,
+	}
+	if meta.TimePartitioning != nil {
+		entry.TimePartitioned = true
+		entry.PartitionExpiration = meta.TimePartitioning.Expiration
+	}
+	if op == JournalOperationDelete {
+		entry.SnapshotTime = time.Now()
+	}
+	return entry
+}
+
+// recordJournal is Journalが指定されている場合、変更前のTableの状態を記録する
+func recordJournal(ctx context.Context, opt *apiOptions, entry *JournalEntry) error {
+	if opt.journal == nil {
+		return nil
+	}
+	if err := opt.journal.Record(ctx, entry); err != nil {
+		return fmt.Errorf("failed record journal. %s: %w", entry.TableID, err)
 	}
-	fmt.Print(msg)
 	return nil
 }
 
+// isNotFound is errがBigQuery APIの404かどうか
+func isNotFound(err error) bool {
+	var gapiErr *googleapi.Error
+	return errors.As(err, &gapiErr) && gapiErr.Code == http.StatusNotFound
+}
+
 func getYYYYMMDD(tableID string) (string, error) {
 	yyyyMMDD := tableID[len(tableID)-8:]
 	_, err := time.Parse("20060102", yyyyMMDD)
@@ -167,3 +436,8 @@ func getTableSuffixDate(tableID string) (time.Time, error) {
 	}
 	return v, nil
 }
+
+// Client is Serviceが使っているBigQuery Clientを返す
+func (s *Service) Client() *bigquery.Client {
+	return s.bq
+}
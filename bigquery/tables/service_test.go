@@ -0,0 +1,139 @@
+package tables_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// tableIterator is tableIDsのTableを順番に返し、最後にerrを返す
+func tableIterator(tableIDs []string, err error) func() (*bigquery.Table, error) {
+	var i int
+	return func() (*bigquery.Table, error) {
+		if i >= len(tableIDs) {
+			return nil, err
+		}
+		t := &bigquery.Table{ProjectID: "p", DatasetID: "d", TableID: tableIDs[i]}
+		i++
+		return t, nil
+	}
+}
+
+func TestUpdateTablesInOrder(t *testing.T) {
+	ctx := context.Background()
+
+	tableIDs := []string{"t0", "t1", "t2", "t3", "t4", "t5", "t6", "t7"}
+	errT2 := errors.New("t2 failed")
+	errT6 := errors.New("t6 failed")
+	// t0はt3が終わるまで終わらないので、結果は一覧の順番とは異なる順番で届く
+	t3Done := make(chan struct{})
+	update := func(table *bigquery.Table) (*events.Event, error) {
+		switch table.TableID {
+		case "t0":
+			select {
+			case <-t3Done:
+			case <-time.After(5 * time.Second):
+				return nil, errors.New("t3 did not finish")
+			}
+		case "t2":
+			return nil, errT2
+		case "t3":
+			defer close(t3Done)
+		case "t4":
+			return nil, tables.ErrNotApplicableTableType
+		case "t5":
+			return nil, &googleapi.Error{Code: http.StatusNotFound}
+		case "t6":
+			return nil, errT6
+		}
+		return &events.Event{Type: events.Updated, Resource: table.TableID}, nil
+	}
+
+	collector := events.NewCollector()
+	err := tables.UpdateTablesInOrder(ctx, tableIterator(tableIDs, iterator.Done), update, tables.WithConcurrency(4), tables.WithReporter(collector))
+	if !errors.Is(err, errT2) || !errors.Is(err, errT6) {
+		t.Errorf("want t2 and t6 errors but got %v", err)
+	}
+
+	wantTypes := []events.Type{events.Updated, events.Updated, events.Failed, events.Updated, events.Skipped, events.Skipped, events.Failed, events.Updated}
+	got := collector.Events()
+	if len(got) != len(tableIDs) {
+		t.Fatalf("want %d events but got %d", len(tableIDs), len(got))
+	}
+	for i, e := range got {
+		if g, w := e.Resource, tableIDs[i]; g != w {
+			t.Errorf("%d: want %s but got %s", i, w, g)
+		}
+		if g, w := e.Type, wantTypes[i]; g != w {
+			t.Errorf("%d: want %s but got %s", i, w, g)
+		}
+	}
+}
+
+func TestUpdateTablesInOrderListError(t *testing.T) {
+	ctx := context.Background()
+
+	listErr := errors.New("failed list")
+	errT1 := errors.New("t1 failed")
+	update := func(table *bigquery.Table) (*events.Event, error) {
+		if table.TableID == "t1" {
+			return nil, errT1
+		}
+		return &events.Event{Type: events.Updated, Resource: table.TableID}, nil
+	}
+
+	collector := events.NewCollector()
+	err := tables.UpdateTablesInOrder(ctx, tableIterator([]string{"t0", "t1", "t2"}, listErr), update, tables.WithConcurrency(2), tables.WithReporter(collector))
+	if !errors.Is(err, errT1) || !errors.Is(err, listErr) {
+		t.Errorf("want t1 and list errors but got %v", err)
+	}
+	// 一覧の取得に失敗しても、それまでに取得したTableは処理する
+	if g, w := len(collector.Events()), 3; g != w {
+		t.Errorf("want %d events but got %d", w, g)
+	}
+	if g, w := collector.Count(events.Failed), 1; g != w {
+		t.Errorf("want %d failed but got %d", w, g)
+	}
+}
+
+func TestDeleteTablesSkipSnapshotOfView(t *testing.T) {
+	ctx := context.Background()
+
+	var deletes atomic.Int64
+	s, _ := newFakeTable(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"tableReference":{"projectId":"p","datasetId":"d","tableId":"v"},"type":"VIEW","etag":"etag"}`))
+		case http.MethodDelete:
+			deletes.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+
+	collector := events.NewCollector()
+	deleted, err := s.DeleteTables(ctx, "p", "d", []string{"v"}, tables.WithSnapshot("backup", 0), tables.WithReporter(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("want no deleted tables but got %v", deleted)
+	}
+	if g := deletes.Load(); g != 0 {
+		t.Errorf("want no delete requests but got %d", g)
+	}
+	if g, w := collector.Count(events.Skipped), 1; g != w {
+		t.Errorf("want %d skipped but got %d", w, g)
+	}
+}
@@ -0,0 +1,65 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Shard is prefix_YYYYMMDD 形式の日付ShardingされたTable
+type Shard struct {
+	TableID string
+	Date    time.Time
+}
+
+// ParseShardDate is TableIDがtablePrefixの後にYYYYMMDDが続く形式の場合、その日付を返す
+func ParseShardDate(tableID string, tablePrefix string) (time.Time, bool) {
+	if !strings.HasPrefix(tableID, tablePrefix) {
+		return time.Time{}, false
+	}
+	suffix := tableID[len(tablePrefix):]
+	if len(suffix) != 8 {
+		return time.Time{}, false
+	}
+	v, err := time.Parse("20060102", suffix)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return v, true
+}
+
+// ListShards is tablePrefixに合致する日付ShardingされたTableを日付の昇順で返す
+//
+// tablePrefixの後にYYYYMMDDが続かないTableは含まない
+func (s *Service) ListShards(ctx context.Context, projectID string, datasetID string, tablePrefix string) ([]*Shard, error) {
+	var shards []*Shard
+	err := s.forEachTableByPrefix(ctx, projectID, datasetID, tablePrefix, func(t *bigquery.Table) error {
+		d, ok := ParseShardDate(t.TableID, tablePrefix)
+		if !ok {
+			return nil
+		}
+		shards = append(shards, &Shard{
+			TableID: t.TableID,
+			Date:    d,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].Date.Before(shards[j].Date)
+	})
+	return shards, nil
+}
+
+// PartitionDecorator is Shardの日付のPartitionを表すPartition Decorator付きのTableIDを返す
+//
+// eg. table$20240101
+func PartitionDecorator(tableID string, date time.Time) string {
+	return fmt.Sprintf("%s$%s", tableID, date.Format("20060102"))
+}
@@ -0,0 +1,37 @@
+package tables_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestParseShardDate(t *testing.T) {
+	cases := []struct {
+		name    string
+		tableID string
+		prefix  string
+		want    time.Time
+		wantOK  bool
+	}{
+		{"shard", "access_log_20240102", "access_log_", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), true},
+		{"other prefix", "error_log_20240102", "access_log_", time.Time{}, false},
+		{"not date", "access_log_summary", "access_log_", time.Time{}, false},
+		{"longer suffix", "access_log_2024010203", "access_log_", time.Time{}, false},
+		{"short", "a", "access_log_", time.Time{}, false},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tables.ParseShardDate(tt.tableID, tt.prefix)
+			if ok != tt.wantOK {
+				t.Fatalf("want %t but got %t", tt.wantOK, ok)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("want %s but got %s", tt.want, got)
+			}
+		})
+	}
+}
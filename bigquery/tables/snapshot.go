@@ -0,0 +1,142 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+)
+
+// SnapshotRestoreResult is Table SnapshotからTableを戻した結果
+type SnapshotRestoreResult struct {
+	SnapshotDatasetID string    `json:"snapshotDatasetID"`
+	SnapshotTableID   string    `json:"snapshotTableID"`
+	SnapshotTime      time.Time `json:"snapshotTime"`
+
+	ProjectID string `json:"projectID"`
+	DatasetID string `json:"datasetID"`
+	TableID   string `json:"tableID"`
+
+	Restored bool `json:"restored"`
+
+	// Reason is 戻さなかった理由
+	Reason string `json:"reason,omitempty"`
+}
+
+// SnapshotTableName is Table Snapshotの名前を返す
+//
+// eg. table_20240102150405
+func SnapshotTableName(tableID string, snapshotTime time.Time) string {
+	return fmt.Sprintf("%s_%s", tableID, snapshotTime.Format("20060102150405"))
+}
+
+// CreateSnapshot is tableのTable Snapshotを同じProjectのsnapshotDatasetIDに作成する
+//
+// expirationが0より大きい場合はSnapshotにExpirationを設定する
+func (s *Service) CreateSnapshot(ctx context.Context, table *bigquery.Table, snapshotDatasetID string, expiration time.Duration) (*bigquery.Table, error) {
+	now := time.Now()
+	snapshot := s.bq.DatasetInProject(table.ProjectID, snapshotDatasetID).Table(SnapshotTableName(table.TableID, now))
+	copier := snapshot.CopierFrom(table)
+	copier.OperationType = bigquery.SnapshotOperation
+	copier.WriteDisposition = bigquery.WriteEmpty
+	if err := s.runJob(ctx, copier); err != nil {
+		return nil, err
+	}
+
+	if expiration > 0 {
+		if _, err := snapshot.Update(ctx, bigquery.TableMetadataToUpdate{
+			ExpirationTime: now.Add(expiration),
+		}, ""); err != nil {
+			return nil, fmt.Errorf("failed update snapshot expiration %s : %w", snapshot.TableID, err)
+		}
+	}
+	return snapshot, nil
+}
+
+// RestoreTablesFromSnapshots is snapshotDatasetIDにあるTable Snapshotから、元のTableを作り直す
+//
+// 元のTableがdatasetIDにあり、TableIDがtablePrefixに合致するSnapshotが対象
+// 1つのTableに複数のSnapshotがある場合は最も新しいものを使う
+// 元のTableがすでに存在する場合は何もしない
+func (s *Service) RestoreTablesFromSnapshots(ctx context.Context, projectID string, datasetID string, tablePrefix string, snapshotDatasetID string, ops ...APIOptions) ([]*SnapshotRestoreResult, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	latest := map[string]*SnapshotRestoreResult{}
+	err := s.forEachTableByPrefix(ctx, projectID, snapshotDatasetID, "", func(t *bigquery.Table) error {
+		meta, err := t.Metadata(ctx)
+		if err != nil {
+			return fmt.Errorf("failed get metadata %s.%s.%s : %w", projectID, snapshotDatasetID, t.TableID, err)
+		}
+		if meta.Type != bigquery.Snapshot || meta.SnapshotDefinition == nil || meta.SnapshotDefinition.BaseTableReference == nil {
+			return nil
+		}
+		base := meta.SnapshotDefinition.BaseTableReference
+		if base.ProjectID != projectID || base.DatasetID != datasetID || !strings.HasPrefix(base.TableID, tablePrefix) {
+			return nil
+		}
+		key := base.FullyQualifiedName()
+		if v, ok := latest[key]; ok && v.SnapshotTime.After(meta.SnapshotDefinition.SnapshotTime) {
+			return nil
+		}
+		latest[key] = &SnapshotRestoreResult{
+			SnapshotDatasetID: snapshotDatasetID,
+			SnapshotTableID:   t.TableID,
+			SnapshotTime:      meta.SnapshotDefinition.SnapshotTime,
+			ProjectID:         base.ProjectID,
+			DatasetID:         base.DatasetID,
+			TableID:           base.TableID,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*SnapshotRestoreResult
+	for _, v := range latest {
+		results = append(results, v)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].TableID < results[j].TableID
+	})
+
+	for _, r := range results {
+		dst := s.bq.DatasetInProject(r.ProjectID, r.DatasetID).Table(r.TableID)
+		_, err := dst.Metadata(ctx)
+		if err == nil {
+			r.Reason = "table already exists"
+			opt.report(ctx, &events.Event{Type: events.Skipped, Resource: r.TableID, Reason: r.Reason})
+			continue
+		} else if !isNotFound(err) {
+			return results, fmt.Errorf("failed get metadata %s.%s.%s : %w", r.ProjectID, r.DatasetID, r.TableID, err)
+		}
+
+		e := &events.Event{
+			Type:     events.Created,
+			Action:   "restore",
+			Resource: r.TableID,
+			Source:   fmt.Sprintf("%s.%s", r.SnapshotDatasetID, r.SnapshotTableID),
+			DryRun:   opt.dryRun,
+		}
+		if opt.dryRun {
+			opt.report(ctx, e)
+			continue
+		}
+		copier := dst.CopierFrom(s.bq.DatasetInProject(projectID, r.SnapshotDatasetID).Table(r.SnapshotTableID))
+		copier.OperationType = bigquery.RestoreOperation
+		copier.WriteDisposition = bigquery.WriteEmpty
+		if err := s.runJob(ctx, copier); err != nil {
+			return results, fmt.Errorf("failed restore %s.%s.%s : %w", r.ProjectID, r.DatasetID, r.TableID, err)
+		}
+		r.Restored = true
+		opt.report(ctx, e)
+	}
+	return results, nil
+}
@@ -0,0 +1,15 @@
+package tables_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestSnapshotTableName(t *testing.T) {
+	got := tables.SnapshotTableName("access_log_20240101", time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC))
+	if g, e := got, "access_log_20240101_20240203040506"; g != e {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
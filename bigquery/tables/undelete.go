@@ -0,0 +1,148 @@
+package tables
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+	"google.golang.org/api/iterator"
+)
+
+// MaxTimeTravelWindow is Time Travelで過去のTableを参照できる最大の期間
+//
+// DatasetのMax Time Travel Hoursでこれより短くなっている場合がある
+const MaxTimeTravelWindow = 7 * 24 * time.Hour
+
+// TimeTravelTableID is snapshotTimeの時点のTableを参照するためのSnapshot Decorator付きのTableIDを返す
+//
+// eg. table@1704067200000
+func TimeTravelTableID(tableID string, snapshotTime time.Time) string {
+	return fmt.Sprintf("%s@%d", tableID, snapshotTime.UnixMilli())
+}
+
+// UndeleteResult is Time TravelでTableを戻した結果
+type UndeleteResult struct {
+	ProjectID    string    `json:"projectID"`
+	DatasetID    string    `json:"datasetID"`
+	TableID      string    `json:"tableID"`
+	SnapshotTime time.Time `json:"snapshotTime"`
+
+	Restored bool `json:"restored"`
+
+	// Reason is 戻せなかった理由
+	Reason string `json:"reason,omitempty"`
+}
+
+type deletedTableRow struct {
+	TableName string `bigquery:"table_name"`
+}
+
+// ListDeletedTables is INFORMATION_SCHEMA.TABLE_STORAGEから、datasetIDの削除済みでTableIDがtablePrefixに合致するTableの一覧を返す
+//
+// 削除済みのTableはTime TravelとFail-safeの期間の間だけ含まれる
+// 同じ名前で作り直されているTableも含まれる
+func (s *Service) ListDeletedTables(ctx context.Context, projectID string, datasetID string, tablePrefix string) ([]string, error) {
+	meta, err := s.bq.DatasetInProject(projectID, datasetID).Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := fmt.Sprintf("SELECT DISTINCT table_name\n"+
+		"FROM `%s`.`%s`.INFORMATION_SCHEMA.TABLE_STORAGE\n"+
+		"WHERE table_schema = @dataset\n"+
+		"  AND STARTS_WITH(table_name, @prefix)\n"+
+		"  AND IFNULL(deleted, FALSE)\n"+
+		"ORDER BY table_name", projectID, RegionQualifier(meta.Location))
+	q := s.bq.Query(sql)
+	q.Location = meta.Location
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "dataset", Value: datasetID},
+		{Name: "prefix", Value: tablePrefix},
+	}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed query deleted tables : %w", err)
+	}
+	var results []string
+	for {
+		var row deletedTableRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, row.TableName)
+	}
+	return results, nil
+}
+
+// UndeleteTables is Time Travelでsnapshotの時点のTableをCopy Jobで作り直す
+//
+// すでに存在するTableは何もしない
+// 戻せなかったTableがあっても残りのTableの処理は続け、最後にまとめてerrorを返す
+func (s *Service) UndeleteTables(ctx context.Context, projectID string, datasetID string, tableIDs []string, snapshotTime time.Time, ops ...APIOptions) ([]*UndeleteResult, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	now := time.Now()
+	if snapshotTime.After(now) {
+		return nil, fmt.Errorf("snapshot time %s is in the future", snapshotTime)
+	}
+	if now.Sub(snapshotTime) > MaxTimeTravelWindow {
+		return nil, fmt.Errorf("snapshot time %s is out of time travel window %s", snapshotTime, MaxTimeTravelWindow)
+	}
+
+	ds := s.bq.DatasetInProject(projectID, datasetID)
+	var results []*UndeleteResult
+	var errs []error
+	for _, tableID := range tableIDs {
+		r := &UndeleteResult{
+			ProjectID:    projectID,
+			DatasetID:    datasetID,
+			TableID:      tableID,
+			SnapshotTime: snapshotTime,
+		}
+		results = append(results, r)
+
+		dst := ds.Table(tableID)
+		_, err := dst.Metadata(ctx)
+		if err == nil {
+			r.Reason = "table already exists"
+			opt.report(ctx, &events.Event{Type: events.Skipped, Resource: tableID, Reason: r.Reason})
+			continue
+		} else if !isNotFound(err) {
+			return results, fmt.Errorf("failed get metadata %s.%s.%s : %w", projectID, datasetID, tableID, err)
+		}
+
+		e := &events.Event{
+			Type:     events.Created,
+			Action:   "undelete",
+			Resource: tableID,
+			Source:   TimeTravelTableID(tableID, snapshotTime),
+			DryRun:   opt.dryRun,
+		}
+		if opt.dryRun {
+			opt.report(ctx, e)
+			continue
+		}
+		copier := dst.CopierFrom(ds.Table(TimeTravelTableID(tableID, snapshotTime)))
+		copier.CreateDisposition = bigquery.CreateIfNeeded
+		copier.WriteDisposition = bigquery.WriteEmpty
+		if err := s.runJob(ctx, copier); err != nil {
+			r.Reason = err.Error()
+			opt.report(ctx, &events.Event{Type: events.Failed, Action: "undelete", Resource: tableID, Err: err})
+			errs = append(errs, fmt.Errorf("failed undelete %s.%s.%s : %w", projectID, datasetID, tableID, err))
+			continue
+		}
+		r.Restored = true
+		opt.report(ctx, e)
+	}
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,177 @@
+package tables
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
+)
+
+// Undo is Journalに記録された変更前の状態にTableを戻す
+//
+// 後に記録された変更から順に戻す
+// 途中で失敗したTableがあっても残りのTableの処理は続け、最後にまとめてerrorを返す
+func (s *Service) Undo(ctx context.Context, entries []*JournalEntry, ops ...APIOptions) error {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		var err error
+		switch e.Operation {
+		case JournalOperationUpdateExpiration:
+			err = s.undoUpdateExpiration(ctx, e, &opt)
+		case JournalOperationDelete:
+			err = s.undoDelete(ctx, e, &opt)
+		default:
+			err = fmt.Errorf("unsupported journal operation %s", e.Operation)
+		}
+		if err != nil {
+			opt.report(ctx, &events.Event{Type: events.Failed, Action: fmt.Sprintf("undo %s", e.Operation), Resource: e.TableID, Err: err})
+			errs = append(errs, fmt.Errorf("failed undo %s %s.%s.%s: %w", e.Operation, e.ProjectID, e.DatasetID, e.TableID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) undoUpdateExpiration(ctx context.Context, e *JournalEntry, opt *apiOptions) error {
+	table := s.bq.DatasetInProject(e.ProjectID, e.DatasetID).Table(e.TableID)
+
+	var ev *events.Event
+	var alterDDL bool
+	result, err := s.updateTable(ctx, table, func(meta *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error) {
+		// TimePartitioningの場合
+		if e.TimePartitioned {
+			if meta.TimePartitioning == nil {
+				return nil, fmt.Errorf("table no longer has time partitioning")
+			}
+			ev = &events.Event{
+				Type:     events.Updated,
+				Action:   "restore TimePartitioning.Expiration",
+				Resource: e.TableID,
+				Before:   meta.TimePartitioning.Expiration.String(),
+				After:    e.PartitionExpiration.String(),
+				DryRun:   opt.dryRun,
+			}
+			if opt.dryRun {
+				return nil, nil
+			}
+			if e.PartitionExpiration == 0 {
+				// TimePartitioning.Expirationの0はAPIに送られず消せないので、DDLで消す
+				alterDDL = true
+				return nil, nil
+			}
+			tp := *meta.TimePartitioning
+			tp.Expiration = e.PartitionExpiration
+			return &bigquery.TableMetadataToUpdate{
+				TimePartitioning: &tp,
+			}, nil
+		}
+
+		// 通常のTableの場合
+		ev = &events.Event{
+			Type:     events.Updated,
+			Action:   "restore Table.ExpirationTime",
+			Resource: e.TableID,
+			After:    e.ExpirationTime.String(),
+			DryRun:   opt.dryRun,
+		}
+		if !meta.ExpirationTime.IsZero() {
+			ev.Before = meta.ExpirationTime.String()
+		}
+		expirationTime := e.ExpirationTime
+		if expirationTime.IsZero() {
+			expirationTime = bigquery.NeverExpire
+			ev.After = "never"
+		}
+		if opt.dryRun {
+			return nil, nil
+		}
+		return &bigquery.TableMetadataToUpdate{
+			ExpirationTime: expirationTime,
+		}, nil
+	}, opt)
+	if err != nil {
+		return err
+	}
+	if alterDDL {
+		sql := fmt.Sprintf("ALTER TABLE `%s.%s.%s` SET OPTIONS (partition_expiration_days = NULL)", e.ProjectID, e.DatasetID, e.TableID)
+		if err := s.runJob(ctx, s.bq.Query(sql)); err != nil {
+			return err
+		}
+	}
+	ev.Retries = result.Retries
+	opt.report(ctx, ev)
+	return nil
+}
+
+func (s *Service) undoDelete(ctx context.Context, e *JournalEntry, opt *apiOptions) error {
+	ds := s.bq.DatasetInProject(e.ProjectID, e.DatasetID)
+	var copier *bigquery.Copier
+	ev := &events.Event{Type: events.Created, Action: "restore", Resource: e.TableID, DryRun: opt.dryRun}
+	if e.BackupTableID != "" {
+		// Table Snapshotを作っている場合はそこから戻す
+		snapshot := s.bq.DatasetInProject(e.ProjectID, e.BackupDatasetID).Table(e.BackupTableID)
+		copier = ds.Table(e.TableID).CopierFrom(snapshot)
+		copier.OperationType = bigquery.RestoreOperation
+		ev.Source = fmt.Sprintf("%s.%s", e.BackupDatasetID, e.BackupTableID)
+	} else {
+		if e.SnapshotTime.IsZero() {
+			return fmt.Errorf("journal has not snapshot time")
+		}
+		// Time Travelで削除直前の状態からTableを作り直す
+		copier = ds.Table(e.TableID).CopierFrom(ds.Table(e.SnapshotTableID()))
+		ev.Source = e.SnapshotTableID()
+	}
+	if opt.dryRun {
+		opt.report(ctx, ev)
+		return nil
+	}
+
+	copier.CreateDisposition = bigquery.CreateIfNeeded
+	copier.WriteDisposition = bigquery.WriteEmpty
+	if err := s.runJob(ctx, copier); err != nil {
+		return err
+	}
+
+	// 削除前に設定されていたExpirationを戻す. すでに過ぎている場合は戻すと消えてしまうので何もしない
+	if e.ExpirationTime.IsZero() || e.ExpirationTime.After(time.Now()) {
+		expirationTime := e.ExpirationTime
+		if expirationTime.IsZero() {
+			expirationTime = bigquery.NeverExpire
+		}
+		if _, err := ds.Table(e.TableID).Update(ctx, bigquery.TableMetadataToUpdate{
+			ExpirationTime: expirationTime,
+		}, ""); err != nil {
+			return err
+		}
+	}
+	opt.report(ctx, ev)
+	return nil
+}
+
+type jobRunner interface {
+	Run(ctx context.Context) (*bigquery.Job, error)
+}
+
+// runJob is Jobを実行して完了するまで待つ
+func (s *Service) runJob(ctx context.Context, runner jobRunner) error {
+	job, err := runner.Run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("failed job.Wait() job=%s : %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		return fmt.Errorf("failed job job=%s : %w", job.ID(), err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// MaxJobsRetentionDays is INFORMATION_SCHEMA.JOBSにJobが保持されている日数
+const MaxJobsRetentionDays = 180
+
+// UnusedTable is 指定した日数の間、Queryから参照されていないTable
+type UnusedTable struct {
+	ProjectID            string    `json:"projectID"`
+	DatasetID            string    `json:"datasetID"`
+	TableID              string    `json:"tableID"`
+	CreationTime         time.Time `json:"creationTime"`
+	ActiveLogicalBytes   int64     `json:"activeLogicalBytes"`
+	LongTermLogicalBytes int64     `json:"longTermLogicalBytes"`
+
+	// MonthlyStorageCost is Logical Storageとして計算した1ヶ月あたりのStorage料金(USD)
+	MonthlyStorageCost float64 `json:"monthlyStorageCost"`
+}
+
+type unusedTableRow struct {
+	TableName            string    `bigquery:"table_name"`
+	CreationTime         time.Time `bigquery:"creation_time"`
+	ActiveLogicalBytes   int64     `bigquery:"active_logical_bytes"`
+	LongTermLogicalBytes int64     `bigquery:"long_term_logical_bytes"`
+}
+
+// ListUnusedTables is INFORMATION_SCHEMA.JOBS_BY_PROJECTのreferenced_tablesを見て、unusedDaysの間参照されていないTableの一覧を返す
+//
+// 対象はprojectID内で実行されたJobだけなので、別のProjectから参照されている場合は検出できない
+// unusedDaysより後に作成されたTableは対象外
+// Storage料金が大きい順に返す
+func (s *Service) ListUnusedTables(ctx context.Context, projectID string, datasetID string, tablePrefix string, unusedDays int) ([]*UnusedTable, error) {
+	if unusedDays < 1 || unusedDays > MaxJobsRetentionDays {
+		return nil, fmt.Errorf("unusedDays must be between 1 and %d", MaxJobsRetentionDays)
+	}
+
+	meta, err := s.bq.DatasetInProject(projectID, datasetID).Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	region := RegionQualifier(meta.Location)
+
+	sql := fmt.Sprintf("WITH referenced AS (\n"+
+		"  SELECT DISTINCT rt.table_id\n"+
+		"  FROM `%[1]s`.`%[3]s`.INFORMATION_SCHEMA.JOBS_BY_PROJECT, UNNEST(referenced_tables) AS rt\n"+
+		"  WHERE creation_time >= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @days DAY)\n"+
+		"    AND rt.project_id = @project\n"+
+		"    AND rt.dataset_id = @dataset\n"+
+		")\n"+
+		"SELECT t.table_name, t.creation_time,\n"+
+		"  IFNULL(s.active_logical_bytes, 0) AS active_logical_bytes,\n"+
+		"  IFNULL(s.long_term_logical_bytes, 0) AS long_term_logical_bytes\n"+
+		"FROM `%[1]s`.`%[2]s`.INFORMATION_SCHEMA.TABLES AS t\n"+
+		"LEFT JOIN `%[1]s`.`%[3]s`.INFORMATION_SCHEMA.TABLE_STORAGE AS s\n"+
+		"  ON s.table_schema = t.table_schema AND s.table_name = t.table_name AND NOT IFNULL(s.deleted, FALSE)\n"+
+		"WHERE t.table_type = 'BASE TABLE'\n"+
+		"  AND STARTS_WITH(t.table_name, @prefix)\n"+
+		"  AND t.creation_time < TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @days DAY)\n"+
+		"  AND t.table_name NOT IN (SELECT table_id FROM referenced)\n"+
+		"ORDER BY active_logical_bytes * 2 + long_term_logical_bytes DESC, t.table_name", projectID, datasetID, region)
+	q := s.bq.Query(sql)
+	q.Location = meta.Location
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "days", Value: unusedDays},
+		{Name: "project", Value: projectID},
+		{Name: "dataset", Value: datasetID},
+		{Name: "prefix", Value: tablePrefix},
+	}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed query unused tables : %w", err)
+	}
+
+	var results []*UnusedTable
+	for {
+		var row unusedTableRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &UnusedTable{
+			ProjectID:            projectID,
+			DatasetID:            datasetID,
+			TableID:              row.TableName,
+			CreationTime:         row.CreationTime,
+			ActiveLogicalBytes:   row.ActiveLogicalBytes,
+			LongTermLogicalBytes: row.LongTermLogicalBytes,
+			MonthlyStorageCost:   LogicalStorageMonthlyCost(row.ActiveLogicalBytes, row.LongTermLogicalBytes),
+		})
+	}
+	return results, nil
+}
+
+// RegionQualifier is DatasetのLocationからINFORMATION_SCHEMAを参照する時のRegion Qualifierを返す
+//
+// eg. US -> region-us, asia-northeast1 -> region-asia-northeast1
+func RegionQualifier(location string) string {
+	return fmt.Sprintf("region-%s", strings.ToLower(location))
+}
@@ -0,0 +1,34 @@
+package tables_test
+
+import (
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestRegionQualifier(t *testing.T) {
+	cases := []struct {
+		location string
+		want     string
+	}{
+		{"US", "region-us"},
+		{"EU", "region-eu"},
+		{"asia-northeast1", "region-asia-northeast1"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.location, func(t *testing.T) {
+			if g, e := tables.RegionQualifier(tt.location), tt.want; g != e {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestLogicalStorageMonthlyCost(t *testing.T) {
+	got := tables.LogicalStorageMonthlyCost(100*tables.GiB, 100*tables.GiB)
+	if g, e := got, 3.0; g != e {
+		t.Errorf("want %f but got %f", e, g)
+	}
+}
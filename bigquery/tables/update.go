@@ -0,0 +1,134 @@
+package tables
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultMaxUpdateRetries is ETagが一致せずにTableの更新に失敗した時に、やり直す回数のデフォルト
+const DefaultMaxUpdateRetries = 5
+
+// TableUpdateFunc is 最新のTableMetadataを見て、Tableの更新内容を決める
+//
+// nilを返した場合はTableを更新しない
+// ETagが一致せずに更新に失敗した場合は、読み直したTableMetadataでもう一度呼ばれる
+type TableUpdateFunc func(meta *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error)
+
+// TableUpdateResult is UpdateTableの結果
+type TableUpdateResult struct {
+	// Before is 最後に読み込んだ更新前のTableMetadata
+	Before *bigquery.TableMetadata
+
+	// After is 更新後のTableMetadata. 更新しなかった場合はnil
+	After *bigquery.TableMetadata
+
+	// Retries is ETagが一致せずにやり直した回数
+	Retries int
+}
+
+// Updated is Tableを更新したかどうか
+func (r *TableUpdateResult) Updated() bool {
+	return r.After != nil
+}
+
+// ContentionStats is ETagが一致せずにTableの更新をやり直した回数の集計
+//
+// 複数のgoroutineから同時に使える
+type ContentionStats struct {
+	// Tables is 1回以上やり直したTableの数
+	Tables atomic.Int64
+
+	// Retries is やり直した回数の合計
+	Retries atomic.Int64
+
+	// Exhausted is やり直しても更新できなかったTableの数
+	Exhausted atomic.Int64
+}
+
+// UpdateTable is fnが決めた内容でTableを更新する
+//
+// 更新はETagを指定して行い、読み込んでから更新までの間にTableが変更されていた場合(HTTP 412)は
+// TableMetadataを読み直してfnで更新内容を決め直し、backoffしながらやり直す
+func (s *Service) UpdateTable(ctx context.Context, table *bigquery.Table, fn TableUpdateFunc, ops ...APIOptions) (*TableUpdateResult, error) {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+	return s.updateTable(ctx, table, fn, &opt)
+}
+
+func (s *Service) updateTable(ctx context.Context, table *bigquery.Table, fn TableUpdateFunc, opt *apiOptions) (*TableUpdateResult, error) {
+	maxRetries := opt.maxUpdateRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxUpdateRetries
+	}
+
+	result := &TableUpdateResult{}
+	defer func() {
+		if opt.contentionStats != nil && result.Retries > 0 {
+			opt.contentionStats.Tables.Add(1)
+			opt.contentionStats.Retries.Add(int64(result.Retries))
+		}
+	}()
+	for {
+		meta, err := table.Metadata(ctx)
+		if err != nil {
+			return result, err
+		}
+		result.Before = meta
+
+		tm, err := fn(meta)
+		if err != nil {
+			return result, err
+		}
+		if tm == nil {
+			return result, nil
+		}
+
+		if err := opt.waitRateLimit(ctx); err != nil {
+			return result, err
+		}
+		after, err := table.Update(ctx, *tm, meta.ETag)
+		if err == nil {
+			result.After = after
+			return result, nil
+		}
+		if !isPreconditionFailed(err) {
+			return result, err
+		}
+		if result.Retries >= maxRetries {
+			if opt.contentionStats != nil {
+				opt.contentionStats.Exhausted.Add(1)
+			}
+			return result, err
+		}
+		result.Retries++
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(updateBackoff(result.Retries)):
+		}
+	}
+}
+
+// updateBackoff is retry回目のやり直しの前に待つ時間
+//
+// 100ms * 2^(retry-1) を上限3.2sとして、同時に更新している処理とぶつからないようにjitterを入れる
+func updateBackoff(retry int) time.Duration {
+	d := 100 * time.Millisecond << min(retry-1, 5)
+	return d/2 + rand.N(d/2+1)
+}
+
+// isPreconditionFailed is errがETagが一致しなかった時のBigQuery APIの412かどうか
+func isPreconditionFailed(err error) bool {
+	var gapiErr *googleapi.Error
+	return errors.As(err, &gapiErr) && gapiErr.Code == http.StatusPreconditionFailed
+}
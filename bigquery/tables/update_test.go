@@ -0,0 +1,182 @@
+package tables_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// fakeTableServer is Tableの取得と更新だけを返すBigQuery APIのFake
+//
+// 更新は最初のfailures回だけpatchStatusを返し、その後は成功する
+type fakeTableServer struct {
+	failures    int
+	patchStatus int
+
+	gets    atomic.Int64
+	patches atomic.Int64
+}
+
+func (f *fakeTableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		n := f.gets.Add(1)
+		fmt.Fprintf(w, `{"tableReference":{"projectId":"p","datasetId":"d","tableId":"t"},"type":"TABLE","etag":"etag-%d"}`, n)
+	case http.MethodPatch:
+		n := f.patches.Add(1)
+		if int(n) <= f.failures {
+			w.WriteHeader(f.patchStatus)
+			fmt.Fprintf(w, `{"error":{"code":%d,"message":"%s"}}`, f.patchStatus, http.StatusText(f.patchStatus))
+			return
+		}
+		fmt.Fprintf(w, `{"tableReference":{"projectId":"p","datasetId":"d","tableId":"t"},"type":"TABLE","etag":"updated","description":"updated"}`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeTable(t *testing.T, f http.Handler) (*tables.Service, *bigquery.Table) {
+	t.Helper()
+	ctx := context.Background()
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	bq, err := bigquery.NewClient(ctx, "p", option.WithEndpoint(srv.URL), option.WithoutAuthentication(), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := bq.Close(); err != nil {
+			t.Logf("failed bq.Close %s", err)
+		}
+	})
+	s, err := tables.NewService(ctx, bq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, bq.Dataset("d").Table("t")
+}
+
+func updateDescription(calls *int) tables.TableUpdateFunc {
+	return func(meta *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error) {
+		*calls++
+		return &bigquery.TableMetadataToUpdate{Description: "updated"}, nil
+	}
+}
+
+func TestUpdateTable(t *testing.T) {
+	cases := []struct {
+		name        string
+		failures    int
+		patchStatus int
+		maxRetries  int
+		wantErrCode int
+		wantPatches int64
+		wantRetries int
+		wantTables  int64
+		wantExhaust int64
+	}{
+		{"retry on 412 and succeed", 2, http.StatusPreconditionFailed, 0, 0, 3, 2, 1, 0},
+		{"give up after max retries", 10, http.StatusPreconditionFailed, 2, http.StatusPreconditionFailed, 3, 2, 1, 1},
+		{"negative max retries does not retry", 10, http.StatusPreconditionFailed, -1, http.StatusPreconditionFailed, 1, 0, 0, 1},
+		{"not retry other errors", 10, http.StatusBadRequest, 0, http.StatusBadRequest, 1, 0, 0, 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := &fakeTableServer{failures: tt.failures, patchStatus: tt.patchStatus}
+			s, table := newFakeTable(t, f)
+
+			stats := &tables.ContentionStats{}
+			ops := []tables.APIOptions{tables.WithContentionStats(stats)}
+			if tt.maxRetries != 0 {
+				ops = append(ops, tables.WithMaxUpdateRetries(tt.maxRetries))
+			}
+			var calls int
+			result, err := s.UpdateTable(ctx, table, updateDescription(&calls), ops...)
+			if tt.wantErrCode == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Updated() {
+					t.Errorf("want updated")
+				}
+			} else {
+				var gapiErr *googleapi.Error
+				if !errors.As(err, &gapiErr) || gapiErr.Code != tt.wantErrCode {
+					t.Fatalf("want %d error but got %v", tt.wantErrCode, err)
+				}
+				if result.Updated() {
+					t.Errorf("want not updated")
+				}
+			}
+
+			if g, e := f.patches.Load(), tt.wantPatches; g != e {
+				t.Errorf("patches want %d but got %d", e, g)
+			}
+			// 更新の度にTableMetadataを読み直し、更新内容を決め直す
+			if g, e := int64(calls), tt.wantPatches; g != e {
+				t.Errorf("calls want %d but got %d", e, g)
+			}
+			if g, e := f.gets.Load(), tt.wantPatches; g != e {
+				t.Errorf("gets want %d but got %d", e, g)
+			}
+			if g, e := result.Retries, tt.wantRetries; g != e {
+				t.Errorf("retries want %d but got %d", e, g)
+			}
+			if g, e := stats.Tables.Load(), tt.wantTables; g != e {
+				t.Errorf("stats.Tables want %d but got %d", e, g)
+			}
+			if g, e := stats.Retries.Load(), int64(tt.wantRetries); g != e {
+				t.Errorf("stats.Retries want %d but got %d", e, g)
+			}
+			if g, e := stats.Exhausted.Load(), tt.wantExhaust; g != e {
+				t.Errorf("stats.Exhausted want %d but got %d", e, g)
+			}
+		})
+	}
+}
+
+func TestUpdateTableNoUpdate(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeTableServer{}
+	s, table := newFakeTable(t, f)
+
+	result, err := s.UpdateTable(ctx, table, func(meta *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated() {
+		t.Errorf("want not updated")
+	}
+	if g := f.patches.Load(); g != 0 {
+		t.Errorf("patches want 0 but got %d", g)
+	}
+}
+
+func TestUpdateBackoff(t *testing.T) {
+	for retry := 1; retry <= 8; retry++ {
+		d := 100 * time.Millisecond << min(retry-1, 5)
+		for i := 0; i < 100; i++ {
+			got := tables.UpdateBackoff(retry)
+			if got < d/2 || got > d {
+				t.Fatalf("retry=%d want between %s and %s but got %s", retry, d/2, d, got)
+			}
+		}
+	}
+}
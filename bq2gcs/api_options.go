@@ -1,9 +1,16 @@
 package bq2gcs
 
+import (
+	"context"
+
+	"github.com/sinmetalcraft/gcptoolbox/events"
+)
+
 type apiOptions struct {
 	dryRun      bool
 	wait        bool
 	streamLogFn func(msg string)
+	reporter    events.Reporter
 }
 
 type APIOptions func(options *apiOptions)
@@ -23,8 +30,25 @@ func WithWait() APIOptions {
 }
 
 // WithStreamLogFn is Query結果を元にAPIを実行した時にログを処理できる関数を指定できる
+//
+// Eventを1行のTextにしたものが渡される. 結果を型で受け取りたい場合はWithReporterを使う
 func WithStreamLogFn(f func(msg string)) APIOptions {
 	return func(ops *apiOptions) {
 		ops.streamLogFn = f
 	}
 }
+
+// WithReporter is 処理の結果のEventを受け取るReporterを指定する
+func WithReporter(reporter events.Reporter) APIOptions {
+	return func(ops *apiOptions) {
+		ops.reporter = reporter
+	}
+}
+
+// report is ReporterとStreamLogFnに処理の結果のEventを送る
+func (ops *apiOptions) report(ctx context.Context, e *events.Event) {
+	events.Report(ctx, ops.reporter, e)
+	if ops.streamLogFn != nil {
+		ops.streamLogFn(e.String())
+	}
+}
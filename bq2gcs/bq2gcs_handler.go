@@ -8,6 +8,7 @@ import (
 
 	"cloud.google.com/go/bigquery"
 	metadatabox "github.com/sinmetalcraft/gcpbox/metadata"
+	"github.com/sinmetalcraft/gcptoolbox/events"
 	"github.com/sinmetalcraft/gcptoolbox/handlers"
 )
 
@@ -48,6 +49,11 @@ type ExportsReq struct {
 	Limit   *ExportShardingTablesLimit              `json:"limit"`
 }
 
+type ExportsResp struct {
+	// Events is Exportの対象にしたTableと、対象外にしたTableの一覧
+	Events []*events.Event `json:"events"`
+}
+
 func (h *ExportHandler) Serve(ctx context.Context, w http.ResponseWriter, r *http.Request) *handlers.HTTPResponse {
 	var req *ExportsReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -88,6 +94,7 @@ func (h *ExportHandler) Serve(ctx context.Context, w http.ResponseWriter, r *htt
 		Compression:       bigquery.Compression(req.ToGCS.Compression),
 	}
 
+	collector := events.NewCollector()
 	_, err = s.ExportShardingTables(ctx, to, req.Target.Project, req.Target.Dataset, &DateShardingTableTarget{
 		Prefix:        req.Target.TablePrefix,
 		ExpirationDay: req.Target.ExpirationDay,
@@ -96,7 +103,7 @@ func (h *ExportHandler) Serve(ctx context.Context, w http.ResponseWriter, r *htt
 	}, &ExportShardingTablesLimit{
 		TableSize:  req.Limit.TableSize,
 		TableCount: req.Limit.TableCount,
-	})
+	}, WithReporter(collector))
 	if err != nil {
 		return &handlers.HTTPResponse{
 			StatusCode: http.StatusInternalServerError,
@@ -106,5 +113,6 @@ func (h *ExportHandler) Serve(ctx context.Context, w http.ResponseWriter, r *htt
 
 	return &handlers.HTTPResponse{
 		StatusCode: http.StatusOK,
+		Body:       &ExportsResp{Events: collector.Events()},
 	}
 }
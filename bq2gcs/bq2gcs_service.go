@@ -8,6 +8,7 @@ import (
 	"unicode/utf8"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/events"
 	"google.golang.org/api/iterator"
 )
 
@@ -128,15 +129,11 @@ func (s *Service) ExportShardingTables(ctx context.Context, to *GCSReferenceForE
 			return targetTableIDs, fmt.Errorf("failed target match : %w", err)
 		}
 		if !ok {
-			if opt.streamLogFn != nil {
-				opt.streamLogFn(fmt.Sprintf("%s is not match", table.TableID))
-			}
+			opt.report(ctx, &events.Event{Type: events.Skipped, Resource: table.TableID, Reason: "not match"})
 			continue
 		}
-		msg := fmt.Sprintf("target %s", table.TableID)
-		if opt.dryRun {
-			msg = fmt.Sprintf("DryRun: %s", msg)
-		} else {
+		e := &events.Event{Type: events.Exported, Action: "export", Resource: table.TableID, After: to.URI, DryRun: opt.dryRun}
+		if !opt.dryRun {
 			meta, err := s.BQ.DatasetInProject(projectID, datasetID).Table(table.TableID).Metadata(ctx)
 			if err != nil {
 				return nil, fmt.Errorf("failed get metadata table=%s : %w", table.TableID, err)
@@ -152,8 +149,10 @@ func (s *Service) ExportShardingTables(ctx context.Context, to *GCSReferenceForE
 			job, err := s.ExportShardingTable(ctx, to, projectID, datasetID, table.TableID)
 			if err != nil {
 				// TODO ErrorStatusで続きをすすめるかどうかを決めたいところではある
+				opt.report(ctx, &events.Event{Type: events.Failed, Action: "export", Resource: table.TableID, Err: err})
 				return nil, fmt.Errorf("failed run job table=%s : %w", table.TableID, err)
 			}
+			e.Action = fmt.Sprintf("export job:%s", job.ID())
 			if jobFunc != nil {
 				jobFunc(ctx, job.ID())
 			}
@@ -163,16 +162,12 @@ func (s *Service) ExportShardingTables(ctx context.Context, to *GCSReferenceForE
 					return targetTableIDs, fmt.Errorf("failed job.Wait() table=%s : %w", table.TableID, err)
 				}
 				if sts.Err() != nil {
-					return targetTableIDs, fmt.Errorf("failed job.Status.Err table=%s : %w", table.TableID, err)
-				}
-				if opt.streamLogFn != nil {
-					opt.streamLogFn(fmt.Sprintf("%s job:%s", table.TableID, job.ID()))
+					opt.report(ctx, &events.Event{Type: events.Failed, Action: e.Action, Resource: table.TableID, Err: sts.Err()})
+					return targetTableIDs, fmt.Errorf("failed job.Status.Err table=%s : %w", table.TableID, sts.Err())
 				}
 			}
 		}
-		if opt.streamLogFn != nil {
-			opt.streamLogFn(msg)
-		}
+		opt.report(ctx, e)
 		targetTableIDs = append(targetTableIDs, table.TableID)
 		workTableCount++
 	}
@@ -0,0 +1,112 @@
+package bigquery
+
+import (
+	"fmt"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditProjects  []string
+	allowedDomains []string
+	auditFormat    string
+	failOnSeverity string
+)
+
+func cmdAudit() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "audit",
+		Short:   "Audit the security posture of datasets",
+		Long:    "Scan every dataset and report public access, grants to external domains, missing CMEK, missing default expiration, datasets without labels and authorized views.",
+		Example: "gcptoolbox bq --project hoge audit --projects hoge,fuga --allowed-domain example.com --output gs://bucket/audit.csv --format csv --fail-on high",
+		Args:    cobra.NoArgs,
+		RunE:    runAudit,
+	}
+	cmd.Flags().StringSliceVar(&auditProjects, "projects", nil, "Comma separated project IDs to audit. If not specified, --project is audited")
+	cmd.Flags().StringSliceVar(&allowedDomains, "allowed-domain", nil, "domain that is allowed to be granted access. It can be specified multiple times. If not specified, external domain grants are not checked")
+	cmd.Flags().StringVar(&auditFormat, "format", "json", "format of --output. json|csv")
+	cmd.Flags().StringVar(&outputPath, "output", "", "File path or gs:// path to write the findings")
+	cmd.Flags().StringVar(&failOnSeverity, "fail-on", "", "Exit with non-zero status when there are findings of this severity or higher. info|low|medium|high|critical")
+	return cmd
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if auditFormat != "json" && auditFormat != "csv" {
+		return fmt.Errorf("invalid --format %s", auditFormat)
+	}
+	var failOn tables.Severity
+	if failOnSeverity != "" {
+		v, err := tables.ParseSeverity(failOnSeverity)
+		if err != nil {
+			return fmt.Errorf("invalid --fail-on : %w", err)
+		}
+		failOn = v
+	}
+
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		projects := auditProjects
+		if len(projects) == 0 {
+			projects = []string{projectID}
+		}
+		fmt.Printf("Projects=%v\n", projects)
+		fmt.Printf("AllowedDomains=%v\n", allowedDomains)
+		fmt.Println()
+
+		cfg := &tables.AuditConfig{AllowedDomains: allowedDomains}
+		var findings []*tables.AuditFinding
+		for _, p := range projects {
+			l, err := s.AuditDatasets(ctx, p, cfg)
+			if err != nil {
+				return fmt.Errorf("failed audit %s : %w", p, err)
+			}
+			findings = append(findings, l...)
+		}
+
+		counts := map[tables.Severity]int{}
+		for _, v := range findings {
+			counts[v.Severity]++
+			msg := fmt.Sprintf("[%s] %s.%s %s %s", v.Severity, v.ProjectID, v.DatasetID, v.Rule, v.Message)
+			if v.Member != "" {
+				msg = fmt.Sprintf("%s member=%s role=%s", msg, v.Member, v.Role)
+			}
+			fmt.Println(msg)
+		}
+		fmt.Println()
+		fmt.Printf("%d findings. critical=%d high=%d medium=%d low=%d info=%d\n", len(findings),
+			counts[tables.SeverityCritical], counts[tables.SeverityHigh], counts[tables.SeverityMedium], counts[tables.SeverityLow], counts[tables.SeverityInfo])
+
+		if outputPath != "" {
+			var err error
+			switch auditFormat {
+			case "csv":
+				err = writeCSV(ctx, outputPath, auditCSVHeader, auditCSVRecords(findings))
+			default:
+				err = writeJSONLines(ctx, outputPath, findings)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("created %s\n", outputPath)
+		}
+
+		if failOnSeverity != "" {
+			if highest, ok := tables.MaxSeverity(findings); ok && highest >= failOn {
+				return fmt.Errorf("exists findings of severity %s or higher", failOn)
+			}
+		}
+		fmt.Println("Done")
+		return nil
+	})
+}
+
+var auditCSVHeader = []string{"projectID", "datasetID", "rule", "severity", "member", "role", "message"}
+
+func auditCSVRecords(findings []*tables.AuditFinding) [][]string {
+	records := make([][]string, 0, len(findings))
+	for _, v := range findings {
+		records = append(records, []string{v.ProjectID, v.DatasetID, string(v.Rule), v.Severity.String(), v.Member, v.Role, v.Message})
+	}
+	return records
+}
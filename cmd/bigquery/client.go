@@ -0,0 +1,39 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/apstndb/adcplus/tokensource"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/sinmetalcraft/gcptoolbox/cmd/contexter"
+	"google.golang.org/api/option"
+)
+
+// withTablesService is BigQuery Clientとtables.Serviceを作ってfnを実行する
+func withTablesService(ctx context.Context, fn func(projectID string, s *tables.Service) error) error {
+	projectID, ok := contexter.ProjectID(ctx)
+	if !ok {
+		return fmt.Errorf("project required")
+	}
+	ts, err := tokensource.SmartAccessTokenSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	bq, err := bigquery.NewClient(ctx, projectID, option.WithTokenSource(ts))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := bq.Close(); err != nil {
+			fmt.Printf("FIY: failed bq.Close %s", err)
+		}
+	}()
+	s, err := tables.NewService(ctx, bq)
+	if err != nil {
+		return err
+	}
+	return fn(projectID, s)
+}
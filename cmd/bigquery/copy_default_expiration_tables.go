@@ -14,6 +14,8 @@ import (
 var (
 	overwriteTableExpiration bool
 	baseDate                 string
+	concurrency              int
+	rateLimit                float64
 )
 
 func cmdCopyDefaultExpirationTables() *cobra.Command {
@@ -28,10 +30,14 @@ func cmdCopyDefaultExpirationTables() *cobra.Command {
 	cmd.Flags().StringVar(&baseDate, "base-date", "", "Select a date to base the table expiration on. CreationTime(default)|LastModifiedTime|TableSuffix")
 	cmd.Flags().BoolVar(&overwriteTableExpiration, "overwrite-table-expiration", false, "It will be overwritten even if there is already an expiration in the table")
 	cmd.Flags().BoolVar(&dryRun, "dryrun", false, "Display the target table but do not actually process it")
+	cmd.Flags().StringVar(&journalPath, "journal", "", "File path or gs:// path to record the expiration of tables before updating. It can be restored with bq undo")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 10, "Number of tables to update concurrently")
+	cmd.Flags().Float64Var(&rateLimit, "rate-limit", 20, "Maximum number of table updates per second. 0 is unlimited")
+	cmd.Flags().BoolVar(&ignoreDependents, "force", false, "Update even if views or routines reference the tables")
 	return cmd
 }
 
-func runCopyDefaultExpirationTables(cmd *cobra.Command, args []string) error {
+func runCopyDefaultExpirationTables(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	projectID, ok := contexter.ProjectID(ctx)
 	if !ok {
@@ -60,6 +66,9 @@ func runCopyDefaultExpirationTables(cmd *cobra.Command, args []string) error {
 	fmt.Printf("DatasetID=%s\n", datasetID)
 	fmt.Printf("OverwriteTableExpiration=%t\n", overwriteTableExpiration)
 	fmt.Printf("DryRun=%t\n", dryRun)
+	fmt.Printf("Journal=%s\n", journalPath)
+	fmt.Printf("Concurrency=%d\n", concurrency)
+	fmt.Printf("RateLimit=%g\n", rateLimit)
 
 	if baseDate == "" {
 		baseDate = tables.CreationTime.String()
@@ -73,16 +82,45 @@ func runCopyDefaultExpirationTables(cmd *cobra.Command, args []string) error {
 	fmt.Println("Start copying default table expiration to tables")
 	fmt.Println()
 
+	contention := &tables.ContentionStats{}
 	var ops []tables.APIOptions
 	ops = append(ops, tables.WithBaseDate(baseDate))
+	ops = append(ops, tables.WithContentionStats(contention))
+	ops = append(ops, tables.WithConcurrency(concurrency))
+	if rateLimit > 0 {
+		ops = append(ops, tables.WithRateLimit(rateLimit, int(max(rateLimit, 1))))
+	}
 	if overwriteTableExpiration {
 		ops = append(ops, tables.WithOverwriteExpiration())
 	}
 	if dryRun {
 		ops = append(ops, tables.WithDryRun())
 	}
+	// Expirationを設定すると参照しているViewが壊れる可能性があるので確認する
+	tableIDs, err := s.ListTableIDs(ctx, projectID, datasetID, "")
+	if err != nil {
+		return err
+	}
+	if err := checkDependents(ctx, s, projectID, datasetID, tableIDs); err != nil {
+		return err
+	}
 
-	if err := s.UpdateTablesExpirationFromDatasetDefaultSetting(ctx, projectID, datasetID, ops...); err != nil {
+	if journalPath != "" && !dryRun {
+		journal, closer, err := createJournal(ctx, journalPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed journal close : %w", closeErr)
+			}
+		}()
+		ops = append(ops, tables.WithJournal(journal))
+	}
+
+	err = s.UpdateTablesExpirationFromDatasetDefaultSetting(ctx, projectID, datasetID, ops...)
+	printContentionStats(contention)
+	if err != nil {
 		return err
 	}
 
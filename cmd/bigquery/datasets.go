@@ -0,0 +1,214 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	datasetPattern       string
+	datasetLabelFilters  []string
+	tableExpiration      string
+	partitionExpiration  string
+	propagateExpirations bool
+)
+
+func cmdDatasets() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "datasets",
+		Short: "Manage datasets in the project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return fmt.Errorf("Command name argument expected.")
+		},
+	}
+	cmd.PersistentFlags().StringVar(&datasetPattern, "pattern", "", "dataset ID pattern. eg. logs_*")
+	cmd.PersistentFlags().StringSliceVar(&datasetLabelFilters, "label", nil, "label the dataset must have. key=value or key. It can be specified multiple times")
+
+	list := &cobra.Command{
+		Use:     "list",
+		Short:   "List default expirations of datasets",
+		Example: "gcptoolbox bq --project hoge datasets list --pattern logs_*",
+		Args:    cobra.NoArgs,
+		RunE:    runDatasetsList,
+	}
+
+	set := &cobra.Command{
+		Use:     "set-default-expiration",
+		Short:   "Update default table and partition expirations of datasets",
+		Example: "gcptoolbox bq --project hoge datasets set-default-expiration --label env=dev --table-expiration 720h --propagate",
+		Args:    cobra.NoArgs,
+		RunE:    runDatasetsSetDefaultExpiration,
+	}
+	set.Flags().StringVar(&tableExpiration, "table-expiration", "", "default table expiration. never clears the setting. If not specified, it is not changed")
+	set.Flags().StringVar(&partitionExpiration, "partition-expiration", "", "default partition expiration. never clears the setting. If not specified, it is not changed")
+	set.Flags().BoolVar(&propagateExpirations, "propagate", false, "Copy the new default table expiration to existing tables in the updated datasets")
+	set.Flags().BoolVar(&overwriteTableExpiration, "overwrite-table-expiration", false, "With --propagate, it will be overwritten even if there is already an expiration in the table")
+	set.Flags().IntVar(&concurrency, "concurrency", 10, "With --propagate, number of tables to update concurrently")
+	set.Flags().BoolVar(&ignoreDependents, "force", false, "With --propagate, update even if views or routines reference the tables")
+	set.Flags().StringVar(&journalPath, "journal", "", "With --propagate, file path or gs:// path to record the expiration of tables before updating. It can be restored with bq undo")
+	set.Flags().BoolVar(&dryRun, "dryrun", false, "Display the changes but do not actually process it")
+
+	cmd.AddCommand(list, set)
+	return cmd
+}
+
+func runDatasetsList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	filter, err := datasetFilter()
+	if err != nil {
+		return err
+	}
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		l, err := s.ListDatasetExpirations(ctx, projectID, filter)
+		if err != nil {
+			return err
+		}
+		for _, v := range l {
+			fmt.Printf("%s table=%s partition=%s\n", v.DatasetID, formatExpiration(v.DefaultTableExpiration), formatExpiration(v.DefaultPartitionExpiration))
+		}
+		return nil
+	})
+}
+
+func runDatasetsSetDefaultExpiration(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	filter, err := datasetFilter()
+	if err != nil {
+		return err
+	}
+	update := &tables.DatasetExpirationUpdate{}
+	if tableExpiration != "" {
+		v, err := parseDurationParam(tableExpiration)
+		if err != nil {
+			return err
+		}
+		d := v.Duration()
+		update.DefaultTableExpiration = &d
+	}
+	if partitionExpiration != "" {
+		v, err := parseDurationParam(partitionExpiration)
+		if err != nil {
+			return err
+		}
+		d := v.Duration()
+		update.DefaultPartitionExpiration = &d
+	}
+	if update.DefaultTableExpiration == nil && update.DefaultPartitionExpiration == nil {
+		return fmt.Errorf("--table-expiration or --partition-expiration required")
+	}
+
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("Pattern=%s\n", datasetPattern)
+		fmt.Printf("Labels=%s\n", strings.Join(datasetLabelFilters, ","))
+		fmt.Printf("TableExpiration=%s\n", tableExpiration)
+		fmt.Printf("PartitionExpiration=%s\n", partitionExpiration)
+		fmt.Printf("Propagate=%t\n", propagateExpirations)
+		fmt.Printf("Journal=%s\n", journalPath)
+		fmt.Printf("DryRun=%t\n", dryRun)
+		fmt.Println()
+
+		var ops []tables.APIOptions
+		if dryRun {
+			ops = append(ops, tables.WithDryRun())
+		}
+		changes, err := s.UpdateDatasetsDefaultExpiration(ctx, projectID, filter, update, ops...)
+		if err != nil {
+			return err
+		}
+		var changed int
+		for _, v := range changes {
+			if v.Changed {
+				changed++
+			}
+		}
+		fmt.Println()
+		fmt.Printf("%d of %d datasets changed\n", changed, len(changes))
+
+		if propagateExpirations {
+			if err := propagateDefaultExpirations(ctx, projectID, s, changes); err != nil {
+				return err
+			}
+		}
+		fmt.Println("Done")
+		return nil
+	})
+}
+
+// propagateDefaultExpirations is 更新したDatasetのDefault Table Expirationを既存のTableにコピーする
+func propagateDefaultExpirations(ctx context.Context, projectID string, s *tables.Service, changes []*tables.DatasetExpirationChange) (err error) {
+	if dryRun {
+		// DryRunではDatasetを更新していないので、新しいDefaultをTableにコピーすることはできない
+		fmt.Println("DryRun: skip propagating default table expiration to tables")
+		return nil
+	}
+
+	ops := []tables.APIOptions{tables.WithConcurrency(concurrency)}
+	if overwriteTableExpiration {
+		ops = append(ops, tables.WithOverwriteExpiration())
+	}
+	if journalPath != "" {
+		journal, closer, err := createJournal(ctx, journalPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed journal close : %w", closeErr)
+			}
+		}()
+		ops = append(ops, tables.WithJournal(journal))
+	}
+	var errs []error
+	for _, v := range changes {
+		if v.After.DefaultTableExpiration == 0 || v.After.DefaultTableExpiration == v.Before.DefaultTableExpiration {
+			continue
+		}
+		fmt.Println()
+		fmt.Printf("Propagate default table expiration to tables in %s\n", v.After.DatasetID)
+		// Expirationを設定すると参照しているViewが壊れる可能性があるので確認する
+		tableIDs, err := s.ListTableIDs(ctx, projectID, v.After.DatasetID, "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed list tables %s : %w", v.After.DatasetID, err))
+			continue
+		}
+		if err := checkDependents(ctx, s, projectID, v.After.DatasetID, tableIDs); err != nil {
+			errs = append(errs, fmt.Errorf("skip propagating %s : %w", v.After.DatasetID, err))
+			continue
+		}
+		if err := s.UpdateTablesExpirationFromDatasetDefaultSetting(ctx, projectID, v.After.DatasetID, ops...); err != nil {
+			errs = append(errs, fmt.Errorf("failed propagate %s : %w", v.After.DatasetID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// datasetFilter is flagからDatasetの条件を作る
+func datasetFilter() (*tables.DatasetFilter, error) {
+	filter := &tables.DatasetFilter{
+		Pattern: datasetPattern,
+		Labels:  map[string]string{},
+	}
+	for _, v := range datasetLabelFilters {
+		k, lv, _ := strings.Cut(v, "=")
+		if k == "" {
+			return nil, fmt.Errorf("%s is invalid label format. plz format key=value or key", v)
+		}
+		filter.Labels[k] = lv
+	}
+	return filter, nil
+}
+
+// formatExpiration is Expirationを表示用の文字列にする. 0は設定されていないのでnever
+func formatExpiration(d time.Duration) string {
+	if d == 0 {
+		return "never"
+	}
+	return d.String()
+}
@@ -1,34 +1,82 @@
 package bigquery
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/apstndb/adcplus/tokensource"
-	bqbox "github.com/sinmetalcraft/gcpbox/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
 	"github.com/sinmetalcraft/gcptoolbox/cmd/contexter"
 	"github.com/spf13/cobra"
 	"google.golang.org/api/option"
 )
 
+var (
+	snapshot              bool
+	snapshotDatasetID     string
+	snapshotExpirationStr string
+	restoreSnapshots      bool
+
+	tablePattern      string
+	fromDate          string
+	toDate            string
+	dateBase          string
+	minAge            string
+	protectedTables   []string
+	protectedListPath string
+	maxDelete         int
+	assumeYes         bool
+)
+
 func cmdDeleteTables() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "delete-tables",
-		Short: "delete-tables",
-		RunE:  runDeleteTables,
+		Use:     "delete-tables [prefix]",
+		Short:   "Delete tables matching the prefix and conditions",
+		Example: "gcptoolbox bq --project hoge delete-tables access_log_ --dataset logs --to 2023-12-31 --date-base TableSuffix --min-age 720h --max-delete 400",
+		Args:    cobra.MaximumNArgs(1),
+		RunE:    runDeleteTables,
 	}
 	cmd.Flags().StringVar(&datasetID, "dataset", "dataset", "dataset")
 	cmd.Flags().BoolVar(&dryRun, "dryrun", false, "dryrun")
+	cmd.Flags().StringVar(&journalPath, "journal", "", "File path or gs:// path to record the state of tables before deleting. It can be restored with bq undo")
+	cmd.Flags().BoolVar(&snapshot, "snapshot", false, "Create a table snapshot in --snapshot-dataset before deleting each table")
+	cmd.Flags().StringVar(&snapshotDatasetID, "snapshot-dataset", "", "Dataset to create table snapshots in. It must be in the same project")
+	cmd.Flags().StringVar(&snapshotExpirationStr, "snapshot-expiration", "720h", "Expiration of table snapshots. never is no expiration")
+	cmd.Flags().BoolVar(&restoreSnapshots, "restore-snapshots", false, "Instead of deleting, recreate tables matching the prefix from the latest snapshots in --snapshot-dataset")
+	cmd.Flags().StringVar(&tablePattern, "pattern", "", "regular expression the table ID must match")
+	cmd.Flags().StringVar(&fromDate, "from", "", "Only tables whose date is on or after this date are deleted. YYYY-MM-DD")
+	cmd.Flags().StringVar(&toDate, "to", "", "Only tables whose date is on or before this date are deleted. YYYY-MM-DD")
+	cmd.Flags().StringVar(&dateBase, "date-base", tables.CreationTime.String(), "Date of the table used by --from, --to and --min-age. CreationTime|LastModifiedTime|TableSuffix")
+	cmd.Flags().StringVar(&minAge, "min-age", "", "Tables younger than this are never deleted. eg. 720h")
+	cmd.Flags().StringSliceVar(&protectedTables, "protect", nil, "table ID that is never deleted. It can be specified multiple times")
+	cmd.Flags().StringVar(&protectedListPath, "protected-list", "", "File path or gs:// path of the table ID list that is never deleted")
+	cmd.Flags().IntVar(&maxDelete, "max-delete", 0, "Abort without deleting if more tables than this would be deleted. 0 is unlimited")
+	cmd.Flags().BoolVar(&assumeYes, "yes", false, "Delete without confirmation")
+	cmd.Flags().BoolVar(&ignoreDependents, "force", false, "Delete even if views or routines reference the tables")
 	return cmd
 }
 
-func runDeleteTables(cmd *cobra.Command, args []string) error {
+func runDeleteTables(cmd *cobra.Command, args []string) (err error) {
 	ctx := cmd.Context()
 	projectID, ok := contexter.ProjectID(ctx)
 	if !ok {
 		return fmt.Errorf("project required")
 	}
 
+	var tablePrefix string
+	if len(args) > 0 {
+		tablePrefix = args[0]
+	}
+	if (snapshot || restoreSnapshots) && snapshotDatasetID == "" {
+		return fmt.Errorf("--snapshot-dataset required")
+	}
+
 	ts, err := tokensource.SmartAccessTokenSource(ctx)
 	if err != nil {
 		return err
@@ -38,34 +86,208 @@ func runDeleteTables(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	bqboxService, err := bqbox.NewService(ctx, bq)
-	if err != nil {
-		return err
-	}
 	defer func() {
-		if err := bqboxService.Close(ctx); err != nil {
-			fmt.Printf("FIY: failed bqboxService.Close %s", err)
+		if err := bq.Close(); err != nil {
+			fmt.Printf("FIY: failed bq.Close %s", err)
 		}
 	}()
+	s, err := tables.NewService(ctx, bq)
+	if err != nil {
+		return err
+	}
 
-	var ops []bqbox.APIOptions
+	if restoreSnapshots {
+		return runRestoreSnapshots(ctx, s, projectID, tablePrefix)
+	}
+
+	sel, err := tableSelector(ctx, tablePrefix)
+	if err != nil {
+		return err
+	}
+
+	var ops []tables.APIOptions
 	fmt.Println("bigquery delete tables")
 	fmt.Printf("ProjectID=%s\n", projectID)
 	fmt.Printf("DatasetID=%s\n", datasetID)
-	fmt.Printf("TablePrefix=%s\n", args[0])
+	fmt.Printf("TablePrefix=%s\n", tablePrefix)
+	fmt.Printf("Pattern=%s\n", tablePattern)
+	fmt.Printf("From=%s\n", fromDate)
+	fmt.Printf("To=%s\n", toDate)
+	fmt.Printf("DateBase=%s\n", sel.DateBase)
+	fmt.Printf("MinAge=%s\n", minAge)
+	fmt.Printf("Protected=%d tables\n", len(sel.Protected))
+	fmt.Printf("MaxDelete=%d\n", maxDelete)
 	fmt.Printf("DryRun=%t\n", dryRun)
+	fmt.Printf("Journal=%s\n", journalPath)
 	if dryRun {
-		ops = append(ops, bqbox.WithDryRun())
+		ops = append(ops, tables.WithDryRun())
+	}
+	if snapshot {
+		expiration, err := parseDurationParam(snapshotExpirationStr)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("SnapshotDataset=%s\n", snapshotDatasetID)
+		fmt.Printf("SnapshotExpiration=%s\n", expiration)
+		ops = append(ops, tables.WithSnapshot(snapshotDatasetID, expiration.Duration()))
 	}
 	fmt.Println()
-	msgs, err := bqboxService.DeleteTablesByTablePrefix(ctx, projectID, datasetID, args[0], ops...)
+
+	selected, err := s.SelectTables(ctx, projectID, datasetID, sel)
 	if err != nil {
 		return err
 	}
-	for _, msg := range msgs {
-		fmt.Println(msg)
+	var totalBytes int64
+	tableIDs := make([]string, 0, len(selected))
+	for _, v := range selected {
+		totalBytes += v.NumBytes
+		tableIDs = append(tableIDs, v.TableID)
 	}
 	fmt.Println()
+	fmt.Printf("%d tables selected. total %d bytes (%.2f GiB)\n", len(selected), totalBytes, float64(totalBytes)/tables.GiB)
+	if len(selected) == 0 {
+		fmt.Println("Done")
+		return nil
+	}
+	if maxDelete > 0 && len(selected) > maxDelete {
+		return fmt.Errorf("%d tables would be deleted, exceeding --max-delete=%d", len(selected), maxDelete)
+	}
+	if err := checkDependents(ctx, s, projectID, datasetID, tableIDs); err != nil {
+		return err
+	}
+	if !dryRun && !assumeYes {
+		ok, err := confirm(cmd.InOrStdin(), fmt.Sprintf("Delete %d tables (%.2f GiB) in %s.%s?", len(selected), float64(totalBytes)/tables.GiB, projectID, datasetID))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Canceled")
+			return nil
+		}
+	}
+
+	if journalPath != "" && !dryRun {
+		journal, closer, err := createJournal(ctx, journalPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed journal close : %w", closeErr)
+			}
+		}()
+		ops = append(ops, tables.WithJournal(journal))
+	}
+	deleted, err := s.DeleteTables(ctx, projectID, datasetID, tableIDs, ops...)
+	fmt.Println()
+	fmt.Printf("%d tables deleted\n", len(deleted))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Done")
+	return nil
+}
+
+// tableSelector is flagから削除するTableの条件を作る
+func tableSelector(ctx context.Context, tablePrefix string) (*tables.TableSelector, error) {
+	if tablePrefix == "" && tablePattern == "" {
+		// 誤ってDatasetの全てのTableを消さないように、TableIDの条件を必須にする
+		return nil, fmt.Errorf("prefix or --pattern required")
+	}
+
+	sel := &tables.TableSelector{
+		Prefix:    tablePrefix,
+		Protected: map[string]bool{},
+	}
+	if tablePattern != "" {
+		p, err := regexp.Compile(tablePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pattern %s : %w", tablePattern, err)
+		}
+		sel.Pattern = p
+	}
+	base, err := tables.ParseBaseDate(dateBase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --date-base %s : %w", dateBase, err)
+	}
+	sel.DateBase = base
+	if fromDate != "" {
+		v, err := time.Parse("2006-01-02", fromDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --from %s : %w", fromDate, err)
+		}
+		sel.From = v
+	}
+	if toDate != "" {
+		v, err := time.Parse("2006-01-02", toDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --to %s : %w", toDate, err)
+		}
+		// --toの日を含めるので、次の日より前を対象にする
+		sel.To = v.AddDate(0, 0, 1)
+	}
+	if minAge != "" {
+		v, err := parseDurationParam(minAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --min-age %s : %w", minAge, err)
+		}
+		// 0以下だと安全装置として働かないので、指定ミスで無効にならないようにする
+		if v.Duration() <= 0 {
+			return nil, fmt.Errorf("--min-age requires a positive duration. %s is not allowed", minAge)
+		}
+		sel.MinAge = v.Duration()
+	}
+	for _, v := range protectedTables {
+		sel.Protected[v] = true
+	}
+	if protectedListPath != "" {
+		l, err := readTableList(ctx, protectedListPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed read protected list %s: %w", protectedListPath, err)
+		}
+		for k := range l {
+			sel.Protected[k] = true
+		}
+	}
+	return sel, nil
+}
+
+// confirm is messageを表示して、yが入力された場合にtrueを返す
+func confirm(r io.Reader, message string) (bool, error) {
+	fmt.Printf("%s [y/N]: ", message)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func runRestoreSnapshots(ctx context.Context, s *tables.Service, projectID string, tablePrefix string) error {
+	fmt.Println("bigquery restore tables from snapshots")
+	fmt.Printf("ProjectID=%s\n", projectID)
+	fmt.Printf("DatasetID=%s\n", datasetID)
+	fmt.Printf("TablePrefix=%s\n", tablePrefix)
+	fmt.Printf("SnapshotDataset=%s\n", snapshotDatasetID)
+	fmt.Printf("DryRun=%t\n", dryRun)
+	fmt.Println()
+
+	var ops []tables.APIOptions
+	if dryRun {
+		ops = append(ops, tables.WithDryRun())
+	}
+	results, err := s.RestoreTablesFromSnapshots(ctx, projectID, datasetID, tablePrefix, snapshotDatasetID, ops...)
+	fmt.Println()
+	var restored int
+	for _, v := range results {
+		if v.Restored {
+			restored++
+		}
+	}
+	fmt.Printf("%d of %d tables restored\n", restored, len(results))
+	if err != nil {
+		return err
+	}
 	fmt.Println("Done")
 	return nil
 }
@@ -0,0 +1,36 @@
+package bigquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+func TestTableSelectorMinAge(t *testing.T) {
+	dateBase = tables.CreationTime.String()
+	defer func() {
+		dateBase = ""
+		minAge = ""
+	}()
+
+	minAge = "30d"
+	sel, err := tableSelector(context.Background(), "access_log_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := sel.MinAge, 30*24*time.Hour; g != e {
+		t.Errorf("want %s but got %s", e, g)
+	}
+
+	// 安全装置が無効になる指定はerrorにする
+	for _, v := range []string{"never", "0d", "0s"} {
+		t.Run(v, func(t *testing.T) {
+			minAge = v
+			if _, err := tableSelector(context.Background(), "access_log_"); err == nil {
+				t.Errorf("want error but got nil")
+			}
+		})
+	}
+}
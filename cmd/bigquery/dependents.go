@@ -0,0 +1,33 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+)
+
+var ignoreDependents bool
+
+// checkDependents is tableIDsを参照しているView, Routineがあれば表示して、--forceが指定されていなければerrorを返す
+func checkDependents(ctx context.Context, s *tables.Service, projectID string, datasetID string, tableIDs []string) error {
+	dependents, err := s.FindDependents(ctx, projectID, datasetID, tableIDs)
+	if err != nil {
+		return fmt.Errorf("failed check dependents : %w", err)
+	}
+	if len(dependents) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Printf("%d views or routines reference the target tables\n", len(dependents))
+	for _, d := range dependents {
+		fmt.Printf("  %s -> %s\n", d, strings.Join(d.References, ", "))
+	}
+	if ignoreDependents {
+		fmt.Println("warning: continue because --force is specified")
+		return nil
+	}
+	return fmt.Errorf("%d views or routines reference the target tables. specify --force to continue", len(dependents))
+}
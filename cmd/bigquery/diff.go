@@ -0,0 +1,141 @@
+package bigquery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+func cmdDiff() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff [before] [after]",
+		Short: "Diff of the schema and settings of two tables or two datasets",
+		Long: "Diff of the schema and settings of two tables or two datasets. Specify project.dataset or project.dataset.table (project:dataset.table is also accepted). " +
+			"It exits with non-zero status when there are differences.",
+		Example: "gcptoolbox bq diff hoge-dev.logs hoge-prod.logs",
+		Args:    cobra.ExactArgs(2),
+		RunE:    runDiff,
+	}
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	before, err := parseResourceReference(args[0])
+	if err != nil {
+		return err
+	}
+	after, err := parseResourceReference(args[1])
+	if err != nil {
+		return err
+	}
+	if (before.tableID == "") != (after.tableID == "") {
+		return fmt.Errorf("specify two tables or two datasets")
+	}
+
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		bq := s.Client()
+		if before.tableID != "" {
+			d, err := s.DiffTables(ctx, before.table(bq), after.table(bq))
+			if err != nil {
+				return err
+			}
+			if !d.HasDiff() {
+				fmt.Println("no diff")
+				return nil
+			}
+			printTableDiff(d)
+			return errors.New("exists table diff")
+		}
+
+		d, err := s.DiffDatasets(ctx, before.dataset(bq), after.dataset(bq))
+		if err != nil {
+			return err
+		}
+		if !d.HasDiff() {
+			fmt.Println("no diff")
+			return nil
+		}
+		fmt.Printf("--- %s\n", d.Before)
+		fmt.Printf("+++ %s\n", d.After)
+		for _, v := range d.Properties {
+			fmt.Printf("%s: %q -> %q\n", v.Name, v.Before, v.After)
+		}
+		for _, v := range d.MissingTables {
+			fmt.Printf("- table %s\n", v)
+		}
+		for _, v := range d.ExtraTables {
+			fmt.Printf("+ table %s\n", v)
+		}
+		for _, v := range d.Tables {
+			fmt.Println()
+			printTableDiff(v)
+		}
+		return errors.New("exists dataset diff")
+	})
+}
+
+func printTableDiff(d *tables.TableDiff) {
+	fmt.Printf("--- %s\n", d.Before)
+	fmt.Printf("+++ %s\n", d.After)
+	for _, v := range d.Properties {
+		fmt.Printf("%s: %q -> %q\n", v.Name, v.Before, v.After)
+	}
+	printFieldDiffs(d.Fields, "")
+}
+
+func printFieldDiffs(diffs []*schemas.FieldDiff, indent string) {
+	for _, v := range diffs {
+		switch v.Kind {
+		case schemas.FieldAdded:
+			fmt.Printf("%s+ %s %s\n", indent, v.Path, v.After)
+		case schemas.FieldRemoved:
+			fmt.Printf("%s- %s %s\n", indent, v.Path, v.Before)
+		default:
+			fmt.Printf("%s%s %s: %q -> %q\n", indent, v.Kind, v.Path, v.Before, v.After)
+		}
+	}
+}
+
+// resourceReference is project.dataset or project.dataset.table
+type resourceReference struct {
+	projectID string
+	datasetID string
+	tableID   string
+}
+
+func (r *resourceReference) dataset(bq *bigquery.Client) *bigquery.Dataset {
+	return bq.DatasetInProject(r.projectID, r.datasetID)
+}
+
+func (r *resourceReference) table(bq *bigquery.Client) *bigquery.Table {
+	return r.dataset(bq).Table(r.tableID)
+}
+
+// parseResourceReference is project.dataset, project.dataset.table, project:dataset, project:dataset.table を分解する
+func parseResourceReference(v string) (*resourceReference, error) {
+	var parts []string
+	if project, rest, ok := strings.Cut(v, ":"); ok {
+		parts = append([]string{project}, strings.Split(rest, ".")...)
+	} else {
+		parts = strings.Split(v, ".")
+	}
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("%s is invalid format. plz format project.dataset or project.dataset.table", v)
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return &resourceReference{projectID: parts[0], datasetID: parts[1]}, nil
+	case 3:
+		return &resourceReference{projectID: parts[0], datasetID: parts[1], tableID: parts[2]}, nil
+	}
+	return nil, fmt.Errorf("%s is invalid format. plz format project.dataset or project.dataset.table", v)
+}
@@ -0,0 +1,42 @@
+package bigquery
+
+import (
+	"testing"
+)
+
+func TestParseResourceReference(t *testing.T) {
+	cases := []struct {
+		name string
+		v    string
+		want resourceReference
+	}{
+		{"dataset", "hoge.logs", resourceReference{projectID: "hoge", datasetID: "logs"}},
+		{"table", "hoge.logs.access_log", resourceReference{projectID: "hoge", datasetID: "logs", tableID: "access_log"}},
+		{"bq style dataset", "hoge:logs", resourceReference{projectID: "hoge", datasetID: "logs"}},
+		{"bq style table", "hoge:logs.access_log", resourceReference{projectID: "hoge", datasetID: "logs", tableID: "access_log"}},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResourceReference(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("want %+v but got %+v", tt.want, *got)
+			}
+		})
+	}
+}
+
+func TestParseResourceReferenceError(t *testing.T) {
+	for _, v := range []string{"hoge", "hoge..logs", "a.b.c.d", "hoge:"} {
+		v := v
+		t.Run(v, func(t *testing.T) {
+			if _, err := parseResourceReference(v); err == nil {
+				t.Errorf("want error but got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package bigquery
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// ExpirationParam is Expirationの指定
+//
+// 相対的な期間, 絶対的な日付, Neverのいずれか
+type ExpirationParam struct {
+	// text is 指定された文字列
+	text string
+
+	years    int
+	months   int
+	days     int
+	duration time.Duration
+
+	// absolute is 絶対的な日付で指定された場合の日付
+	absolute time.Time
+
+	isNever bool
+}
+
+func (p *ExpirationParam) String() string {
+	if p.isNever {
+		return "Never"
+	}
+	if p.IsAbsolute() {
+		return p.absolute.Format("2006-01-02")
+	}
+	return p.text
+}
+
+// IsAbsolute is 絶対的な日付で指定されたかどうか
+func (p *ExpirationParam) IsAbsolute() bool {
+	return !p.absolute.IsZero()
+}
+
+// Duration is 相対的な期間をtime.Durationで返す
+//
+// 月は30日, 年は365日として計算する. NeverとIsAbsoluteの場合は0
+func (p *ExpirationParam) Duration() time.Duration {
+	if p.isNever || p.IsAbsolute() {
+		return 0
+	}
+	return time.Duration(p.years*365+p.months*30+p.days)*24*time.Hour + p.duration
+}
+
+// ExpirationTime is baseTimeを基準にしたExpirationの時刻を返す
+//
+// 月と年はカレンダー通りに計算する. IsAbsoluteの場合はbaseTimeに関係なくその日付を返す
+func (p *ExpirationParam) ExpirationTime(baseTime time.Time) time.Time {
+	if p.isNever {
+		return bigquery.NeverExpire
+	}
+	if p.IsAbsolute() {
+		return p.absolute
+	}
+	return baseTime.AddDate(p.years, p.months, p.days).Add(p.duration)
+}
+
+// expirationTermPattern is 期間の1つの単位. moはmより先に評価する
+var expirationTermPattern = regexp.MustCompile(`(\d+)(y|mo|w|d|h|m|s)`)
+
+// parseExpirationParam is Expirationの指定を解析する
+//
+// 以下の形式を受け付ける
+//   - never
+//   - 絶対的な日付. eg. 2025-12-31
+//   - 単位付きの期間の組み合わせ. 単位は y(年), mo(月), w(週), d(日), h, m, s. eg. 365d, 1y6mo, 2w, 36h, 1d12h
+func parseExpirationParam(v string) (*ExpirationParam, error) {
+	if strings.ToLower(v) == "never" {
+		return &ExpirationParam{
+			isNever: true,
+		}, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return &ExpirationParam{
+			text:     v,
+			absolute: t,
+		}, nil
+	}
+
+	p := &ExpirationParam{text: v}
+	matches := expirationTermPattern.FindAllStringSubmatchIndex(v, -1)
+	var end int
+	for _, m := range matches {
+		if m[0] != end {
+			break
+		}
+		end = m[1]
+		n, err := strconv.Atoi(v[m[2]:m[3]])
+		if err != nil {
+			return nil, fmt.Errorf("%s is invalid duration format: %w", v, err)
+		}
+		switch v[m[4]:m[5]] {
+		case "y":
+			p.years += n
+		case "mo":
+			p.months += n
+		case "w":
+			p.days += n * 7
+		case "d":
+			p.days += n
+		case "h":
+			p.duration += time.Duration(n) * time.Hour
+		case "m":
+			p.duration += time.Duration(n) * time.Minute
+		case "s":
+			p.duration += time.Duration(n) * time.Second
+		}
+	}
+	if len(matches) == 0 || end != len(v) {
+		return nil, fmt.Errorf("%s is invalid duration format. eg. 365d, 1y6mo, 2w, 36h, 2025-12-31, never", v)
+	}
+	return p, nil
+}
+
+// parseDurationParam is 期間だけを受け付けるparseExpirationParam
+//
+// PartitionのExpirationやSnapshotのExpirationのように、日付では指定できないものに使う
+func parseDurationParam(v string) (*ExpirationParam, error) {
+	p, err := parseExpirationParam(v)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsAbsolute() {
+		return nil, fmt.Errorf("%s is absolute date. plz specify duration. eg. 365d", v)
+	}
+	return p, nil
+}
@@ -0,0 +1,67 @@
+package bigquery
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestParseExpirationParam(t *testing.T) {
+	base := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name         string
+		v            string
+		wantTime     time.Time
+		wantDuration time.Duration
+	}{
+		{"hours", "36h", base.Add(36 * time.Hour), 36 * time.Hour},
+		{"days", "365d", time.Date(2025, 1, 30, 12, 0, 0, 0, time.UTC), 365 * 24 * time.Hour},
+		{"weeks", "2w", time.Date(2024, 2, 14, 12, 0, 0, 0, time.UTC), 14 * 24 * time.Hour},
+		{"month", "1mo", time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), 30 * 24 * time.Hour},
+		{"year and month", "1y6mo", time.Date(2025, 7, 31, 12, 0, 0, 0, time.UTC), (365 + 180) * 24 * time.Hour},
+		{"day and hours", "1d12h", base.Add(36 * time.Hour), 36 * time.Hour},
+		{"minutes", "90m", base.Add(90 * time.Minute), 90 * time.Minute},
+		{"absolute", "2025-12-31", time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), 0},
+		{"never", "never", bigquery.NeverExpire, 0},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpirationParam(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.wantTime, got.ExpirationTime(base); !e.Equal(g) {
+				t.Errorf("want %s but got %s", e, g)
+			}
+			if e, g := tt.wantDuration, got.Duration(); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestParseExpirationParamError(t *testing.T) {
+	for _, v := range []string{"", "365", "d", "1x", "1d x", "2025-13-01", "-1d"} {
+		t.Run(v, func(t *testing.T) {
+			if _, err := parseExpirationParam(v); err == nil {
+				t.Errorf("%q must be error", v)
+			}
+		})
+	}
+}
+
+func TestParseDurationParam(t *testing.T) {
+	if _, err := parseDurationParam("2025-12-31"); err == nil {
+		t.Errorf("absolute date must be error")
+	}
+	got, err := parseDurationParam("30d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 30*24*time.Hour, got.Duration(); e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
@@ -0,0 +1,211 @@
+package bigquery
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/apstndb/adcplus/tokensource"
+	gcsstrings "github.com/sinmetalcraft/gcptoolbox/cmd/storage/strings"
+	"google.golang.org/api/option"
+)
+
+// gcsFile is Cloud StorageのObjectのReader/WriterとClientをまとめてCloseする
+type gcsFile struct {
+	rw  io.Closer
+	gcs *storage.Client
+}
+
+func (f *gcsFile) Close() error {
+	var errs []error
+	if err := f.rw.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := f.gcs.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+type gcsWriter struct {
+	*storage.Writer
+	gcsFile
+}
+
+func (w *gcsWriter) Close() error {
+	return w.gcsFile.Close()
+}
+
+type gcsReader struct {
+	*storage.Reader
+	gcsFile
+}
+
+func (r *gcsReader) Close() error {
+	return r.gcsFile.Close()
+}
+
+// createFile is pathがgs://で始まる場合はCloud StorageのObjectに、それ以外はLocal Fileに書き込むWriterを返す
+func createFile(ctx context.Context, path string) (io.WriteCloser, error) {
+	if !strings.HasPrefix(path, "gs://") {
+		return os.Create(path)
+	}
+
+	bucket, object, err := gcsstrings.ResolutionBucketAndObjectPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %s :%w", path, err)
+	}
+	gcs, err := newStorageClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w := gcs.Bucket(bucket).Object(object).NewWriter(ctx)
+	return &gcsWriter{
+		Writer:  w,
+		gcsFile: gcsFile{rw: w, gcs: gcs},
+	}, nil
+}
+
+// openFile is pathがgs://で始まる場合はCloud StorageのObjectを、それ以外はLocal Fileを読み込むReaderを返す
+func openFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(path, "gs://") {
+		return os.Open(path)
+	}
+
+	bucket, object, err := gcsstrings.ResolutionBucketAndObjectPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %s :%w", path, err)
+	}
+	gcs, err := newStorageClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := gcs.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		if err := gcs.Close(); err != nil {
+			fmt.Printf("FIY: failed gcs.Close %s", err)
+		}
+		return nil, fmt.Errorf("failed read %s :%w", path, err)
+	}
+	return &gcsReader{
+		Reader:  r,
+		gcsFile: gcsFile{rw: r, gcs: gcs},
+	}, nil
+}
+
+func newStorageClient(ctx context.Context) (*storage.Client, error) {
+	ts, err := tokensource.SmartAccessTokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewClient(ctx, option.WithTokenSource(ts))
+}
+
+// writeTableList is TableIDを1行ずつpathに書き込む
+func writeTableList(ctx context.Context, path string, tableIDs []string) (err error) {
+	w, err := createFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	for _, v := range tableIDs {
+		if _, err := fmt.Fprintln(w, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile is dataをpathに書き込む
+func writeFile(ctx context.Context, path string, data []byte) (err error) {
+	w, err := createFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = w.Write(data)
+	return err
+}
+
+// writeJSONLines is lの要素を1行に1つのJSONでpathに書き込む
+func writeJSONLines[T any](ctx context.Context, path string, l []T) (err error) {
+	w, err := createFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	enc := json.NewEncoder(w)
+	for _, v := range l {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV is headerとrecordsをCSVでpathに書き込む
+func writeCSV(ctx context.Context, path string, header []string, records [][]string) (err error) {
+	w, err := createFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// readTableList is writeTableListで書き込んだTableIDの一覧を読み込む
+func readTableList(ctx context.Context, path string) (map[string]bool, error) {
+	r, err := openFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			fmt.Printf("warning: failed close %s err=%s\n", path, err)
+		}
+	}()
+
+	l := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		v := strings.TrimSpace(scanner.Text())
+		if v == "" {
+			continue
+		}
+		l[v] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,76 @@
+package bigquery
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+func cmdInventory() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "inventory",
+		Short:   "Export metadata of all tables as JSON lines",
+		Long:    "Export type, partitioning, clustering, rows, logical and physical bytes, creation and modified time, expiration and labels of every table in the project as JSON lines.",
+		Example: "gcptoolbox bq --project hoge inventory --output gs://bucket/inventory/20240101.json",
+		Args:    cobra.NoArgs,
+		RunE:    runInventory,
+	}
+	cmd.Flags().StringVar(&datasetPattern, "pattern", "", "dataset ID pattern. eg. logs_*")
+	cmd.Flags().StringSliceVar(&datasetLabelFilters, "label", nil, "label the dataset must have. key=value or key. It can be specified multiple times")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 10, "Number of tables to get metadata concurrently")
+	cmd.Flags().StringVar(&outputPath, "output", "", "File path or gs:// path to write. If not specified, a file is created in the current directory")
+	return cmd
+}
+
+func runInventory(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	filter, err := datasetFilter()
+	if err != nil {
+		return err
+	}
+
+	var fileName string
+	var count int
+	err = withTablesService(ctx, func(projectID string, s *tables.Service) (err error) {
+		fileName = outputPath
+		if fileName == "" {
+			fileName = fmt.Sprintf("bigquery-inventory.%s.%s.json", projectID, time.Now().Format(time.RFC3339))
+		}
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("DatasetPattern=%s\n", datasetPattern)
+		fmt.Printf("DatasetLabels=%v\n", datasetLabelFilters)
+		fmt.Printf("Output=%s\n", fileName)
+		fmt.Println()
+
+		file, err := createFile(ctx, fileName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil && err == nil {
+				// Cloud Storageの場合はCloseで書き込みが完了するので、失敗した場合はerrorにする
+				err = closeErr
+			}
+
+			if err != nil && !strings.HasPrefix(fileName, "gs://") {
+				// 処理が成功しなかった場合は、Exportしようとして作ったファイルを消す
+				if err := os.Remove(fileName); err != nil {
+					fmt.Printf("warning: failed file.Remove() err=%s", err)
+				}
+			}
+		}()
+
+		count, err = s.ExportInventory(ctx, file, projectID, filter, tables.WithConcurrency(concurrency))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d tables exported\n", count)
+	fmt.Printf("created %s\n", fileName)
+	return nil
+}
@@ -0,0 +1,376 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/apstndb/adcplus/tokensource"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+	"github.com/sinmetalcraft/gcptoolbox/cmd/contexter"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+var (
+	jobsRegion  string
+	costDays    int
+	topQueries  int
+	pricePerTiB float64
+
+	cancelUser       string
+	cancelLabels     []string
+	cancelJobType    string
+	cancelMinElapsed string
+	cancelMinBytes   int64
+
+	jobsFilePath string
+	pollInterval time.Duration
+)
+
+func cmdJobs() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Manage jobs in the project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return fmt.Errorf("Command name argument expected.")
+		},
+	}
+	cmd.PersistentFlags().StringVar(&jobsRegion, "region", "US", "region of jobs. eg. US, asia-northeast1")
+
+	exportCost := &cobra.Command{
+		Use:     "export-cost",
+		Short:   "Export query cost and slot usage per day, user and labels as JSON lines",
+		Long:    "Export query cost and slot usage per day, user and labels based on INFORMATION_SCHEMA.JOBS as JSON lines. The cost is estimated by on-demand pricing.",
+		Example: "gcptoolbox bq --project hoge jobs export-cost --region US --days 30",
+		Args:    cobra.NoArgs,
+		RunE:    runJobsExportCost,
+	}
+	exportCost.Flags().IntVar(&costDays, "days", 30, "Jobs created within this number of days are exported. max 180")
+	exportCost.Flags().IntVar(&topQueries, "top", jobs.DefaultTopQueries, "Number of most expensive queries included in each row")
+	exportCost.Flags().Float64Var(&pricePerTiB, "price-per-tib", jobs.OnDemandPricePerTiB, "USD per TiB of on-demand query")
+	exportCost.Flags().StringVar(&outputPath, "output", "", "File path or gs:// path to write. If not specified, a file is created in the current directory")
+
+	cancel := &cobra.Command{
+		Use:     "cancel",
+		Short:   "Cancel running and pending jobs matching the filters",
+		Long:    "Cancel running and pending jobs of all users in the project matching the filters. At least one filter is required. --region is not used because jobs in all regions are listed.",
+		Example: "gcptoolbox bq --project hoge jobs cancel --user scheduler@hoge.iam.gserviceaccount.com --min-elapsed 30m --dryrun",
+		Args:    cobra.NoArgs,
+		RunE:    runJobsCancel,
+	}
+	cancel.Flags().StringVar(&cancelUser, "user", "", "email of the user or service account who created the job")
+	cancel.Flags().StringSliceVar(&cancelLabels, "label", nil, "label the job must have. key=value or key. It can be specified multiple times")
+	cancel.Flags().StringVar(&cancelJobType, "type", "", "job type. QUERY|LOAD|EXTRACT|COPY")
+	cancel.Flags().StringVar(&cancelMinElapsed, "min-elapsed", "", "Only jobs running longer than this are canceled. eg. 30m")
+	cancel.Flags().Int64Var(&cancelMinBytes, "min-bytes-processed", 0, "Only jobs processing more bytes than this are canceled")
+	cancel.Flags().BoolVar(&dryRun, "dryrun", false, "Display the target jobs but do not actually cancel them")
+	cancel.Flags().BoolVar(&assumeYes, "yes", false, "Cancel without confirmation")
+
+	wait := &cobra.Command{
+		Use:     "wait [jobID...]",
+		Short:   "Wait for jobs to finish and print their status",
+		Long:    "Poll jobs concurrently until all of them finish, printing a status table whenever it changes. Job IDs are read from args and --file. --file accepts one job ID per line or the output of bq2gcs. Exit with non-zero status if any job failed.",
+		Example: "gcptoolbox bq --project hoge jobs wait --region asia-northeast1 --file bq2gcs.log",
+		RunE:    runJobsWait,
+	}
+	wait.Flags().StringVar(&jobsFilePath, "file", "", "File path or gs:// path of job IDs. One job ID per line, bq2gcs output or bq2gcs events")
+	wait.Flags().DurationVar(&pollInterval, "interval", jobs.DefaultPollInterval, "Interval of polling job status")
+	wait.Flags().IntVar(&concurrency, "concurrency", 10, "Number of jobs to poll concurrently")
+
+	cmd.AddCommand(exportCost)
+	cmd.AddCommand(cancel)
+	cmd.AddCommand(wait)
+	return cmd
+}
+
+// withJobsService is BigQuery Clientとjobs.Serviceを作ってfnを実行する
+func withJobsService(ctx context.Context, fn func(projectID string, s *jobs.Service) error) error {
+	projectID, ok := contexter.ProjectID(ctx)
+	if !ok {
+		return fmt.Errorf("project required")
+	}
+	ts, err := tokensource.SmartAccessTokenSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	bq, err := bigquery.NewClient(ctx, projectID, option.WithTokenSource(ts))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := bq.Close(); err != nil {
+			fmt.Printf("FIY: failed bq.Close %s", err)
+		}
+	}()
+	s, err := jobs.NewService(ctx, bq)
+	if err != nil {
+		return err
+	}
+	return fn(projectID, s)
+}
+
+func runJobsExportCost(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if costDays < 1 || costDays > 180 {
+		return fmt.Errorf("--days must be between 1 and 180")
+	}
+
+	var fileName string
+	err := withJobsService(ctx, func(projectID string, s *jobs.Service) (err error) {
+		end := time.Now()
+		cfg := &jobs.QueryCostConfig{
+			Location:    jobsRegion,
+			Start:       end.AddDate(0, 0, -costDays),
+			End:         end,
+			TopQueries:  topQueries,
+			PricePerTiB: pricePerTiB,
+		}
+
+		fileName = outputPath
+		if fileName == "" {
+			fileName = fmt.Sprintf("bigquery-query-cost.%s.%s.json", projectID, end.Format(time.RFC3339))
+		}
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("Region=%s\n", jobsRegion)
+		fmt.Printf("Start=%s\n", cfg.Start.Format(time.RFC3339))
+		fmt.Printf("End=%s\n", cfg.End.Format(time.RFC3339))
+		fmt.Printf("Output=%s\n", fileName)
+		fmt.Println()
+
+		file, err := createFile(ctx, fileName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil && err == nil {
+				// Cloud Storageの場合はCloseで書き込みが完了するので、失敗した場合はerrorにする
+				err = closeErr
+			}
+
+			if err != nil && !strings.HasPrefix(fileName, "gs://") {
+				// 処理が成功しなかった場合は、Exportしようとして作ったファイルを消す
+				if err := os.Remove(fileName); err != nil {
+					fmt.Printf("warning: failed file.Remove() err=%s", err)
+				}
+			}
+		}()
+
+		return s.ExportQueryCost(ctx, file, projectID, cfg)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %s\n", fileName)
+	return nil
+}
+
+// jobFilter is flagからCancelするJobの条件を作る
+func jobFilter() (*jobs.JobFilter, error) {
+	filter := &jobs.JobFilter{
+		UserEmail:         cancelUser,
+		Labels:            map[string]string{},
+		JobType:           strings.ToUpper(cancelJobType),
+		MinBytesProcessed: cancelMinBytes,
+	}
+	for _, v := range cancelLabels {
+		k, lv, _ := strings.Cut(v, "=")
+		if k == "" {
+			return nil, fmt.Errorf("%s is invalid label format. plz format key=value or key", v)
+		}
+		filter.Labels[k] = lv
+	}
+	switch filter.JobType {
+	case "", jobs.JobTypeQuery, jobs.JobTypeLoad, jobs.JobTypeExtract, jobs.JobTypeCopy:
+	default:
+		return nil, fmt.Errorf("invalid --type %s", cancelJobType)
+	}
+	if cancelMinElapsed != "" {
+		v, err := parseDurationParam(cancelMinElapsed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --min-elapsed %s : %w", cancelMinElapsed, err)
+		}
+		filter.MinElapsed = v.Duration()
+	}
+	if filter.UserEmail == "" && len(filter.Labels) == 0 && filter.JobType == "" && filter.MinElapsed == 0 && filter.MinBytesProcessed == 0 {
+		// 誤ってProjectの全てのJobをCancelしないように、条件を必須にする
+		return nil, fmt.Errorf("at least one filter required")
+	}
+	return filter, nil
+}
+
+func runJobsCancel(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	filter, err := jobFilter()
+	if err != nil {
+		return err
+	}
+
+	return withJobsService(ctx, func(projectID string, s *jobs.Service) error {
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("User=%s\n", filter.UserEmail)
+		fmt.Printf("Labels=%v\n", filter.Labels)
+		fmt.Printf("Type=%s\n", filter.JobType)
+		fmt.Printf("MinElapsed=%s\n", filter.MinElapsed)
+		fmt.Printf("MinBytesProcessed=%d\n", filter.MinBytesProcessed)
+		fmt.Printf("DryRun=%t\n", dryRun)
+		fmt.Println()
+
+		l, err := s.ListActiveJobs(ctx, projectID, filter)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		users := map[string]int{}
+		for _, v := range l {
+			users[v.UserEmail]++
+			fmt.Printf("%s %s %s user=%s elapsed=%s bytes=%d\n", v.JobID, v.State, v.JobType, v.UserEmail, v.Elapsed(now).Truncate(time.Second), v.BytesProcessed)
+		}
+		fmt.Println()
+		fmt.Printf("%d jobs matched\n", len(l))
+		for _, user := range slices.Sorted(maps.Keys(users)) {
+			fmt.Printf("  %s : %d jobs\n", user, users[user])
+		}
+		if len(l) == 0 {
+			fmt.Println("Done")
+			return nil
+		}
+		if !dryRun && !assumeYes {
+			ok, err := confirm(cmd.InOrStdin(), fmt.Sprintf("Cancel %d jobs in %s?", len(l), projectID))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println("Canceled")
+				return nil
+			}
+		}
+
+		var ops []jobs.APIOptions
+		if dryRun {
+			ops = append(ops, jobs.WithDryRun())
+		}
+		count, err := s.CancelJobs(ctx, l, ops...)
+		fmt.Println()
+		fmt.Printf("%d of %d jobs cancel requested\n", count, len(l))
+		if err != nil {
+			return err
+		}
+		fmt.Println("Done")
+		return nil
+	})
+}
+
+func runJobsWait(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ids := args
+	if jobsFilePath != "" {
+		l, err := readJobIDs(ctx, jobsFilePath)
+		if err != nil {
+			return fmt.Errorf("failed read job ids %s : %w", jobsFilePath, err)
+		}
+		ids = append(ids, l...)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("job ID or --file required")
+	}
+
+	return withJobsService(ctx, func(projectID string, s *jobs.Service) error {
+		refs := make([]*jobs.JobRef, 0, len(ids))
+		for _, v := range ids {
+			refs = append(refs, jobs.ParseJobRef(v, projectID, jobsRegion))
+		}
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("Region=%s\n", jobsRegion)
+		fmt.Printf("Jobs=%d\n", len(refs))
+		fmt.Println()
+
+		var last string
+		results, err := s.WatchJobs(ctx, refs, &jobs.WatchConfig{PollInterval: pollInterval, Concurrency: concurrency}, func(l []*jobs.WatchedJob) {
+			table := formatJobStatusTable(l)
+			if table == last {
+				return
+			}
+			last = table
+			fmt.Printf("%s\n%s\n", time.Now().Format(time.RFC3339), table)
+		})
+		if err != nil {
+			return err
+		}
+
+		var failed int
+		var files int64
+		for _, v := range results {
+			if v.Failed() {
+				failed++
+				fmt.Printf("failed %s reason=%s : %s\n", v.Ref.JobID, v.ErrorReason, v.Error)
+			}
+			for _, c := range v.DestinationURIFileCounts {
+				files += c
+			}
+		}
+		fmt.Printf("%d of %d jobs succeeded. %d files exported\n", len(results)-failed, len(results), files)
+		if failed > 0 {
+			return fmt.Errorf("%d jobs failed", failed)
+		}
+		fmt.Println("Done")
+		return nil
+	})
+}
+
+// formatJobStatusTable is Jobの状態を表にする
+func formatJobStatusTable(l []*jobs.WatchedJob) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB_ID\tTYPE\tSTATE\tFILES\tERROR")
+	for _, v := range l {
+		state := v.State
+		if v.Failed() {
+			state = "FAILED"
+		}
+		var files string
+		if len(v.DestinationURIFileCounts) > 0 {
+			var count int64
+			for _, c := range v.DestinationURIFileCounts {
+				count += c
+			}
+			files = strconv.FormatInt(count, 10)
+		}
+		reason := v.ErrorReason
+		if reason == "" && v.Error != "" {
+			reason = v.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", v.Ref.JobID, v.JobType, state, files, reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err.Error()
+	}
+	return b.String()
+}
+
+// readJobIDs is pathからJobIDの一覧を読み込む
+func readJobIDs(ctx context.Context, path string) ([]string, error) {
+	r, err := openFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			fmt.Printf("warning: failed close %s err=%s\n", path, err)
+		}
+	}()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return jobs.ParseJobIDs(data)
+}
@@ -0,0 +1,166 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var datasetLabels bool
+
+func cmdLabels() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "labels",
+		Short: "Manage labels of tables and datasets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return fmt.Errorf("Command name argument expected.")
+		},
+	}
+	cmd.PersistentFlags().StringVar(&prefix, "prefix", "", "table prefix. If not specified, all tables in the dataset are targeted")
+	cmd.PersistentFlags().BoolVar(&datasetLabels, "dataset-labels", false, "Target the labels of the dataset itself instead of the tables")
+
+	list := &cobra.Command{
+		Use:     "list [dataset]",
+		Short:   "List labels of tables",
+		Example: "gcptoolbox bq --project hoge labels list logs --prefix access_log_",
+		Args:    cobra.ExactArgs(1),
+		RunE:    runLabelsList,
+	}
+
+	set := &cobra.Command{
+		Use:     "set [dataset] [key=value...]",
+		Short:   "Add or overwrite labels of tables",
+		Example: "gcptoolbox bq --project hoge labels set logs team=analytics cost-center=1234 --prefix access_log_",
+		Args:    cobra.MinimumNArgs(2),
+		RunE:    runLabelsSet,
+	}
+	set.Flags().BoolVar(&dryRun, "dryrun", false, "Display the changes but do not actually process it")
+
+	remove := &cobra.Command{
+		Use:     "remove [dataset] [key...]",
+		Short:   "Remove labels of tables",
+		Example: "gcptoolbox bq --project hoge labels remove logs team --prefix access_log_",
+		Args:    cobra.MinimumNArgs(2),
+		RunE:    runLabelsRemove,
+	}
+	remove.Flags().BoolVar(&dryRun, "dryrun", false, "Display the changes but do not actually process it")
+
+	cmd.AddCommand(list, set, remove)
+	return cmd
+}
+
+func runLabelsList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		datasetID = args[0]
+		if datasetLabels {
+			labels, err := s.ListDatasetLabels(ctx, projectID, datasetID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", datasetID, formatLabels(labels))
+			return nil
+		}
+
+		l, err := s.ListTableLabels(ctx, projectID, datasetID, prefix)
+		if err != nil {
+			return err
+		}
+		for _, v := range l {
+			fmt.Printf("%s %s\n", v.TableID, formatLabels(v.Before))
+		}
+		return nil
+	})
+}
+
+func runLabelsSet(cmd *cobra.Command, args []string) error {
+	labels, err := parseLabels(args[1:])
+	if err != nil {
+		return err
+	}
+	return runLabelsUpdate(cmd.Context(), args[0], &tables.LabelUpdate{Set: labels})
+}
+
+func runLabelsRemove(cmd *cobra.Command, args []string) error {
+	return runLabelsUpdate(cmd.Context(), args[0], &tables.LabelUpdate{Delete: args[1:]})
+}
+
+func runLabelsUpdate(ctx context.Context, dataset string, update *tables.LabelUpdate) error {
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		datasetID = dataset
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("DatasetID=%s\n", datasetID)
+		fmt.Printf("TablePrefix=%s\n", prefix)
+		fmt.Printf("DatasetLabels=%t\n", datasetLabels)
+		fmt.Printf("DryRun=%t\n", dryRun)
+		fmt.Println()
+
+		var ops []tables.APIOptions
+		if dryRun {
+			ops = append(ops, tables.WithDryRun())
+		}
+
+		var changes []*tables.LabelChange
+		if datasetLabels {
+			change, err := s.UpdateDatasetLabels(ctx, projectID, datasetID, update, ops...)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		} else {
+			l, err := s.UpdateTableLabels(ctx, projectID, datasetID, prefix, update, ops...)
+			changes = append(changes, l...)
+			if err != nil {
+				// 途中で失敗した場合もそれまでの結果は表示する
+				printLabelChanges(changes)
+				return err
+			}
+		}
+		printLabelChanges(changes)
+		fmt.Println("Done")
+		return nil
+	})
+}
+
+func printLabelChanges(changes []*tables.LabelChange) {
+	var changed int
+	for _, v := range changes {
+		name := v.DatasetID
+		if v.TableID != "" {
+			name = v.TableID
+		}
+		if !v.Changed {
+			fmt.Printf("%s unchanged %s\n", name, formatLabels(v.Before))
+			continue
+		}
+		changed++
+		msg := fmt.Sprintf("%s changed %s -> %s\n", name, formatLabels(v.Before), formatLabels(v.After))
+		if dryRun {
+			msg = fmt.Sprintf("DryRun: %s", msg)
+		}
+		fmt.Print(msg)
+	}
+	fmt.Println()
+	fmt.Printf("%d of %d resources changed\n", changed, len(changes))
+}
+
+// parseLabels is key=value形式の引数をLabelのmapにする
+func parseLabels(args []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s is invalid label format. plz format key=value", arg)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// formatLabels is Labelをkeyでsortして{key=value,key=value}形式の文字列にする
+func formatLabels(labels map[string]string) string {
+	return fmt.Sprintf("{%s}", tables.LabelsString(labels))
+}
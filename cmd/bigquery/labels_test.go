@@ -0,0 +1,35 @@
+package bigquery
+
+import (
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	got, err := parseLabels([]string{"team=analytics", "empty=", "k=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := formatLabels(got), "{empty=,k=a=b,team=analytics}"; g != e {
+		t.Errorf("want %s but got %s", e, g)
+	}
+}
+
+func TestParseLabelsError(t *testing.T) {
+	cases := []struct {
+		name string
+		arg  string
+	}{
+		{"no separator", "team"},
+		{"empty key", "=analytics"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseLabels([]string{tt.arg})
+			if err == nil {
+				t.Errorf("want error but got nil")
+			}
+		})
+	}
+}
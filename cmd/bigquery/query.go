@@ -0,0 +1,163 @@
+package bigquery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryFile     string
+	queryLocation string
+	queryFormat   string
+	queryLabels   []string
+	maxBytes      int64
+	forceQuery    bool
+)
+
+func cmdQuery() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query [sql]",
+		Short: "Run a query with a cost guard and write the results to a file or Cloud Storage",
+		Long: "Always dry run the query first and refuse to run it when the estimated bytes processed exceed --max-bytes unless --force is specified. " +
+			"The query and export jobs are labeled created-by=gcptoolbox. " +
+			"Results are written to a local file as CSV or NDJSON, or exported to Cloud Storage as CSV, NDJSON or Parquet by an extract job. " +
+			"When exporting results larger than 1GB to Cloud Storage, include * in the URI.",
+		Example: "gcptoolbox bq --project hoge query 'SELECT * FROM logs.access_log_20240101 LIMIT 100' --output result.csv\n" +
+			"gcptoolbox bq --project hoge query --file report.sql --output gs://hoge/report/*.parquet --max-bytes 107374182400",
+		Args: cobra.MaximumNArgs(1),
+		RunE: runQuery,
+	}
+	cmd.Flags().StringVar(&queryFile, "file", "", "File path or gs:// path of the SQL. Instead of the argument")
+	cmd.Flags().StringVar(&queryLocation, "location", "", "Location to run the query. If not specified, it is determined by the referenced tables")
+	cmd.Flags().StringVar(&outputPath, "output", "", "File path or gs:// URI to write the results")
+	cmd.Flags().StringVar(&queryFormat, "format", "", "csv, ndjson or parquet. If not specified, it is determined by the extension of --output. parquet is only available for gs://")
+	cmd.Flags().StringSliceVar(&queryLabels, "label", nil, "Additional label of the jobs. key=value. It can be specified multiple times. created-by is reserved")
+	cmd.Flags().Int64Var(&maxBytes, "max-bytes", jobs.DefaultMaxBytesProcessed, "Refuse to run the query when the estimated bytes processed exceed this")
+	cmd.Flags().BoolVar(&forceQuery, "force", false, "Run the query even if the estimated bytes processed exceed --max-bytes")
+	cmd.Flags().BoolVar(&dryRun, "dryrun", false, "Display the estimated bytes processed but do not actually run the query")
+	return cmd
+}
+
+func runQuery(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	var sql string
+	switch {
+	case len(args) > 0 && queryFile != "":
+		return fmt.Errorf("specify either sql or --file")
+	case len(args) > 0:
+		sql = args[0]
+	case queryFile != "":
+		r, err := openFile(ctx, queryFile)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(r)
+		if closeErr := r.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed read %s : %w", queryFile, err)
+		}
+		sql = string(b)
+	default:
+		return fmt.Errorf("sql or --file required")
+	}
+	if outputPath == "" && !dryRun {
+		return fmt.Errorf("--output required")
+	}
+	format, err := queryOutputFormat(queryFormat, outputPath)
+	if err != nil {
+		return err
+	}
+	toGCS := strings.HasPrefix(outputPath, "gs://")
+	if format == jobs.OutputFormatParquet && !toGCS && !dryRun {
+		return fmt.Errorf("%s is only available for gs:// output", format)
+	}
+	labels, err := parseLabels(queryLabels)
+	if err != nil {
+		return err
+	}
+
+	return withJobsService(ctx, func(projectID string, s *jobs.Service) (err error) {
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("Output=%s\n", outputPath)
+		fmt.Printf("Format=%s\n", format)
+		fmt.Println()
+
+		cfg := &jobs.QueryConfig{
+			SQL:               sql,
+			Location:          queryLocation,
+			MaxBytesProcessed: maxBytes,
+			Force:             forceQuery,
+			Labels:            labels,
+		}
+		var ops []jobs.APIOptions
+		if dryRun {
+			ops = append(ops, jobs.WithDryRun())
+		}
+		result, err := s.RunQuery(ctx, cfg, ops...)
+		if result != nil {
+			fmt.Printf("estimated %d bytes processed ($%.4f on-demand)\n", result.EstimatedBytesProcessed, result.EstimatedOnDemandCost)
+		}
+		if errors.Is(err, jobs.ErrExceededMaxBytesProcessed) {
+			return fmt.Errorf("%w. Raise --max-bytes or specify --force to run it anyway", err)
+		}
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+		fmt.Printf("job %s:%s.%s done. %d bytes billed. cache hit=%t\n", result.ProjectID, result.Location, result.JobID, result.TotalBytesBilled, result.CacheHit)
+
+		if toGCS {
+			if err := s.ExtractQueryResult(ctx, result, outputPath, format); err != nil {
+				return err
+			}
+			fmt.Printf("exported %s\n", outputPath)
+			return nil
+		}
+
+		file, err := createFile(ctx, outputPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				// 処理が成功しなかった場合は、書き込もうとして作ったファイルを消す
+				if err := os.Remove(outputPath); err != nil {
+					fmt.Printf("warning: failed file.Remove() err=%s", err)
+				}
+			}
+		}()
+		rows, err := s.WriteQueryResult(ctx, file, result, format)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s %d rows\n", outputPath, rows)
+		return nil
+	})
+}
+
+// queryOutputFormat is --formatから出力形式を返す. 指定されていない場合はpathの拡張子から決める
+func queryOutputFormat(format string, path string) (jobs.OutputFormat, error) {
+	if format != "" {
+		return jobs.ParseOutputFormat(format)
+	}
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if v, err := jobs.ParseOutputFormat(ext); err == nil {
+		return v, nil
+	}
+	return jobs.OutputFormatCSV, nil
+}
@@ -0,0 +1,32 @@
+package bigquery
+
+import (
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+)
+
+func TestQueryOutputFormat(t *testing.T) {
+	cases := []struct {
+		format string
+		path   string
+		want   jobs.OutputFormat
+	}{
+		{"", "result.csv", jobs.OutputFormatCSV},
+		{"", "result.jsonl", jobs.OutputFormatNDJSON},
+		{"", "gs://hoge/result/*.parquet", jobs.OutputFormatParquet},
+		{"", "result.txt", jobs.OutputFormatCSV},
+		{"ndjson", "result.txt", jobs.OutputFormatNDJSON},
+	}
+	for _, tt := range cases {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := queryOutputFormat(tt.format, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("want %s but got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package bigquery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/jobs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recommendDays      int
+	minQueries         int
+	partitionScanRatio float64
+	clusterScanRatio   float64
+)
+
+func cmdRecommendPartitioning() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recommend-partitioning [dataset]",
+		Short: "Recommend partitioning and clustering keys from query history",
+		Long: "Collect queries against tables from INFORMATION_SCHEMA.JOBS, count the columns used in WHERE and JOIN, and recommend partitioning and clustering keys for each table ranked by the estimated bytes that would have been saved. " +
+			"Columns are detected from the query text, and the saved bytes are estimated by --partition-scan-ratio and --cluster-scan-ratio. If the dataset is not specified, all datasets are targeted.",
+		Example: "gcptoolbox bq --project hoge recommend-partitioning logs --region US --days 30 --output recommendations.jsonl",
+		Args:    cobra.MaximumNArgs(1),
+		RunE:    runRecommendPartitioning,
+	}
+	cmd.Flags().StringVar(&jobsRegion, "region", "US", "region of jobs. eg. US, asia-northeast1")
+	cmd.Flags().StringVar(&prefix, "prefix", "", "table prefix. If not specified, all tables are targeted")
+	cmd.Flags().IntVar(&recommendDays, "days", 30, "Queries created within this number of days are analyzed. max 180")
+	cmd.Flags().IntVar(&minQueries, "min-queries", 1, "Tables referenced by fewer queries than this are not reported")
+	cmd.Flags().Float64Var(&partitionScanRatio, "partition-scan-ratio", jobs.DefaultPartitionScanRatio, "Assumed ratio of the table read by a query filtering the partitioning column")
+	cmd.Flags().Float64Var(&clusterScanRatio, "cluster-scan-ratio", jobs.DefaultClusterScanRatio, "Assumed ratio read by a query filtering the clustering columns")
+	cmd.Flags().Float64Var(&pricePerTiB, "price-per-tib", jobs.OnDemandPricePerTiB, "USD per TiB of on-demand query")
+	cmd.Flags().StringVar(&outputPath, "output", "", "File path or gs:// path to write the report as JSON lines")
+	return cmd
+}
+
+func runRecommendPartitioning(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if recommendDays < 1 || recommendDays > 180 {
+		return fmt.Errorf("--days must be between 1 and 180")
+	}
+	dataset := ""
+	if len(args) > 0 {
+		dataset = args[0]
+	}
+
+	return withJobsService(ctx, func(projectID string, s *jobs.Service) error {
+		end := time.Now()
+		cfg := &jobs.RecommendConfig{
+			Location:           jobsRegion,
+			Start:              end.AddDate(0, 0, -recommendDays),
+			End:                end,
+			DatasetID:          dataset,
+			TablePrefix:        prefix,
+			MinQueries:         minQueries,
+			PartitionScanRatio: partitionScanRatio,
+			ClusterScanRatio:   clusterScanRatio,
+			PricePerTiB:        pricePerTiB,
+		}
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("Region=%s\n", jobsRegion)
+		fmt.Printf("DatasetID=%s\n", dataset)
+		fmt.Printf("TablePrefix=%s\n", prefix)
+		fmt.Printf("Start=%s\n", cfg.Start.Format(time.RFC3339))
+		fmt.Printf("End=%s\n", cfg.End.Format(time.RFC3339))
+		fmt.Println()
+
+		l, err := s.RecommendPartitioning(ctx, projectID, cfg)
+		if err != nil {
+			return err
+		}
+		var savedCost float64
+		for i, v := range l {
+			fmt.Printf("%d. %s.%s queries=%d billed=%d bytes estimated saved=%d bytes ($%.2f)\n", i+1, v.DatasetID, v.TableID, v.QueryCount, v.BytesBilled, v.EstimatedSavedBytes, v.EstimatedSavedCost)
+			fmt.Printf("  current: partitioning=%s clustering=%s\n", orDash(v.CurrentPartitioningField), orDash(strings.Join(v.CurrentClusteringFields, ",")))
+			if v.PartitioningField != "" {
+				fmt.Printf("  recommend: PARTITION BY %s (%s)\n", v.PartitioningField, v.PartitioningType)
+			}
+			if len(v.ClusteringFields) > 0 {
+				fmt.Printf("  recommend: CLUSTER BY %s\n", strings.Join(v.ClusteringFields, ", "))
+			}
+			for _, c := range v.Columns {
+				fmt.Printf("  %s %s filter=%d join=%d\n", c.Column, c.Type, c.FilterCount, c.JoinCount)
+			}
+			savedCost += v.EstimatedSavedCost
+		}
+		fmt.Println()
+		fmt.Printf("%d tables. estimated saved=$%.2f in %d days\n", len(l), savedCost, recommendDays)
+		fmt.Println("Note: the saved bytes are estimates based on the assumed scan ratios")
+
+		if outputPath != "" {
+			if err := writeJSONLines(ctx, outputPath, l); err != nil {
+				return err
+			}
+			fmt.Printf("created %s\n", outputPath)
+		}
+		return nil
+	})
+}
+
+// orDash is vが空の場合は - を返す
+func orDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
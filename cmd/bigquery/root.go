@@ -10,6 +10,8 @@ var (
 	datasetID string
 	prefix    string
 	dryRun    bool
+
+	journalPath string
 )
 
 func Command() *cobra.Command {
@@ -23,5 +25,21 @@ func Command() *cobra.Command {
 	cmd.AddCommand(cmdDeleteTables())
 	cmd.AddCommand(cmdUpdateExpirationTables())
 	cmd.AddCommand(cmdCopyDefaultExpirationTables())
+	cmd.AddCommand(cmdUndo())
+	cmd.AddCommand(cmdUnusedTables())
+	cmd.AddCommand(cmdLabels())
+	cmd.AddCommand(cmdShardsToPartitioned())
+	cmd.AddCommand(cmdDiff())
+	cmd.AddCommand(cmdSchemaDrift())
+	cmd.AddCommand(cmdDatasets())
+	cmd.AddCommand(cmdStorageBillingReport())
+	cmd.AddCommand(cmdJobs())
+	cmd.AddCommand(cmdAudit())
+	cmd.AddCommand(cmdInventory())
+	cmd.AddCommand(cmdUndelete())
+	cmd.AddCommand(cmdShardGaps())
+	cmd.AddCommand(cmdSchema())
+	cmd.AddCommand(cmdQuery())
+	cmd.AddCommand(cmdRecommendPartitioning())
 	return cmd
 }
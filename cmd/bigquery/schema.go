@@ -0,0 +1,104 @@
+package bigquery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/schemas"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	schemaOutputDir string
+	generateGo      bool
+	goPackage       string
+)
+
+func cmdSchema() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Manage table schemas",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return fmt.Errorf("Command name argument expected.")
+		},
+	}
+
+	export := &cobra.Command{
+		Use:     "export [dataset]",
+		Short:   "Export table schemas as bq compatible JSON files and Go structs",
+		Long:    "Write the schema of each table in the dataset to <table>.json in the format of bq show --schema. With --go, <table>.go is also written with struct definitions with bigquery tags. RECORD fields become nested structs, REPEATED fields become slices and NULLABLE fields become bigquery.Null* types.",
+		Example: "gcptoolbox bq --project hoge schema export logs --prefix access_log --output-dir ./schemas --go --go-package logs",
+		Args:    cobra.ExactArgs(1),
+		RunE:    runSchemaExport,
+	}
+	export.Flags().StringVar(&prefix, "prefix", "", "table prefix. If not specified, all tables in the dataset are targeted")
+	export.Flags().StringVar(&schemaOutputDir, "output-dir", ".", "Directory or gs:// path to write the files")
+	export.Flags().BoolVar(&generateGo, "go", false, "Also write Go struct definitions")
+	export.Flags().StringVar(&goPackage, "go-package", "", "Package name of the Go files. If not specified, the dataset name is used")
+	cmd.AddCommand(export)
+	return cmd
+}
+
+func runSchemaExport(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		datasetID = args[0]
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("DatasetID=%s\n", datasetID)
+		fmt.Printf("TablePrefix=%s\n", prefix)
+		fmt.Println()
+
+		pkg := goPackage
+		if pkg == "" {
+			pkg = strings.ToLower(schemas.GoName(datasetID))
+		}
+		if !strings.HasPrefix(schemaOutputDir, "gs://") {
+			if err := os.MkdirAll(schemaOutputDir, 0755); err != nil {
+				return err
+			}
+		}
+
+		l, err := s.ListTableSchemas(ctx, projectID, datasetID, prefix)
+		if err != nil {
+			return err
+		}
+		for _, v := range l {
+			j, err := v.Schema.ToJSONFields()
+			if err != nil {
+				return fmt.Errorf("failed convert schema to json %s : %w", v.TableID, err)
+			}
+			path := schemaOutputPath(schemaOutputDir, v.TableID+".json")
+			if err := writeFile(ctx, path, append(j, '\n')); err != nil {
+				return err
+			}
+			fmt.Printf("created %s\n", path)
+
+			if !generateGo {
+				continue
+			}
+			src, err := schemas.GoFile(pkg, v.TableID, v.Schema)
+			if err != nil {
+				return fmt.Errorf("failed generate go struct %s : %w", v.TableID, err)
+			}
+			path = schemaOutputPath(schemaOutputDir, v.TableID+".go")
+			if err := writeFile(ctx, path, src); err != nil {
+				return err
+			}
+			fmt.Printf("created %s\n", path)
+		}
+		fmt.Println()
+		fmt.Printf("%d tables exported\n", len(l))
+		return nil
+	})
+}
+
+// schemaOutputPath is dirの下のnameのpathを返す. dirはgs://でも良い
+func schemaOutputPath(dir string, name string) string {
+	if strings.HasPrefix(dir, "gs://") {
+		return strings.TrimSuffix(dir, "/") + "/" + name
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,61 @@
+package bigquery
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var failOnDrift bool
+
+func cmdSchemaDrift() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "schema-drift [dataset] [table-prefix]",
+		Short:   "Report schema changes across date-sharded tables",
+		Long:    "Walk prefix_YYYYMMDD tables in date order, group them by schema and report the date ranges where each schema version applied and what changed between versions",
+		Example: "gcptoolbox bq --project hoge schema-drift logs access_log_",
+		Args:    cobra.ExactArgs(2),
+		RunE:    runSchemaDrift,
+	}
+	cmd.Flags().BoolVar(&failOnDrift, "fail-on-drift", false, "Exit with non-zero status when the schema changed")
+	return cmd
+}
+
+func runSchemaDrift(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		datasetID = args[0]
+		tablePrefix := args[1]
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("DatasetID=%s\n", datasetID)
+		fmt.Printf("TablePrefix=%s\n", tablePrefix)
+		fmt.Println()
+
+		periods, err := s.DetectSchemaDrift(ctx, projectID, datasetID, tablePrefix)
+		if err != nil {
+			return err
+		}
+		if len(periods) == 0 {
+			return fmt.Errorf("shard not found. prefix=%s", tablePrefix)
+		}
+
+		for i, p := range periods {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("version %d (%s) %s - %s %d shards\n", p.Version, p.Fingerprint, p.Start.Format("2006-01-02"), p.End.Format("2006-01-02"), p.ShardCount)
+			if p.OrderChanged {
+				fmt.Println("  field order changed")
+			}
+			printFieldDiffs(p.Changes, "  ")
+		}
+		fmt.Println()
+		fmt.Printf("%d schema changes\n", len(periods)-1)
+		if failOnDrift && len(periods) > 1 {
+			return errors.New("exists schema drift")
+		}
+		return nil
+	})
+}
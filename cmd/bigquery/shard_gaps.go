@@ -0,0 +1,89 @@
+package bigquery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	smallShardRatio  float64
+	smallShardWindow int
+	failOnSmall      bool
+)
+
+func cmdShardGaps() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "shard-gaps [dataset] [table-prefix]",
+		Short:   "Detect missing dates and anomalously small shards in date-sharded tables",
+		Long:    "Walk prefix_YYYYMMDD tables and report dates without a shard between the first and last shard, or in the range of --from and --to. Shards much smaller than their neighbors are also reported. Exit with non-zero status when dates are missing.",
+		Example: "gcptoolbox bq --project hoge shard-gaps logs access_log_ --to $(date -d yesterday +%F)",
+		Args:    cobra.ExactArgs(2),
+		RunE:    runShardGaps,
+	}
+	cmd.Flags().StringVar(&fromDate, "from", "", "First date to check. YYYY-MM-DD. If not specified, the date of the first shard")
+	cmd.Flags().StringVar(&toDate, "to", "", "Last date to check. YYYY-MM-DD. If not specified, the date of the last shard")
+	cmd.Flags().Float64Var(&smallShardRatio, "small-ratio", tables.DefaultSmallShardRatio, "Shards smaller than this ratio of the median of their neighbors are reported. 0 disables it")
+	cmd.Flags().IntVar(&smallShardWindow, "small-window", tables.DefaultSmallShardWindow, "Number of shards on each side compared to detect small shards")
+	cmd.Flags().BoolVar(&failOnSmall, "fail-on-small", false, "Exit with non-zero status also when there are small shards")
+	return cmd
+}
+
+func runShardGaps(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cfg := &tables.ShardGapConfig{
+		SmallRatio:  smallShardRatio,
+		SmallWindow: smallShardWindow,
+	}
+	if fromDate != "" {
+		v, err := time.Parse("2006-01-02", fromDate)
+		if err != nil {
+			return fmt.Errorf("invalid --from %s : %w", fromDate, err)
+		}
+		cfg.From = v
+	}
+	if toDate != "" {
+		v, err := time.Parse("2006-01-02", toDate)
+		if err != nil {
+			return fmt.Errorf("invalid --to %s : %w", toDate, err)
+		}
+		cfg.To = v
+	}
+
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		datasetID = args[0]
+		tablePrefix := args[1]
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("DatasetID=%s\n", datasetID)
+		fmt.Printf("TablePrefix=%s\n", tablePrefix)
+		fmt.Println()
+
+		report, err := s.DetectShardGaps(ctx, projectID, datasetID, tablePrefix, cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s - %s %d shards\n", report.From.Format("2006-01-02"), report.To.Format("2006-01-02"), report.ShardCount)
+		for _, v := range report.Gaps {
+			if v.Days == 1 {
+				fmt.Printf("missing %s\n", v.From.Format("2006-01-02"))
+				continue
+			}
+			fmt.Printf("missing %s - %s %d days\n", v.From.Format("2006-01-02"), v.To.Format("2006-01-02"), v.Days)
+		}
+		for _, v := range report.SmallShards {
+			fmt.Printf("small %s rows=%d bytes=%d neighbor median bytes=%d (%.0f%%)\n", v.TableID, v.NumRows, v.NumBytes, v.NeighborMedianBytes, v.Ratio*100)
+		}
+		fmt.Println()
+		fmt.Printf("%d days missing in %d gaps. %d small shards\n", report.MissingDays, len(report.Gaps), len(report.SmallShards))
+		if len(report.Gaps) > 0 {
+			return errors.New("exists missing shards")
+		}
+		if failOnSmall && len(report.SmallShards) > 0 {
+			return errors.New("exists small shards")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package bigquery
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	clusteringFields    string
+	deleteSource        bool
+	sourceExpirationStr string
+)
+
+func cmdShardsToPartitioned() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "shards-to-partitioned [dataset] [table-prefix] [destination-table]",
+		Short:   "Consolidate date-sharded tables into a single day-partitioned table",
+		Long:    "Consolidate prefix_YYYYMMDD tables into a single ingestion-time day-partitioned table. Each shard is copied into its partition and the row count is verified. The schema is widened when it differs between shards, and all columns of the destination table are NULLABLE so that shards copied by a query can be written.",
+		Example: "gcptoolbox bq --project hoge shards-to-partitioned logs access_log_ access_log --clustering user_id --expire-source 720h",
+		Args:    cobra.ExactArgs(3),
+		RunE:    runShardsToPartitioned,
+	}
+	cmd.Flags().StringVar(&clusteringFields, "clustering", "", "Comma separated clustering fields of the destination table. Used only when the destination table is created")
+	cmd.Flags().BoolVar(&deleteSource, "delete-source", false, "Delete each shard after it is copied and verified")
+	cmd.Flags().StringVar(&sourceExpirationStr, "expire-source", "", "Set the expiration of each shard to now + this duration after it is copied and verified. eg. 720h")
+	cmd.Flags().StringVar(&journalPath, "journal", "", "File path or gs:// path to record the state of shards before deleting or expiring. It can be restored with bq undo")
+	cmd.Flags().BoolVar(&dryRun, "dryrun", false, "Display the target table but do not actually process it")
+	cmd.Flags().BoolVar(&ignoreDependents, "force", false, "With --delete-source or --expire-source, process even if views or routines reference the shards")
+	return cmd
+}
+
+func runShardsToPartitioned(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	return withTablesService(ctx, func(projectID string, s *tables.Service) (err error) {
+		datasetID = args[0]
+		tablePrefix := args[1]
+		destinationTableID := args[2]
+
+		cfg := &tables.ConsolidateShardsConfig{
+			DeleteSource: deleteSource,
+		}
+		if clusteringFields != "" {
+			cfg.ClusteringFields = strings.Split(clusteringFields, ",")
+		}
+		if sourceExpirationStr != "" {
+			if deleteSource {
+				return fmt.Errorf("--delete-source and --expire-source cannot be specified at the same time")
+			}
+			expiration, err := parseDurationParam(sourceExpirationStr)
+			if err != nil {
+				return err
+			}
+			if expiration.Duration() <= 0 {
+				return fmt.Errorf("--expire-source requires a duration. %s is not allowed", sourceExpirationStr)
+			}
+			cfg.SourceExpiration = expiration.Duration()
+		}
+
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("DatasetID=%s\n", datasetID)
+		fmt.Printf("TablePrefix=%s\n", tablePrefix)
+		fmt.Printf("DestinationTable=%s\n", destinationTableID)
+		fmt.Printf("Clustering=%s\n", clusteringFields)
+		fmt.Printf("DeleteSource=%t\n", deleteSource)
+		fmt.Printf("ExpireSource=%s\n", sourceExpirationStr)
+		fmt.Printf("DryRun=%t\n", dryRun)
+		fmt.Printf("Journal=%s\n", journalPath)
+		fmt.Println()
+
+		if deleteSource || sourceExpirationStr != "" {
+			shards, err := s.ListShards(ctx, projectID, datasetID, tablePrefix)
+			if err != nil {
+				return err
+			}
+			tableIDs := make([]string, 0, len(shards))
+			for _, v := range shards {
+				tableIDs = append(tableIDs, v.TableID)
+			}
+			if err := checkDependents(ctx, s, projectID, datasetID, tableIDs); err != nil {
+				return err
+			}
+		}
+
+		var ops []tables.APIOptions
+		if dryRun {
+			ops = append(ops, tables.WithDryRun())
+		}
+		if journalPath != "" && !dryRun {
+			journal, closer, err := createJournal(ctx, journalPath)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if closeErr := closer.Close(); closeErr != nil && err == nil {
+					err = fmt.Errorf("failed journal close : %w", closeErr)
+				}
+			}()
+			ops = append(ops, tables.WithJournal(journal))
+		}
+
+		results, err := s.ConsolidateShardsToPartitionedTable(ctx, projectID, datasetID, tablePrefix, destinationTableID, cfg, ops...)
+		fmt.Println()
+		var copyCount, queryCount int
+		for _, v := range results {
+			switch v.Method {
+			case tables.ShardCopyMethodCopy:
+				copyCount++
+			case tables.ShardCopyMethodQuery:
+				queryCount++
+			}
+		}
+		fmt.Printf("%d shards processed. copy=%d query=%d\n", len(results), copyCount, queryCount)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Done")
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package bigquery
+
+import (
+	"fmt"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	billingRegion  string
+	storagePricing = tables.DefaultStoragePricing
+)
+
+func cmdStorageBillingReport() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "storage-billing-report",
+		Short:   "Recommend logical or physical storage billing model for each dataset",
+		Long:    "Compare logical and physical storage costs for each dataset based on INFORMATION_SCHEMA.TABLE_STORAGE, and recommend the cheaper billing model. Physical billing includes time travel and fail-safe bytes.",
+		Example: "gcptoolbox bq --project hoge storage-billing-report --region US --output billing.jsonl",
+		Args:    cobra.NoArgs,
+		RunE:    runStorageBillingReport,
+	}
+	cmd.Flags().StringVar(&billingRegion, "region", "", "region of datasets. eg. US, asia-northeast1. If not specified, all regions are targeted")
+	cmd.Flags().StringVar(&outputPath, "output", "", "File path or gs:// path to write the report as JSON lines")
+	cmd.Flags().Float64Var(&storagePricing.ActiveLogical, "active-logical-price", tables.DefaultStoragePricing.ActiveLogical, "USD per GiB per month of active logical storage")
+	cmd.Flags().Float64Var(&storagePricing.LongTermLogical, "long-term-logical-price", tables.DefaultStoragePricing.LongTermLogical, "USD per GiB per month of long-term logical storage")
+	cmd.Flags().Float64Var(&storagePricing.ActivePhysical, "active-physical-price", tables.DefaultStoragePricing.ActivePhysical, "USD per GiB per month of active physical storage")
+	cmd.Flags().Float64Var(&storagePricing.LongTermPhysical, "long-term-physical-price", tables.DefaultStoragePricing.LongTermPhysical, "USD per GiB per month of long-term physical storage")
+	return cmd
+}
+
+func runStorageBillingReport(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("Region=%s\n", billingRegion)
+		fmt.Println()
+
+		l, err := s.StorageBillingReport(ctx, projectID, billingRegion, &storagePricing)
+		if err != nil {
+			return err
+		}
+
+		var logical, physical, current, savings float64
+		var switchCount int
+		for _, v := range l {
+			msg := fmt.Sprintf("%s location=%s current=%s logical=$%.2f/month physical=$%.2f/month", v.DatasetID, v.Location, v.CurrentModel, v.LogicalMonthlyCost, v.PhysicalMonthlyCost)
+			if v.ShouldSwitch() {
+				switchCount++
+				msg = fmt.Sprintf("%s recommend=%s savings=$%.2f/month", msg, v.RecommendedModel, v.MonthlySavings)
+			}
+			fmt.Println(msg)
+
+			logical += v.LogicalMonthlyCost
+			physical += v.PhysicalMonthlyCost
+			if v.CurrentModel == tables.PhysicalStorageBilling {
+				current += v.PhysicalMonthlyCost
+			} else {
+				current += v.LogicalMonthlyCost
+			}
+			savings += v.MonthlySavings
+		}
+		fmt.Println()
+		fmt.Printf("%d datasets. all logical=$%.2f/month all physical=$%.2f/month current=$%.2f/month\n", len(l), logical, physical, current)
+		fmt.Printf("%d datasets recommended to switch. savings=$%.2f/month\n", switchCount, savings)
+		fmt.Println("Note: the billing model of a dataset can be changed only once every 14 days")
+
+		if outputPath != "" {
+			if err := writeJSONLines(ctx, outputPath, l); err != nil {
+				return err
+			}
+			fmt.Printf("created %s\n", outputPath)
+		}
+		fmt.Println("Done")
+		return nil
+	})
+}
@@ -0,0 +1,104 @@
+package bigquery
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undeletePrefix bool
+	undeleteAt     string
+)
+
+func cmdUndelete() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "undelete [dataset table]",
+		Short:   "Recreate deleted tables from the time travel state",
+		Long:    "Recreate deleted tables from their state at the specified point in time using time travel. The point in time must be within the time travel window of the dataset (7 days at most).",
+		Example: "gcptoolbox bq --project hoge undelete logs access_log_ --prefix --at 2h",
+		Args:    cobra.ExactArgs(2),
+		RunE:    runUndelete,
+	}
+	cmd.Flags().BoolVar(&undeletePrefix, "prefix", false, "Treat table as a prefix and undelete all deleted tables matching it")
+	cmd.Flags().StringVar(&undeleteAt, "at", "", "Point in time to restore. RFC3339 (eg. 2024-01-02T15:04:05+09:00) or duration before now (eg. 2h)")
+	cmd.Flags().BoolVar(&dryRun, "dryrun", false, "Display the target table but do not actually process it")
+	if err := cmd.MarkFlagRequired("at"); err != nil {
+		fmt.Println(err)
+	}
+	return cmd
+}
+
+func runUndelete(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	at, err := parsePointInTime(undeleteAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid --at %s : %w", undeleteAt, err)
+	}
+
+	return withTablesService(ctx, func(projectID string, s *tables.Service) error {
+		datasetID = args[0]
+		table := args[1]
+		fmt.Printf("ProjectID=%s\n", projectID)
+		fmt.Printf("DatasetID=%s\n", datasetID)
+		if undeletePrefix {
+			fmt.Printf("TablePrefix=%s\n", table)
+		} else {
+			fmt.Printf("TableID=%s\n", table)
+		}
+		fmt.Printf("At=%s\n", at.Format(time.RFC3339))
+		fmt.Printf("DryRun=%t\n", dryRun)
+		fmt.Println()
+
+		tableIDs := []string{table}
+		if undeletePrefix {
+			tableIDs, err = s.ListDeletedTables(ctx, projectID, datasetID, table)
+			if err != nil {
+				return err
+			}
+			if len(tableIDs) == 0 {
+				fmt.Println("deleted table not found")
+				return nil
+			}
+		}
+
+		var ops []tables.APIOptions
+		if dryRun {
+			ops = append(ops, tables.WithDryRun())
+		}
+		results, err := s.UndeleteTables(ctx, projectID, datasetID, tableIDs, at, ops...)
+		fmt.Println()
+		var restored []string
+		var notRestored []*tables.UndeleteResult
+		for _, v := range results {
+			if v.Restored {
+				restored = append(restored, v.TableID)
+			} else if v.Reason != "" {
+				notRestored = append(notRestored, v)
+			}
+		}
+		fmt.Printf("%d of %d tables restored\n", len(restored), len(tableIDs))
+		for _, v := range notRestored {
+			fmt.Printf("  not restored %s : %s\n", v.TableID, v.Reason)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println("Done")
+		return nil
+	})
+}
+
+// parsePointInTime is RFC3339の時刻か、nowからどれだけ前かのDurationを時刻にする
+func parsePointInTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := parseDurationParam(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be RFC3339 or duration : %w", err)
+	}
+	return now.Add(-d.Duration()), nil
+}
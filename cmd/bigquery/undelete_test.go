@@ -0,0 +1,34 @@
+package bigquery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePointInTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		v    string
+		want time.Time
+	}{
+		{"2024-01-02T09:04:05+09:00", time.Date(2024, 1, 2, 0, 4, 5, 0, time.UTC)},
+		{"2h", time.Date(2024, 1, 2, 13, 0, 0, 0, time.UTC)},
+		{"1d12h", time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range cases {
+		t.Run(tt.v, func(t *testing.T) {
+			got, err := parsePointInTime(tt.v, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("want %s but got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := parsePointInTime("2024-01-02", now); err == nil {
+		t.Errorf("date must be error")
+	}
+}
@@ -0,0 +1,156 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/apstndb/adcplus/tokensource"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/sinmetalcraft/gcptoolbox/cmd/contexter"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+func cmdUndo() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "undo [journal]",
+		Short:   "Restore tables to the state recorded in the journal",
+		Long:    "Restore tables to the state recorded in the journal written by copy-default-expiration-tables or delete-tables with --journal",
+		Example: "gcptoolbox bq --project hoge undo gs://hoge/journal.jsonl",
+		Args:    cobra.ExactArgs(1),
+		RunE:    runUndo,
+	}
+	cmd.Flags().BoolVar(&dryRun, "dryrun", false, "Display the target table but do not actually process it")
+	return cmd
+}
+
+func runUndo(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	projectID, ok := contexter.ProjectID(ctx)
+	if !ok {
+		return fmt.Errorf("project required")
+	}
+	ts, err := tokensource.SmartAccessTokenSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	bq, err := bigquery.NewClient(ctx, projectID, option.WithTokenSource(ts))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := bq.Close(); err != nil {
+			fmt.Printf("FIY: failed bq.Close %s", err)
+		}
+	}()
+	s, err := tables.NewService(ctx, bq)
+	if err != nil {
+		return err
+	}
+
+	journalPath := args[0]
+	fmt.Printf("ProjectID=%s\n", projectID)
+	fmt.Printf("Journal=%s\n", journalPath)
+	fmt.Printf("DryRun=%t\n", dryRun)
+
+	r, err := openFile(ctx, journalPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			fmt.Printf("warning: failed journal close err=%s\n", err)
+		}
+	}()
+	entries, err := tables.ReadJournal(r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Entries=%d\n", len(entries))
+	fmt.Println()
+
+	var ops []tables.APIOptions
+	if dryRun {
+		ops = append(ops, tables.WithDryRun())
+	}
+	if err := s.Undo(ctx, entries, ops...); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Done")
+	return nil
+}
+
+// createJournal is 変更前のTableの状態を記録するJournalをpathに作る
+//
+// Cloud StorageのObjectはCloseするまで作られないので、gs://の場合は途中で止まっても記録が残るように
+// Local Fileに書き込み、Closeする時にUploadする. Uploadできなかった場合もLocal FileからUndoできる
+func createJournal(ctx context.Context, path string) (tables.Journal, io.Closer, error) {
+	if !strings.HasPrefix(path, "gs://") {
+		w, err := createFile(ctx, path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed create journal %s: %w", path, err)
+		}
+		return tables.NewJSONLinesJournal(w), w, nil
+	}
+
+	f, err := os.CreateTemp("", "gcptoolbox-journal-*.jsonl")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed create local journal for %s: %w", path, err)
+	}
+	fmt.Printf("Journal is written to %s and uploaded to %s at the end\n", f.Name(), path)
+	return tables.NewJSONLinesJournal(f), &uploadingJournal{ctx: ctx, file: f, path: path}, nil
+}
+
+// uploadingJournal is Local FileのJournalをCloseする時にCloud StorageにUploadする
+type uploadingJournal struct {
+	ctx  context.Context
+	file *os.File
+	path string
+}
+
+func (j *uploadingJournal) Close() error {
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("failed close local journal %s : %w", j.file.Name(), err)
+	}
+	if err := j.upload(); err != nil {
+		return fmt.Errorf("failed upload journal to %s. the journal remains in %s : %w", j.path, j.file.Name(), err)
+	}
+	if err := os.Remove(j.file.Name()); err != nil {
+		fmt.Printf("warning: failed remove local journal %s err=%s\n", j.file.Name(), err)
+	}
+	return nil
+}
+
+func (j *uploadingJournal) upload() (err error) {
+	r, err := os.Open(j.file.Name())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := r.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	ctx, cancel := context.WithCancel(j.ctx)
+	defer cancel()
+	w, err := createFile(ctx, j.path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		// 途中まで書いたObjectを作らないように、CancelしてからCloseする
+		cancel()
+		if closeErr := w.Close(); closeErr != nil {
+			fmt.Printf("warning: failed close %s err=%s\n", j.path, closeErr)
+		}
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,92 @@
+package bigquery
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/apstndb/adcplus/tokensource"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
+	"github.com/sinmetalcraft/gcptoolbox/cmd/contexter"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+var (
+	unusedDays int
+	outputPath string
+)
+
+func cmdUnusedTables() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "unused-tables [dataset]",
+		Short:   "List tables that were not queried within the specified days",
+		Long:    "List tables that were not queried within the specified days based on INFORMATION_SCHEMA.JOBS_BY_PROJECT. Jobs in other projects are not considered.",
+		Example: "gcptoolbox bq --project hoge unused-tables public-dataset --days 90 --output unused.txt",
+		Args:    cobra.ExactArgs(1),
+		RunE:    runUnusedTables,
+	}
+	cmd.Flags().StringVar(&prefix, "prefix", "", "table prefix")
+	cmd.Flags().IntVar(&unusedDays, "days", 90, fmt.Sprintf("Tables not queried within this number of days are listed. max %d", tables.MaxJobsRetentionDays))
+	cmd.Flags().StringVar(&outputPath, "output", "", "File path or gs:// path to write the table IDs. It can be passed to update-expiration-tables --target-list")
+	return cmd
+}
+
+func runUnusedTables(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	projectID, ok := contexter.ProjectID(ctx)
+	if !ok {
+		return fmt.Errorf("project required")
+	}
+	ts, err := tokensource.SmartAccessTokenSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	bq, err := bigquery.NewClient(ctx, projectID, option.WithTokenSource(ts))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := bq.Close(); err != nil {
+			fmt.Printf("FIY: failed bq.Close %s", err)
+		}
+	}()
+	s, err := tables.NewService(ctx, bq)
+	if err != nil {
+		return err
+	}
+
+	datasetID = args[0]
+	fmt.Printf("ProjectID=%s\n", projectID)
+	fmt.Printf("DatasetID=%s\n", datasetID)
+	fmt.Printf("TablePrefix=%s\n", prefix)
+	fmt.Printf("Days=%d\n", unusedDays)
+	fmt.Println()
+
+	l, err := s.ListUnusedTables(ctx, projectID, datasetID, prefix, unusedDays)
+	if err != nil {
+		return err
+	}
+
+	var totalCost float64
+	for _, v := range l {
+		fmt.Printf("%s created=%s active=%dB long-term=%dB cost=$%.2f/month\n", v.TableID, v.CreationTime.Format("2006-01-02"), v.ActiveLogicalBytes, v.LongTermLogicalBytes, v.MonthlyStorageCost)
+		totalCost += v.MonthlyStorageCost
+	}
+	fmt.Println()
+	fmt.Printf("%d unused tables. total cost=$%.2f/month\n", len(l), totalCost)
+
+	if outputPath != "" {
+		var tableIDs []string
+		for _, v := range l {
+			tableIDs = append(tableIDs, v.TableID)
+		}
+		if err := writeTableList(ctx, outputPath, tableIDs); err != nil {
+			return err
+		}
+		fmt.Printf("created %s\n", outputPath)
+	}
+
+	fmt.Println("Done")
+	return nil
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/apstndb/adcplus/tokensource"
+	"github.com/sinmetalcraft/gcptoolbox/bigquery/tables"
 	"github.com/sinmetalcraft/gcptoolbox/cmd/contexter"
 	"github.com/spf13/cobra"
 	"google.golang.org/api/googleapi"
@@ -16,16 +16,21 @@ import (
 	"google.golang.org/api/option"
 )
 
+var targetListPath string
+
 func cmdUpdateExpirationTables() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "update-expiration-tables [dataset duration]",
+		Use:     "update-expiration-tables [dataset expiration]",
 		Short:   "Update expiration of table in specified dataset",
-		Long:    "Update expiration of table in specified dataset",
-		Example: "gcptoolbox bq --project hoge update-expiration-tables public-dataset 365d",
+		Long:    "Update expiration of table in specified dataset. expiration is a duration with units y, mo, w, d, h, m, s (eg. 365d, 1y6mo), an absolute date (eg. 2025-12-31) or never",
+		Example: "gcptoolbox bq --project hoge update-expiration-tables public-dataset 365d --base-date TableSuffix",
 		Args:    cobra.MatchAll(cobra.ExactArgs(2), cobra.OnlyValidArgs),
 		RunE:    runUpdateExpirationTables,
 	}
 	cmd.Flags().StringVar(&prefix, "prefix", "", "table prefix")
+	cmd.Flags().StringVar(&targetListPath, "target-list", "", "File path or gs:// path of the table ID list to update. eg. output of unused-tables")
+	cmd.Flags().StringVar(&baseDate, "base-date", "", "Select a date to base the table expiration on. CreationTime(default)|LastModifiedTime|TableSuffix")
+	cmd.Flags().BoolVar(&ignoreDependents, "force", false, "Update even if views or routines reference the tables")
 	return cmd
 }
 
@@ -51,6 +56,12 @@ func runUpdateExpirationTables(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
+	s, err := tables.NewService(ctx, bq)
+	if err != nil {
+		return err
+	}
+	contention := &tables.ContentionStats{}
+
 	//var ops []bqbox.APIOptions
 	datasetID = args[0]
 	fmt.Println("bigquery update expiration")
@@ -60,15 +71,32 @@ func runUpdateExpirationTables(cmd *cobra.Command, args []string) error {
 	ep := args[1]
 	expiration, err := parseExpirationParam(ep)
 	if err != nil {
-		return fmt.Errorf("%s is invalid duration format: %w", ep, err)
+		return err
 	}
 
 	fmt.Printf("Expiration=%s\n", expiration)
+	if baseDate == "" {
+		baseDate = tables.CreationTime.String()
+	}
+	fmt.Printf("BaseDate=%s\n", baseDate)
+	base, err := tables.ParseBaseDate(baseDate)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("TargetList=%s\n", targetListPath)
+	var targetList map[string]bool
+	if targetListPath != "" {
+		targetList, err = readTableList(ctx, targetListPath)
+		if err != nil {
+			return fmt.Errorf("failed read target list %s: %w", targetListPath, err)
+		}
+	}
 	// fmt.Printf("DryRun=%t\n", dryRun)
 	//if dryRun {
 	//	ops = append(ops, bqbox.WithDryRun())
 	//}
 	fmt.Println()
+	var targets []*bigquery.Table
 	iter := bq.DatasetInProject(projectID, datasetID).Tables(ctx)
 	for {
 		t, err := iter.Next()
@@ -85,107 +113,96 @@ func runUpdateExpirationTables(cmd *cobra.Command, args []string) error {
 			}
 		}
 
-		tm, err := t.Metadata(ctx)
-		var gapiErr *googleapi.Error
-		if errors.As(err, &gapiErr) {
-			if gapiErr.Code == http.StatusNotFound {
-				fmt.Printf("%s is not found\n", t.TableID)
-				continue
-			} else {
-				return err
-			}
-		} else if err != nil {
+		if targetList != nil && !targetList[t.TableID] {
+			fmt.Printf("%s is not in target list\n", t.TableID)
+			continue
+		}
+		targets = append(targets, t)
+	}
+
+	// Expirationを設定すると参照しているViewが壊れる可能性があるので確認する. Neverは消えなくなるだけなので確認しない
+	if !expiration.isNever {
+		tableIDs := make([]string, 0, len(targets))
+		for _, t := range targets {
+			tableIDs = append(tableIDs, t.TableID)
+		}
+		if err := checkDependents(ctx, s, projectID, datasetID, tableIDs); err != nil {
 			return err
 		}
+	}
 
-		// TimePartitioningの場合
-		if tm.TimePartitioning != nil {
-			if tm.TimePartitioning.Expiration != 0 {
-				fmt.Printf("%s is exist partitioning expiration duration. %s\n", t.TableID, tm.TimePartitioning.Expiration)
-				continue
-			}
-			_, err = t.Update(ctx, bigquery.TableMetadataToUpdate{
-				TimePartitioning: &bigquery.TimePartitioning{
-					Expiration: expiration.Duration(),
-				},
-			}, tm.ETag)
-			if errors.As(err, &gapiErr) {
-				if gapiErr.Code == http.StatusNotFound {
-					fmt.Printf("%s is not found\n", t.TableID)
-					continue
-				} else {
-					return err
+	for _, t := range targets {
+		var skipReason string
+		var msg string
+		result, err := s.UpdateTable(ctx, t, func(tm *bigquery.TableMetadata) (*bigquery.TableMetadataToUpdate, error) {
+			// ETagが一致せずにやり直す時は、読み直したTableMetadataで判断し直す
+			skipReason = ""
+
+			// TimePartitioningの場合
+			if tm.TimePartitioning != nil {
+				if expiration.IsAbsolute() {
+					skipReason = "is partitioned table. partitioning expiration can not be absolute date"
+					return nil, nil
 				}
-			} else if err != nil {
-				return err
+				if tm.TimePartitioning.Expiration != 0 {
+					skipReason = fmt.Sprintf("is exist partitioning expiration duration. %s", tm.TimePartitioning.Expiration)
+					return nil, nil
+				}
+				msg = "set partitioning expiration"
+				return &bigquery.TableMetadataToUpdate{
+					TimePartitioning: &bigquery.TimePartitioning{
+						Expiration: expiration.Duration(),
+					},
+				}, nil
 			}
-			fmt.Printf("%s set partitioning expiration\n", t.TableID)
-			continue
-		}
 
-		// Sharding Table等の場合
-		if !tm.ExpirationTime.IsZero() && !expiration.isNever { // NeverはExpirationTimeが設定されているものを上書きするために使うはずなので、Neverがtrueの場合は先に進む
-			fmt.Printf("%s is exist expiration time. %s\n", t.TableID, tm.ExpirationTime)
-			continue
-		}
-
-		_, err = t.Update(ctx, bigquery.TableMetadataToUpdate{
-			ExpirationTime: expiration.ExpirationTime(tm.CreationTime),
-		}, tm.ETag)
-		if errors.As(err, &gapiErr) {
-			if gapiErr.Code == http.StatusNotFound {
-				fmt.Printf("%s is not found\n", t.TableID)
-				continue
-			} else {
-				return err
+			// Sharding Table等の場合
+			if !tm.ExpirationTime.IsZero() && !expiration.isNever { // NeverはExpirationTimeが設定されているものを上書きするために使うはずなので、Neverがtrueの場合は先に進む
+				skipReason = fmt.Sprintf("is exist expiration time. %s", tm.ExpirationTime)
+				return nil, nil
 			}
+			bt, ok := tables.TableDate(t.TableID, tm, base)
+			if !ok {
+				skipReason = fmt.Sprintf("has not date suffix. base date is %s", base)
+				return nil, nil
+			}
+			expirationTime := expiration.ExpirationTime(bt)
+			msg = fmt.Sprintf("set table expiration %s", expirationTime)
+			if expiration.isNever {
+				msg = "set table expiration never"
+			}
+			return &bigquery.TableMetadataToUpdate{
+				ExpirationTime: expirationTime,
+			}, nil
+		}, tables.WithContentionStats(contention))
+		var gapiErr *googleapi.Error
+		if errors.As(err, &gapiErr) && gapiErr.Code == http.StatusNotFound {
+			fmt.Printf("%s is not found\n", t.TableID)
+			continue
 		} else if err != nil {
 			return err
 		}
-		fmt.Printf("%s set table expiration\n", t.TableID)
+		if skipReason != "" {
+			fmt.Printf("%s %s\n", t.TableID, skipReason)
+			continue
+		}
+		if result.Retries > 0 {
+			fmt.Printf("%s %s (retries=%d)\n", t.TableID, msg, result.Retries)
+			continue
+		}
+		fmt.Printf("%s %s\n", t.TableID, msg)
 	}
+	printContentionStats(contention)
 	fmt.Println()
 	fmt.Println("Done")
 	return nil
 }
 
-type ExpirationParam struct {
-	duration time.Duration
-	isNever  bool
-}
-
-func (p *ExpirationParam) String() string {
-	if p.isNever {
-		return "Never"
-	}
-	return p.Duration().String()
-}
-
-func (p *ExpirationParam) Duration() time.Duration {
-	if p.isNever {
-		return 0
-	}
-	return p.duration
-}
-
-func (p *ExpirationParam) ExpirationTime(baseTime time.Time) time.Time {
-	if p.isNever {
-		return bigquery.NeverExpire
+// printContentionStats is ETagが一致せずにTableの更新をやり直した回数を表示する
+func printContentionStats(stats *tables.ContentionStats) {
+	if stats.Tables.Load() == 0 {
+		return
 	}
-	return baseTime.Add(p.duration)
-}
-
-func parseExpirationParam(v string) (*ExpirationParam, error) {
-	if strings.ToLower(v) == "never" {
-		return &ExpirationParam{
-			isNever: true,
-		}, nil
-	}
-	d, err := time.ParseDuration(v)
-	if err != nil {
-		return nil, fmt.Errorf("%s is invalid duration format: %w", v, err)
-	}
-	return &ExpirationParam{
-		duration: d,
-	}, nil
+	fmt.Println()
+	fmt.Printf("Contention: tables=%d retries=%d exhausted=%d\n", stats.Tables.Load(), stats.Retries.Load(), stats.Exhausted.Load())
 }
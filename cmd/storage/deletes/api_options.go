@@ -0,0 +1,33 @@
+package deletes
+
+import (
+	"context"
+
+	"github.com/sinmetalcraft/gcptoolbox/events"
+)
+
+type apiOptions struct {
+	reporter events.Reporter
+}
+
+type APIOptions func(options *apiOptions)
+
+// WithReporter is 処理の結果のEventを受け取るReporterを指定する
+//
+// 指定しない場合はStdoutにTextで出力する
+func WithReporter(reporter events.Reporter) APIOptions {
+	return func(ops *apiOptions) {
+		ops.reporter = reporter
+	}
+}
+
+var stdoutReporter = events.NewStdoutReporter()
+
+// report is Reporterに処理の結果のEventを送る
+func (ops *apiOptions) report(ctx context.Context, e *events.Event) {
+	reporter := ops.reporter
+	if reporter == nil {
+		reporter = stdoutReporter
+	}
+	events.Report(ctx, reporter, e)
+}
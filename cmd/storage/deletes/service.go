@@ -9,6 +9,7 @@ import (
 
 	"cloud.google.com/go/storage"
 	gcsstrings "github.com/sinmetalcraft/gcptoolbox/cmd/storage/strings"
+	"github.com/sinmetalcraft/gcptoolbox/events"
 )
 
 type Service struct {
@@ -22,7 +23,12 @@ func NewService(ctx context.Context, gcs *storage.Client) (*Service, error) {
 }
 
 // DeleteObjectsFromObjectListFilePath is 指定したCloud Storageのpathに書いてあるobject listのobjectを消す
-func (s *Service) DeleteObjectsFromObjectListFilePath(ctx context.Context, objectListFilePath string, skipHeaderRowCount int, multiCount int) error {
+func (s *Service) DeleteObjectsFromObjectListFilePath(ctx context.Context, objectListFilePath string, skipHeaderRowCount int, multiCount int, ops ...APIOptions) error {
+	opt := apiOptions{}
+	for _, o := range ops {
+		o(&opt)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -62,14 +68,14 @@ func (s *Service) DeleteObjectsFromObjectListFilePath(ctx context.Context, objec
 					}
 					if err := s.DeleteObject(ctx, path); err != nil {
 						if errors.Is(err, storage.ErrObjectNotExist) {
-							fmt.Printf("NotExist %s\n", path)
+							opt.report(ctx, &events.Event{Type: events.Skipped, Resource: path, Reason: "not exist"})
 							continue
 						}
-						fmt.Printf("Failed %s\n  err=%s\n", path, err)
+						opt.report(ctx, &events.Event{Type: events.Failed, Action: "delete", Resource: path, Err: err})
 						errCh <- err
 						continue
 					}
-					fmt.Printf("Delete %s\n", path)
+					opt.report(ctx, &events.Event{Type: events.Deleted, Action: "delete", Resource: path})
 				case <-ctx.Done():
 					wg.Done()
 					return
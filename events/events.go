@@ -0,0 +1,213 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is Eventの種類
+type Type string
+
+const (
+	// Skipped is 対象外として処理しなかった. 理由はReasonに入る
+	Skipped Type = "skipped"
+
+	// Created is Resourceを作成した
+	Created Type = "created"
+
+	// Updated is Resourceを更新した. 変更前の値はBefore, 変更後の値はAfterに入る
+	Updated Type = "updated"
+
+	// Deleted is Resourceを削除した
+	Deleted Type = "deleted"
+
+	// Exported is ResourceのExport Jobを実行した
+	Exported Type = "exported"
+
+	// Canceled is 実行中のJobなどをCancelした
+	Canceled Type = "canceled"
+
+	// Failed is 処理に失敗した. 原因はErrに入る
+	Failed Type = "failed"
+)
+
+// Event is Resourceに対して行った処理の結果
+type Event struct {
+	Type Type `json:"type"`
+
+	// Action is 行った処理. eg. update Table.ExpirationTime, delete, snapshot
+	Action string `json:"action,omitempty"`
+
+	// Resource is 処理の対象. eg. TableID, gs://bucket/object
+	Resource string `json:"resource"`
+
+	// Source is CopyやRestoreの元になったResource
+	Source string `json:"source,omitempty"`
+
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// Retries is 競合などでやり直した回数
+	Retries int `json:"retries,omitempty"`
+
+	// DryRun is 実際には処理していない
+	DryRun bool `json:"dryRun,omitempty"`
+
+	Err error `json:"-"`
+
+	Time time.Time `json:"time"`
+}
+
+// String is Eventを1行のTextにする
+func (e *Event) String() string {
+	var b strings.Builder
+	if e.DryRun {
+		b.WriteString("DryRun: ")
+	}
+	switch e.Type {
+	case Skipped:
+		fmt.Fprintf(&b, "%s is skipped. %s", e.Resource, e.Reason)
+		return b.String()
+	case Failed:
+		fmt.Fprintf(&b, "%s failed %s. err=%s", e.Resource, e.Action, e.Err)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%s %s", e.Resource, e.Action)
+	if e.Source != "" {
+		fmt.Fprintf(&b, " from %s", e.Source)
+	}
+	switch {
+	case e.Before != "" && e.After != "":
+		fmt.Fprintf(&b, " %s -> %s", e.Before, e.After)
+	case e.After != "":
+		fmt.Fprintf(&b, " %s", e.After)
+	}
+	if e.Retries > 0 {
+		fmt.Fprintf(&b, " (retries=%d)", e.Retries)
+	}
+	return b.String()
+}
+
+// MarshalJSON is ErrをStringとしてJSONに含める
+func (e *Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	v := struct {
+		*event
+		Error string `json:"error,omitempty"`
+	}{
+		event: (*event)(e),
+	}
+	if e.Err != nil {
+		v.Error = e.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// Reporter is 処理の結果のEventを受け取る
+//
+// 複数のgoroutineから呼ばれることがあるので、実装はgoroutine safeにする
+type Reporter interface {
+	Report(ctx context.Context, e *Event)
+}
+
+// Report is reporterにEventを送る
+//
+// Timeが設定されていなければ現在時刻を入れる. reporterがnilの場合は何もしない
+func Report(ctx context.Context, reporter Reporter, e *Event) {
+	if reporter == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	reporter.Report(ctx, e)
+}
+
+// TextReporter is Eventを1行ずつTextで書き出す
+type TextReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTextReporter is wにTextで書き出すReporterを作る
+func NewTextReporter(w io.Writer) *TextReporter {
+	return &TextReporter{w: w}
+}
+
+// NewStdoutReporter is StdoutにTextで書き出すReporterを作る
+func NewStdoutReporter() *TextReporter {
+	return NewTextReporter(os.Stdout)
+}
+
+func (r *TextReporter) Report(ctx context.Context, e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintln(r.w, e.String())
+}
+
+// JSONLinesReporter is Eventを1行に1つのJSONで書き出す
+type JSONLinesReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLinesReporter is wにJSON Linesで書き出すReporterを作る
+func NewJSONLinesReporter(w io.Writer) *JSONLinesReporter {
+	return &JSONLinesReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *JSONLinesReporter) Report(ctx context.Context, e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed write event. %s err=%s\n", e.Resource, err)
+	}
+}
+
+// Collector is 受け取ったEventをメモリに溜めておく
+//
+// HTTP Serverで結果をResponseとして返す時や、Goから結果を使いたい時に使う
+type Collector struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+// NewCollector is Collectorを作る
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+func (c *Collector) Report(ctx context.Context, e *Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+// Events is 受け取ったEventを受け取った順に返す
+func (c *Collector) Events() []*Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := make([]*Event, len(c.events))
+	copy(l, c.events)
+	return l
+}
+
+// Count is 受け取ったEventのうち、指定したTypeのものの数を返す
+func (c *Collector) Count(t Type) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var count int
+	for _, e := range c.events {
+		if e.Type == t {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,71 @@
+package events_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sinmetalcraft/gcptoolbox/events"
+)
+
+func TestEvent_String(t *testing.T) {
+	cases := []struct {
+		name  string
+		event *events.Event
+		want  string
+	}{
+		{"skipped", &events.Event{Type: events.Skipped, Resource: "t1", Reason: "not found"}, "t1 is skipped. not found"},
+		{"updated", &events.Event{Type: events.Updated, Action: "update Table.ExpirationTime", Resource: "t1", Before: "a", After: "b"}, "t1 update Table.ExpirationTime a -> b"},
+		{"dryrun", &events.Event{Type: events.Deleted, Action: "delete", Resource: "t1", DryRun: true}, "DryRun: t1 delete"},
+		{"source", &events.Event{Type: events.Created, Action: "restore", Resource: "t1", Source: "snap.t1_1"}, "t1 restore from snap.t1_1"},
+		{"failed", &events.Event{Type: events.Failed, Action: "delete", Resource: "t1", Err: errors.New("boom")}, "t1 failed delete. err=boom"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.String(); got != tt.want {
+				t.Errorf("want %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestJSONLinesReporter(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	r := events.NewJSONLinesReporter(&buf)
+	events.Report(ctx, r, &events.Event{Type: events.Failed, Resource: "t1", Err: errors.New("boom")})
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["type"] != "failed" || got["resource"] != "t1" || got["error"] != "boom" {
+		t.Errorf("unexpected json %s", buf.String())
+	}
+	if _, ok := got["time"]; !ok {
+		t.Errorf("time is not set %s", buf.String())
+	}
+}
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+
+	c := events.NewCollector()
+	events.Report(ctx, c, &events.Event{Type: events.Skipped, Resource: "t1"})
+	events.Report(ctx, c, &events.Event{Type: events.Updated, Resource: "t2"})
+	events.Report(ctx, c, &events.Event{Type: events.Skipped, Resource: "t3"})
+
+	if got := len(c.Events()); got != 3 {
+		t.Errorf("want 3 events but got %d", got)
+	}
+	if got := c.Count(events.Skipped); got != 2 {
+		t.Errorf("want 2 skipped but got %d", got)
+	}
+	if got := c.Events()[1].Resource; got != "t2" {
+		t.Errorf("want t2 but got %s", got)
+	}
+}
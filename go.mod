@@ -3,6 +3,7 @@ module github.com/sinmetalcraft/gcptoolbox
 go 1.23.4
 
 require (
+	cloud.google.com/go v0.116.0
 	cloud.google.com/go/bigquery v1.65.0
 	cloud.google.com/go/monitoring v1.22.0
 	cloud.google.com/go/storage v1.49.0
@@ -11,13 +12,13 @@ require (
 	github.com/k0kubun/pp v3.0.1+incompatible
 	github.com/sinmetalcraft/gcpbox v1.24.0
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/time v0.8.0
 	google.golang.org/api v0.214.0
 	google.golang.org/protobuf v1.36.1
 )
 
 require (
 	cel.dev/expr v0.16.1 // indirect
-	cloud.google.com/go v0.116.0 // indirect
 	cloud.google.com/go/auth v0.13.0 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.6 // indirect
 	cloud.google.com/go/compute/metadata v0.6.0 // indirect
@@ -66,7 +67,6 @@ require (
 	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
-	golang.org/x/time v0.8.0 // indirect
 	golang.org/x/tools v0.24.0 // indirect
 	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da // indirect
 	google.golang.org/genproto v0.0.0-20241118233622-e639e219e697 // indirect